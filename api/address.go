@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubiq/spectrum-backend/storage"
+)
+
+type AddressContract struct {
+	Creator     string `json:"creator"`
+	CreationTx  string `json:"creationTx"`
+	CreatedAt   uint64 `json:"createdAt"`
+	CreatedTime uint64 `json:"createdTime"`
+}
+
+type AddressRes struct {
+	Address            string           `json:"address"`
+	Balance            string           `json:"balance,omitempty"`
+	TxCount            int              `json:"txCount"`
+	TokenTransferCount int              `json:"tokenTransferCount"`
+	FirstSeen          *uint64          `json:"firstSeen"`
+	LastSeen           *uint64          `json:"lastSeen"`
+	IsContract         bool             `json:"isContract"`
+	Contract           *AddressContract `json:"contract,omitempty"`
+	BlocksMined        int              `json:"blocksMined"`
+	UnclesMined        int              `json:"unclesMined"`
+	Tokens             []string         `json:"tokens"`
+}
+
+func (a *ApiServer) getAddress(w http.ResponseWriter, r *http.Request) {
+	address := strings.ToLower(mux.Vars(r)["address"])
+	if !addressRegex.MatchString(address) {
+		a.sendError(w, http.StatusBadRequest, "invalid address")
+		return
+	}
+
+	ctx := r.Context()
+	res := AddressRes{Address: address}
+
+	var err error
+
+	if res.TxCount, err = a.backend.TxnCount(ctx, address); err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+
+	if res.TokenTransferCount, err = a.backend.TokenTransferCount(ctx, address); err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+
+	first, last, seen, err := a.backend.AddressSeen(ctx, address)
+	if err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+	if seen {
+		res.FirstSeen, res.LastSeen = &first, &last
+	}
+
+	creation, err := a.backend.TransactionByContractAddress(ctx, address)
+	switch err {
+	case nil:
+		res.IsContract = true
+		res.Contract = &AddressContract{
+			Creator:     creation.From,
+			CreationTx:  creation.Hash,
+			CreatedAt:   creation.BlockNumber,
+			CreatedTime: creation.Timestamp,
+		}
+	case storage.ErrNotFound:
+	default:
+		a.sendStorageError(w, err)
+		return
+	}
+
+	if res.BlocksMined, err = a.backend.MinedBlockCount(ctx, address); err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+
+	if res.UnclesMined, err = a.backend.MinedUncleCount(ctx, address); err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+
+	if res.Tokens, err = a.backend.AddressTokens(ctx, address); err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+
+	// The rest of the summary is still useful when the node is unreachable
+	if res.Balance, err = a.rpc.GetBalance(address, "latest"); err != nil {
+		log.Warnf("Could not get balance of %v: %v", address, err)
+	}
+
+	a.sendJson(w, http.StatusOK, res)
+}
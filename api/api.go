@@ -11,7 +11,11 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 	log "github.com/sirupsen/logrus"
+	"github.com/ubiq/spectrum-backend/graphql"
+	"github.com/ubiq/spectrum-backend/health"
+	"github.com/ubiq/spectrum-backend/metrics"
 	"github.com/ubiq/spectrum-backend/models"
+	"github.com/ubiq/spectrum-backend/rpc"
 	"github.com/ubiq/spectrum-backend/storage"
 	"github.com/ubiq/spectrum-backend/util"
 )
@@ -24,35 +28,106 @@ type Config struct {
 		Mode    string `json:"mode"`
 		Geodb   string `json:"mmdb"`
 	} `json:"nodemap"`
+	JsonRpc struct {
+		// Forward read only methods and data the index can't serve to the node, calls are
+		// limited like /rpc/proxy ones
+		Passthrough bool `json:"passthrough"`
+	} `json:"jsonrpc"`
+	Proxy struct {
+		Enabled bool `json:"enabled"`
+		// Methods forwarded to the node, empty allows the default set
+		Methods []string `json:"methods"`
+		// Calls per second and client, 0 disables the limit
+		Rate  float64 `json:"rate"`
+		Burst int     `json:"burst"`
+	} `json:"proxy"`
+	Export struct {
+		// Rows per export, 0 uses the default
+		MaxRows int `json:"maxrows"`
+	} `json:"export"`
+	GraphQL struct {
+		// Limits on the nesting and the estimated cost of a query, 0 uses the defaults
+		MaxDepth      int `json:"maxdepth"`
+		MaxComplexity int `json:"maxcomplexity"`
+	} `json:"graphql"`
+	Auth struct {
+		// Reject requests without an api key
+		Required bool `json:"required"`
+		// Keys accepted besides the ones in the apikeys collection
+		Keys []struct {
+			Key  string `json:"key"`
+			Name string `json:"name"`
+			Tier string `json:"tier"`
+		} `json:"keys"`
+	} `json:"auth"`
+	// Requests per second by tier, clients without a key are limited per address by the
+	// anonymous tier
+	Tiers map[string]struct {
+		Rate  float64 `json:"rate"`
+		Burst int     `json:"burst"`
+	} `json:"tiers"`
+	Cache struct {
+		// Blocks below the head after which their data can't change, 0 uses the default
+		FinalityDepth uint64 `json:"finalitydepth"`
+		// Seconds responses near the head may be reused, 0 uses the default
+		MaxAge int `json:"maxage"`
+		// Responses of the hot endpoints kept in memory and the seconds they live, 0 uses
+		// the defaults
+		Entries int `json:"entries"`
+		TTL     int `json:"ttl"`
+	} `json:"cache"`
+	Cors struct {
+		// Allowed origins, empty allows all of them
+		Origins []string `json:"origins"`
+	} `json:"cors"`
+	// Take the client address from X-Forwarded-For, only behind a proxy that sets it
+	TrustForwarded bool `json:"trustforwarded"`
 }
 
 type ApiServer struct {
 	backend *storage.MongoDB
+	rpc     *rpc.RPCClient
 	cfg     *Config
 	nodemap struct {
 		nodes   *map[string]Node
 		geodata *[]Peer
 	}
+	proxyMethods map[string]bool
+	proxyLimiter *rateLimiter
+	graph        *graphql.Schema
+	auth         *apiAuth
+	head         headWatcher
+	results      *resultCache
+	health       *health.Checker
+	spec         map[string]interface{}
 }
 
 type AccountTxn struct {
 	Txns  []models.Transaction `bson:"txns" json:"txns"`
 	Total int                  `bson:"total" json:"total"`
+	Next  string               `bson:"next" json:"next,omitempty"`
+	Prev  string               `bson:"prev" json:"prev,omitempty"`
 }
 
 type AccountTokenTransfer struct {
 	Txns  []models.TokenTransfer `bson:"txns" json:"txns"`
 	Total int                    `bson:"total" json:"total"`
+	Next  string                 `bson:"next" json:"next,omitempty"`
+	Prev  string                 `bson:"prev" json:"prev,omitempty"`
 }
 
 type BlockRes struct {
 	Blocks []models.Block `bson:"blocks" json:"blocks"`
 	Total  int            `bson:"total" json:"total"`
+	Next   string         `bson:"next" json:"next,omitempty"`
+	Prev   string         `bson:"prev" json:"prev,omitempty"`
 }
 
 type UncleRes struct {
 	Uncles []models.Uncle `bson:"uncles" json:"uncles"`
 	Total  int            `bson:"total" json:"total"`
+	Next   string         `bson:"next" json:"next,omitempty"`
+	Prev   string         `bson:"prev" json:"prev,omitempty"`
 }
 
 func checkNodes() {
@@ -75,7 +150,7 @@ func checkNodes() {
 	}
 }
 
-func New(backend *storage.MongoDB, cfg *Config) *ApiServer {
+func New(backend *storage.MongoDB, rpc *rpc.RPCClient, health *health.Checker, cfg *Config) *ApiServer {
 	nodemap := struct {
 		nodes   *map[string]Node
 		geodata *[]Peer
@@ -84,7 +159,25 @@ func New(backend *storage.MongoDB, cfg *Config) *ApiServer {
 		nil,
 	}
 
-	return &ApiServer{backend, cfg, nodemap}
+	methods := cfg.Proxy.Methods
+	if len(methods) == 0 {
+		methods = defaultProxyMethods
+	}
+
+	a := &ApiServer{backend, rpc, cfg, nodemap, methodSet(methods), newRateLimiter(cfg.Proxy.Rate, cfg.Proxy.Burst), nil, newApiAuth(backend, cfg), headWatcher{}, nil, health, nil}
+	a.graph = a.graphSchema()
+	a.spec = a.openApi()
+
+	entries, ttl := cfg.Cache.Entries, cfg.Cache.TTL
+	if entries <= 0 {
+		entries = defaultResultEntries
+	}
+	if ttl <= 0 {
+		ttl = defaultResultTTL
+	}
+	a.results = newResultCache(entries, time.Duration(ttl)*time.Second)
+
+	return a
 }
 
 func (a *ApiServer) Start() {
@@ -118,32 +211,14 @@ func (a *ApiServer) Start() {
 		}()
 	}
 
-	r := mux.NewRouter()
-
-	r.HandleFunc("/supply/{symbol}", a.getSupply).Methods("GET")
-	r.HandleFunc("/forkedblock/{number}", a.getBlockByNumber).Methods("GET")
-	r.HandleFunc("/block/{number}", a.getBlockByNumber).Methods("GET")
-	r.HandleFunc("/block/{number}/txns", a.getBlockTransactions).Methods("GET")
-	r.HandleFunc("/blockbyhash/{hash}", a.getBlockByHash).Methods("GET")
-	r.HandleFunc("/latest", a.getLatestBlock).Methods("GET")
-	r.HandleFunc("/latestblocks/{limit}", a.getLatestBlocks).Methods("GET")
-	r.HandleFunc("/latestforkedblocks/{limit}", a.getLatestForkedBlocks).Methods("GET")
-	r.HandleFunc("/latesttransactions/{limit}", a.getLatestTransactions).Methods("GET")
-	r.HandleFunc("/latestaccounttxns/{hash}", a.getLatestTransactionsByAccount).Methods("GET")
-	r.HandleFunc("/latestaccounttokentxns/{hash}", a.getLatestTokenTransfersByAccount).Methods("GET")
-	r.HandleFunc("/latesttokentransfers/{limit}", a.getLatestTokenTransfers).Methods("GET")
-	r.HandleFunc("/latestuncles/{limit}", a.getLatestUncles).Methods("GET")
-	r.HandleFunc("/transaction/{hash}", a.getTransactionByHash).Methods("GET")
-	r.HandleFunc("/transactionbycontract/{hash}", a.getTransactionByContractAddress).Methods("GET")
-	r.HandleFunc("/latesttransfersbytoken/{hash}", a.getLatestTransfersByToken).Methods("GET")
-	r.HandleFunc("/tokentransfersbyaccount/{token}/{account}", a.getTokenTransfersByAccount).Methods("GET")
-	r.HandleFunc("/uncle/{hash}", a.getUncleByHash).Methods("GET")
-	r.HandleFunc("/charts/{chart}/{limit}", a.getChartData).Methods("GET")
-	r.HandleFunc("/geodata", a.getGeodata).Methods("GET")
-
-	r.Use(loggingMiddleware)
-
-	handler := cors.Default().Handler(r)
+	go a.watchHead()
+
+	handler := cors.New(cors.Options{
+		AllowedOrigins: a.cfg.Cors.Origins,
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "X-Api-Key"},
+		ExposedHeaders: []string{"Retry-After", "X-Next-Cursor", "X-Prev-Cursor", "X-Export-Truncated", "X-Export-Next-Block"},
+	}).Handler(a.router())
 	if err := http.ListenAndServe("0.0.0.0:"+a.cfg.Port, handler); err != nil {
 		log.Fatal(err)
 	}
@@ -167,6 +242,18 @@ func (r *responseWriterWithCode) Write(b []byte) (int, error) {
 	return r.ResponseWriter.Write(b)
 }
 
+// Flush lets streaming handlers push out what they wrote so far.
+func (r *responseWriterWithCode) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+var (
+	httpRequests = metrics.NewCounter("spectrum_http_requests_total", "API requests by route and status.", "route", "code")
+	httpDuration = metrics.NewHistogram("spectrum_http_request_duration_seconds", "Duration of API requests by route.", metrics.DefaultBuckets, "route")
+)
+
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -176,17 +263,28 @@ func loggingMiddleware(next http.Handler) http.Handler {
 
 		next.ServeHTTP(rwwc, r)
 
-		log.Debugf("%v - %v - %v - took %v", r.RemoteAddr, r.RequestURI, rwwc.statusCode, time.Since(start))
+		log.Debugf("%v - %v - %v - %v - took %v", requestId(r), r.RemoteAddr, r.RequestURI, rwwc.statusCode, time.Since(start))
+
+		// Label by the route template, paths hold hashes and addresses
+		route := "unknown"
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tpl, err := cur.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		httpRequests.Inc(route, strconv.Itoa(rwwc.statusCode))
+		httpDuration.Since(start, route)
 	})
 }
 
 func (a *ApiServer) getBlockByHash(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	block, err := a.backend.BlockByHash(params["hash"])
+	block, err := a.backend.BlockByHash(r.Context(), params["hash"])
 	if err != nil {
-		a.sendError(w, http.StatusBadRequest, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
+	cacheBlock(r, block.Number)
 	a.sendJson(w, http.StatusOK, block)
 }
 
@@ -197,11 +295,12 @@ func (a *ApiServer) getBlockByNumber(w http.ResponseWriter, r *http.Request) {
 		a.sendError(w, http.StatusBadRequest, uerr.Error())
 		return
 	}
-	block, err := a.backend.BlockByNumber(number)
+	block, err := a.backend.BlockByNumber(r.Context(), number)
 	if err != nil {
-		a.sendError(w, http.StatusBadRequest, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
+	cacheBlock(r, block.Number)
 	a.sendJson(w, http.StatusOK, block)
 }
 
@@ -212,11 +311,12 @@ func (a *ApiServer) getForkedBlockByNumber(w http.ResponseWriter, r *http.Reques
 		a.sendError(w, http.StatusBadRequest, uerr.Error())
 		return
 	}
-	forkedblock, err := a.backend.ForkedBlockByNumber(number)
+	forkedblock, err := a.backend.ForkedBlockByNumber(r.Context(), number)
 	if err != nil {
-		a.sendError(w, http.StatusBadRequest, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
+	cacheBlock(r, forkedblock.Number)
 	a.sendJson(w, http.StatusOK, forkedblock)
 }
 
@@ -227,262 +327,313 @@ func (a *ApiServer) getBlockTransactions(w http.ResponseWriter, r *http.Request)
 		a.sendError(w, http.StatusBadRequest, uerr.Error())
 		return
 	}
-	block, err := a.backend.BlockTransactions(number)
+	page, err := parsePage(r)
 	if err != nil {
 		a.sendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	a.sendJson(w, http.StatusOK, block)
+	txns, more, err := a.backend.BlockTransactions(r.Context(), number, page.Page)
+	if err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+	next, prev := page.links(&txns, more)
+	setLinks(w, next, prev)
+	cacheBlock(r, number)
+	a.sendJson(w, http.StatusOK, txns)
 }
 
 func (a *ApiServer) getLatestBlock(w http.ResponseWriter, r *http.Request) {
-	blocks, err := a.backend.LatestBlock()
+	blocks, err := a.backend.LatestBlock(r.Context())
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
 	a.sendJson(w, http.StatusOK, blocks)
 }
 
 func (a *ApiServer) getLatestBlocks(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	limit, err := strconv.Atoi(params["limit"])
+	page, err := parsePage(r)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if limit > 1000 {
-		limit = 1000
-	}
-	blocks, err := a.backend.LatestBlocks(limit)
-
+	blocks, more, err := a.backend.LatestBlocks(r.Context(), page.Page)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
 
-	count, err := a.backend.TotalBlockCount()
+	count, err := a.backend.TotalBlockCount(r.Context())
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
 
 	var res BlockRes
+	res.Next, res.Prev = page.links(&blocks, more)
 	res.Blocks = blocks
 	res.Total = count
 
+	setLinks(w, res.Next, res.Prev)
 	a.sendJson(w, http.StatusOK, res)
 }
 
 func (a *ApiServer) getLatestForkedBlocks(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	limit, err := strconv.Atoi(params["limit"])
+	page, err := parsePage(r)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if limit > 1000 {
-		limit = 1000
-	}
-	blocks, err := a.backend.LatestForkedBlocks(limit)
+	blocks, more, err := a.backend.LatestForkedBlocks(r.Context(), page.Page)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
+	next, prev := page.links(&blocks, more)
+	setLinks(w, next, prev)
 	a.sendJson(w, http.StatusOK, blocks)
 }
 
 func (a *ApiServer) getLatestTransactions(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	limit, err := strconv.Atoi(params["limit"])
+	page, err := parsePage(r)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if limit > 1000 {
-		limit = 1000
-	}
-	txns, err := a.backend.LatestTransactions(limit)
+	txns, more, err := a.backend.LatestTransactions(r.Context(), page.Page)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
 
-	count, err := a.backend.TotalTxnCount()
+	count, err := a.backend.TotalTxnCount(r.Context())
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
 
 	var res AccountTxn
+	res.Next, res.Prev = page.links(&txns, more)
 	res.Txns = txns
 	res.Total = count
 
+	setLinks(w, res.Next, res.Prev)
 	a.sendJson(w, http.StatusOK, res)
 }
 
 func (a *ApiServer) getLatestTransactionsByAccount(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	txns, err := a.backend.LatestTransactionsByAccount(params["hash"])
+	page, err := parsePage(r)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	txns, more, err := a.backend.LatestTransactionsByAccount(r.Context(), params["hash"], page.Page)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
-	count, err := a.backend.TxnCount(params["hash"])
+
+	count, err := a.backend.TxnCount(r.Context(), params["hash"])
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
 
 	var res AccountTxn
+	res.Next, res.Prev = page.links(&txns, more)
 	res.Txns = txns
 	res.Total = count
 
+	setLinks(w, res.Next, res.Prev)
 	a.sendJson(w, http.StatusOK, res)
 }
 
 func (a *ApiServer) getLatestTokenTransfersByAccount(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	txns, err := a.backend.LatestTokenTransfersByAccount(params["hash"])
+	page, err := parsePage(r)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	txns, more, err := a.backend.LatestTokenTransfersByAccount(r.Context(), params["hash"], page.Page)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
+		return
+	}
+	if err := a.formatTransfers(r.Context(), txns); err != nil {
+		a.sendStorageError(w, err)
 		return
 	}
 
-	count, err := a.backend.TokenTransferCount(params["hash"])
+	count, err := a.backend.TokenTransferCount(r.Context(), params["hash"])
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
 
 	var res AccountTokenTransfer
+	res.Next, res.Prev = page.links(&txns, more)
 	res.Txns = txns
 	res.Total = count
 
+	setLinks(w, res.Next, res.Prev)
 	a.sendJson(w, http.StatusOK, res)
 }
 
 func (a *ApiServer) getLatestTokenTransfers(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	limit, err := strconv.Atoi(params["limit"])
+	page, err := parsePage(r)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if limit > 1000 {
-		limit = 1000
-	}
-	transfers, err := a.backend.LatestTokenTransfers(limit)
+	transfers, more, err := a.backend.LatestTokenTransfers(r.Context(), page.Page)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
+		return
+	}
+	if err := a.formatTransfers(r.Context(), transfers); err != nil {
+		a.sendStorageError(w, err)
 		return
 	}
 
-	count, err := a.backend.TokenTransferCount(params["hash"])
+	count, err := a.backend.TotalTokenTransferCount(r.Context())
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
 
 	var res AccountTokenTransfer
+	res.Next, res.Prev = page.links(&transfers, more)
 	res.Txns = transfers
 	res.Total = count
 
+	setLinks(w, res.Next, res.Prev)
 	a.sendJson(w, http.StatusOK, res)
 }
 
 func (a *ApiServer) getLatestUncles(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	limit, err := strconv.Atoi(params["limit"])
+	page, err := parsePage(r)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if limit > 1000 {
-		limit = 1000
-	}
-	uncles, err := a.backend.LatestUncles(limit)
+	uncles, more, err := a.backend.LatestUncles(r.Context(), page.Page)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
 
-	count, err := a.backend.TotalUncleCount()
+	count, err := a.backend.TotalUncleCount(r.Context())
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
 
 	var res UncleRes
+	res.Next, res.Prev = page.links(&uncles, more)
 	res.Uncles = uncles
 	res.Total = count
 
+	setLinks(w, res.Next, res.Prev)
 	a.sendJson(w, http.StatusOK, res)
 }
 
 func (a *ApiServer) getTransactionByHash(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	txn, err := a.backend.TransactionByHash(params["hash"])
+	txn, err := a.backend.TransactionByHash(r.Context(), params["hash"])
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
+	cacheBlock(r, txn.BlockNumber)
 	a.sendJson(w, http.StatusOK, txn)
 }
 
 func (a *ApiServer) getTransactionByContractAddress(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	txn, err := a.backend.TransactionByContractAddress(params["hash"])
+	txn, err := a.backend.TransactionByContractAddress(r.Context(), params["hash"])
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
+	cacheBlock(r, txn.BlockNumber)
 	a.sendJson(w, http.StatusOK, txn)
 }
 
 func (a *ApiServer) getTokenTransfersByAccount(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	txns, err := a.backend.TokenTransfersByAccount(params["token"], params["account"])
+	page, err := parsePage(r)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	txns, more, err := a.backend.TokenTransfersByAccount(r.Context(), params["token"], params["account"], page.Page)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
+		return
+	}
+	if err := a.formatTransfers(r.Context(), txns); err != nil {
+		a.sendStorageError(w, err)
 		return
 	}
-	count, err := a.backend.TokenTransferByAccountCount(params["token"], params["account"])
+
+	count, err := a.backend.TokenTransferByAccountCount(r.Context(), params["token"], params["account"])
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
+
 	var res AccountTokenTransfer
+	res.Next, res.Prev = page.links(&txns, more)
 	res.Txns = txns
 	res.Total = count
+
+	setLinks(w, res.Next, res.Prev)
 	a.sendJson(w, http.StatusOK, res)
 }
 
 func (a *ApiServer) getLatestTransfersByToken(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	txns, err := a.backend.LatestTransfersByToken(params["hash"])
+	page, err := parsePage(r)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	txns, more, err := a.backend.LatestTransfersByToken(r.Context(), params["hash"], page.Page)
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
+		return
+	}
+	if err := a.formatTransfers(r.Context(), txns); err != nil {
+		a.sendStorageError(w, err)
 		return
 	}
-	count, err := a.backend.TokenTransferCountByContract(params["hash"])
+
+	count, err := a.backend.TokenTransferCountByContract(r.Context(), params["hash"])
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
+
 	var res AccountTokenTransfer
+	res.Next, res.Prev = page.links(&txns, more)
 	res.Txns = txns
 	res.Total = count
+
+	setLinks(w, res.Next, res.Prev)
 	a.sendJson(w, http.StatusOK, res)
 }
 
 func (a *ApiServer) getUncleByHash(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	uncle, err := a.backend.UncleByHash(params["hash"])
+	uncle, err := a.backend.UncleByHash(r.Context(), params["hash"])
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
+	cacheBlock(r, uncle.BlockNumber)
 	a.sendJson(w, http.StatusOK, uncle)
 }
 
@@ -490,9 +641,9 @@ func (a *ApiServer) getSupply(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	supplyOnly := r.URL.Query().Get("supplyOnly")
 
-	store, err := a.backend.SupplyObject(params["symbol"])
+	store, err := a.backend.SupplyObject(r.Context(), params["symbol"])
 	if err != nil {
-		a.sendError(w, http.StatusInternalServerError, err.Error())
+		a.sendStorageError(w, err)
 		return
 	}
 
@@ -514,40 +665,37 @@ func (a *ApiServer) getChartData(w http.ResponseWriter, r *http.Request) {
 	miner := r.URL.Query().Get("miner")
 
 	if params["chart"] == "poolhashrate" && miner == "" {
-		a.sendError(w, http.StatusInternalServerError, "Please specify one miner address")
+		a.sendError(w, http.StatusBadRequest, "Please specify one miner address")
 		return
 	}
 
 	limit, err := strconv.ParseInt(params["limit"], 10, 0)
 
 	if err != nil {
-		limit = 1 << 62
+		a.sendError(w, http.StatusBadRequest, "invalid limit")
+		return
 	}
 
 	switch params["chart"] {
 	case "minedblocks":
-		data, err := a.backend.ChartDataML(params["chart"], limit, miner)
+		data, err := a.backend.ChartDataML(r.Context(), params["chart"], limit, miner)
 
 		if err != nil {
-			a.sendError(w, http.StatusInternalServerError, err.Error())
+			a.sendStorageError(w, err)
 			return
 		}
 		a.sendJson(w, http.StatusOK, data)
 	default:
-		data, err := a.backend.ChartData(params["chart"], limit)
+		data, err := a.backend.ChartData(r.Context(), params["chart"], limit)
 
 		if err != nil {
-			a.sendError(w, http.StatusInternalServerError, err.Error())
+			a.sendStorageError(w, err)
 			return
 		}
 		a.sendJson(w, http.StatusOK, data)
 	}
 }
 
-func (a *ApiServer) sendError(w http.ResponseWriter, code int, msg string) {
-	a.sendJson(w, code, map[string]string{"error": msg})
-}
-
 func (a *ApiServer) sendJson(w http.ResponseWriter, code int, payload interface{}) {
 	response, _ := json.Marshal(payload)
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ubiq/spectrum-backend/models"
+	"github.com/ubiq/spectrum-backend/storage"
+)
+
+/*
+	Clients identify with an api key in the X-Api-Key header or the apikey query parameter.
+	Keys come from the config or the apikeys collection and name a rate limit tier, clients
+	without a key are limited per address by the anonymous tier. Tiers missing from the
+	config are not limited.
+*/
+
+const (
+	anonymousTier = "anonymous"
+	defaultTier   = "default"
+
+	apiKeyTTL = time.Minute
+	// Cached lookups, unknown keys included, before the cache is dropped
+	maxApiKeys = 10000
+)
+
+type cachedKey struct {
+	key     *models.ApiKey
+	expires time.Time
+}
+
+type apiAuth struct {
+	sync.Mutex
+	backend  *storage.MongoDB
+	required bool
+	static   map[string]*models.ApiKey
+	cache    map[string]cachedKey
+	limiters map[string]*rateLimiter
+}
+
+func newApiAuth(backend *storage.MongoDB, cfg *Config) *apiAuth {
+	auth := &apiAuth{
+		backend:  backend,
+		required: cfg.Auth.Required,
+		static:   make(map[string]*models.ApiKey, len(cfg.Auth.Keys)),
+		cache:    make(map[string]cachedKey),
+		limiters: make(map[string]*rateLimiter, len(cfg.Tiers)),
+	}
+
+	for _, k := range cfg.Auth.Keys {
+		auth.static[k.Key] = &models.ApiKey{Key: k.Key, Name: k.Name, Tier: k.Tier}
+	}
+
+	for name, tier := range cfg.Tiers {
+		auth.limiters[name] = newRateLimiter(tier.Rate, tier.Burst)
+	}
+
+	return auth
+}
+
+// lookup returns the client of key, nil when there is none.
+func (auth *apiAuth) lookup(r *http.Request, key string) (*models.ApiKey, error) {
+	if k, ok := auth.static[key]; ok {
+		return k, nil
+	}
+
+	now := time.Now()
+
+	auth.Lock()
+	cached, ok := auth.cache[key]
+	auth.Unlock()
+
+	if ok && now.Before(cached.expires) {
+		return cached.key, nil
+	}
+
+	var found *models.ApiKey
+
+	apiKey, err := auth.backend.ApiKey(r.Context(), key)
+	if err == nil {
+		found = &apiKey
+	} else if err != storage.ErrNotFound {
+		return nil, err
+	}
+
+	auth.Lock()
+	if len(auth.cache) >= maxApiKeys {
+		auth.cache = make(map[string]cachedKey)
+	}
+	auth.cache[key] = cachedKey{found, now.Add(apiKeyTTL)}
+	auth.Unlock()
+
+	return found, nil
+}
+
+func (a *ApiServer) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Preflight requests are answered by the cors handler without credentials
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := r.Header.Get("X-Api-Key")
+		if key == "" {
+			key = r.URL.Query().Get("apikey")
+		}
+
+		tier, client := anonymousTier, "ip:"+clientIP(r, a.cfg.TrustForwarded)
+
+		if key != "" {
+			apiKey, err := a.auth.lookup(r, key)
+			if err != nil {
+				log.Errorf("Could not look up api key: %v", err)
+				a.sendError(w, http.StatusServiceUnavailable, "could not check api key")
+				return
+			}
+			if apiKey == nil || apiKey.Disabled {
+				a.sendError(w, http.StatusUnauthorized, "invalid api key")
+				return
+			}
+
+			tier, client = apiKey.Tier, "key:"+key
+			if tier == "" {
+				tier = defaultTier
+			}
+		} else if a.auth.required {
+			a.sendError(w, http.StatusUnauthorized, "missing api key")
+			return
+		}
+
+		if ok, wait := a.auth.limiters[tier].take(client, 1); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			a.sendError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+/*
+	GET responses carry an ETag of their body and a Cache-Control lifetime. Handlers that
+	serve data of a single block mark it with cacheBlock, once that block is below the
+	finality depth the response can't change anymore and is cached as immutable. The rest
+	is cached briefly. If-None-Match is answered with 304.
+*/
+
+const (
+	defaultFinalityDepth = 120
+	defaultMaxAge        = 10
+	immutableControl     = "public, max-age=31536000, immutable"
+)
+
+// Streamed responses are not buffered
+var uncachedRoutes = map[string]bool{
+	"/export/address/{addr}":   true,
+	"/export/token/{contract}": true,
+}
+
+type cacheHintKey struct{}
+
+type cacheHint struct {
+	block  uint64
+	marked bool
+}
+
+// cacheBlock marks the response of r as holding data of block number only.
+func cacheBlock(r *http.Request, number uint64) {
+	if hint, ok := r.Context().Value(cacheHintKey{}).(*cacheHint); ok {
+		hint.block, hint.marked = number, true
+	}
+}
+
+// bufferedWriter holds the response back until its ETag is known.
+type bufferedWriter struct {
+	http.ResponseWriter
+	code int
+	buf  bytes.Buffer
+}
+
+func (b *bufferedWriter) WriteHeader(code int) {
+	b.code = code
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	return b.buf.Write(p)
+}
+
+func (a *ApiServer) finalityDepth() uint64 {
+	if a.cfg.Cache.FinalityDepth > 0 {
+		return a.cfg.Cache.FinalityDepth
+	}
+	return defaultFinalityDepth
+}
+
+func (a *ApiServer) maxAge() int {
+	if a.cfg.Cache.MaxAge > 0 {
+		return a.cfg.Cache.MaxAge
+	}
+	return defaultMaxAge
+}
+
+func (a *ApiServer) cacheMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if route := mux.CurrentRoute(r); route != nil {
+			if tpl, err := route.GetPathTemplate(); err == nil && uncachedRoutes[strings.TrimPrefix(tpl, apiPrefix)] {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		hint := &cacheHint{}
+		r = r.WithContext(context.WithValue(r.Context(), cacheHintKey{}, hint))
+
+		bw := &bufferedWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(bw, r)
+
+		if bw.code != http.StatusOK {
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(bw.code)
+			w.Write(bw.buf.Bytes())
+			return
+		}
+
+		etag := fmt.Sprintf(`"%x"`, sha1.Sum(bw.buf.Bytes()))
+		w.Header().Set("ETag", etag)
+
+		if hint.marked && a.head.final(hint.block, a.finalityDepth()) {
+			w.Header().Set("Cache-Control", immutableControl)
+		} else {
+			w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(a.maxAge()))
+		}
+
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(bw.buf.Bytes())
+	})
+}
+
+// etagMatch compares an If-None-Match header with etag, weakly as RFC 7232 asks for.
+func etagMatch(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == "*" || v == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ubiq/spectrum-backend/storage"
+)
+
+/*
+	Errors are answered with the same envelope everywhere: the message, a code that stays
+	stable across releases, and the id of the request so a report can be matched with the
+	logs. Ids sent by a proxy in X-Request-Id are kept, otherwise one is generated.
+*/
+
+const requestIdHeader = "X-Request-Id"
+
+var requestIdRegex = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIdKey struct{}
+
+type ErrorRes struct {
+	Error     string `json:"error"`
+	Code      string `json:"code"`
+	RequestId string `json:"requestId,omitempty"`
+	// Set when the data was dropped by the retention rules
+	Pruned bool `json:"pruned,omitempty"`
+}
+
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusNotFound:            "not_found",
+	http.StatusMethodNotAllowed:    "method_not_allowed",
+	http.StatusGone:                "gone",
+	http.StatusTooManyRequests:     "rate_limited",
+	http.StatusInternalServerError: "internal",
+	http.StatusServiceUnavailable:  "unavailable",
+}
+
+func errorCode(status int) string {
+	if code, ok := errorCodes[status]; ok {
+		return code
+	}
+	return "error"
+}
+
+func newRequestId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func requestIdMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIdHeader)
+		if !requestIdRegex.MatchString(id) {
+			id = newRequestId()
+		}
+
+		w.Header().Set(requestIdHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIdKey{}, id)))
+	})
+}
+
+func requestId(r *http.Request) string {
+	id, _ := r.Context().Value(requestIdKey{}).(string)
+	return id
+}
+
+// sendError answers with the error envelope, the request id is taken from the response
+// headers set by requestIdMiddleware.
+func (a *ApiServer) sendError(w http.ResponseWriter, code int, msg string) {
+	a.sendJson(w, code, &ErrorRes{Error: msg, Code: errorCode(code), RequestId: w.Header().Get(requestIdHeader)})
+}
+
+// sendStorageError answers with the status matching the kind of err, internal errors are
+// logged and their text is kept from the client.
+func (a *ApiServer) sendStorageError(w http.ResponseWriter, err error) {
+	switch storage.KindOf(err) {
+	case storage.KindNotFound:
+		a.sendError(w, http.StatusNotFound, err.Error())
+	case storage.KindInvalid:
+		a.sendError(w, http.StatusBadRequest, err.Error())
+	case storage.KindPruned:
+		a.sendJson(w, http.StatusGone, &ErrorRes{Error: err.Error(), Code: errorCode(http.StatusGone), RequestId: w.Header().Get(requestIdHeader), Pruned: true})
+	case storage.KindUnavailable:
+		log.Warnf("Request %v: storage unavailable: %v", w.Header().Get(requestIdHeader), err)
+		a.sendError(w, http.StatusServiceUnavailable, "storage unavailable")
+	default:
+		log.Errorf("Request %v: %v", w.Header().Get(requestIdHeader), err)
+		a.sendError(w, http.StatusInternalServerError, "internal error")
+	}
+}
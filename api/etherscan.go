@@ -0,0 +1,638 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ubiq/spectrum-backend/models"
+	"github.com/ubiq/spectrum-backend/storage"
+	"github.com/ubiq/spectrum-backend/util"
+)
+
+/*
+	Etherscan compatible /api endpoint, the common subset of the account, block, stats and
+	proxy modules with Etherscan's parameter names and response envelope. Like Etherscan
+	every answer is a 200, failures are told apart by status "0".
+*/
+
+const (
+	etherscanMaxRecords  = 10000
+	etherscanMaxBalances = 20
+)
+
+var addressRegex = regexp.MustCompile("^0x[0-9a-fA-F]{40}$")
+
+type etherscanResponse struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+	Result  interface{} `json:"result"`
+}
+
+type etherscanTx struct {
+	BlockNumber       string `json:"blockNumber"`
+	TimeStamp         string `json:"timeStamp"`
+	Hash              string `json:"hash"`
+	Nonce             string `json:"nonce"`
+	BlockHash         string `json:"blockHash"`
+	TransactionIndex  string `json:"transactionIndex"`
+	From              string `json:"from"`
+	To                string `json:"to"`
+	Value             string `json:"value"`
+	Gas               string `json:"gas"`
+	GasPrice          string `json:"gasPrice"`
+	IsError           string `json:"isError"`
+	TxReceiptStatus   string `json:"txreceipt_status"`
+	Input             string `json:"input"`
+	ContractAddress   string `json:"contractAddress"`
+	CumulativeGasUsed string `json:"cumulativeGasUsed"`
+	GasUsed           string `json:"gasUsed"`
+	Confirmations     string `json:"confirmations"`
+}
+
+type etherscanTokenTx struct {
+	BlockNumber       string `json:"blockNumber"`
+	TimeStamp         string `json:"timeStamp"`
+	Hash              string `json:"hash"`
+	Nonce             string `json:"nonce"`
+	BlockHash         string `json:"blockHash"`
+	From              string `json:"from"`
+	ContractAddress   string `json:"contractAddress"`
+	To                string `json:"to"`
+	Value             string `json:"value"`
+	TokenName         string `json:"tokenName"`
+	TokenSymbol       string `json:"tokenSymbol"`
+	TokenDecimal      string `json:"tokenDecimal"`
+	TransactionIndex  string `json:"transactionIndex"`
+	Gas               string `json:"gas"`
+	GasPrice          string `json:"gasPrice"`
+	GasUsed           string `json:"gasUsed"`
+	CumulativeGasUsed string `json:"cumulativeGasUsed"`
+	Input             string `json:"input"`
+	Confirmations     string `json:"confirmations"`
+}
+
+type etherscanBalance struct {
+	Account string `json:"account"`
+	Balance string `json:"balance"`
+}
+
+type etherscanUncleReward struct {
+	Miner         string `json:"miner"`
+	UnclePosition string `json:"unclePosition"`
+	BlockReward   string `json:"blockreward"`
+}
+
+type etherscanBlockReward struct {
+	BlockNumber          string                 `json:"blockNumber"`
+	TimeStamp            string                 `json:"timeStamp"`
+	BlockMiner           string                 `json:"blockMiner"`
+	BlockReward          string                 `json:"blockReward"`
+	Uncles               []etherscanUncleReward `json:"uncles"`
+	UncleInclusionReward string                 `json:"uncleInclusionReward"`
+}
+
+func (a *ApiServer) getEtherscan(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	switch q.Get("module") {
+	case "account":
+		a.etherscanAccount(w, r, q)
+	case "block":
+		a.etherscanBlock(w, r, q)
+	case "stats":
+		a.etherscanStats(w, r, q)
+	case "proxy":
+		a.etherscanProxy(w, r, q)
+	default:
+		a.etherscanError(w, "Error! Missing Or invalid Module name")
+	}
+}
+
+func (a *ApiServer) etherscanResult(w http.ResponseWriter, result interface{}) {
+	a.sendJson(w, http.StatusOK, etherscanResponse{"1", "OK", result})
+}
+
+func (a *ApiServer) etherscanError(w http.ResponseWriter, msg string) {
+	a.sendJson(w, http.StatusOK, etherscanResponse{"0", "NOTOK", msg})
+}
+
+func (a *ApiServer) etherscanList(w http.ResponseWriter, result interface{}, n int, empty string) {
+	if n == 0 {
+		a.sendJson(w, http.StatusOK, etherscanResponse{"0", empty, []interface{}{}})
+		return
+	}
+	a.etherscanResult(w, result)
+}
+
+// Account
+
+func (a *ApiServer) etherscanAccount(w http.ResponseWriter, r *http.Request, q url.Values) {
+	switch q.Get("action") {
+	case "balance":
+		address := strings.ToLower(q.Get("address"))
+		if !addressRegex.MatchString(address) {
+			a.etherscanError(w, "Error! Invalid address format")
+			return
+		}
+
+		balance, err := a.rpc.GetBalance(address, etherscanTag(q))
+		if err != nil {
+			a.etherscanError(w, "Error! "+err.Error())
+			return
+		}
+		a.etherscanResult(w, balance)
+
+	case "balancemulti":
+		addresses := strings.Split(strings.ToLower(q.Get("address")), ",")
+		if len(addresses) > etherscanMaxBalances {
+			a.etherscanError(w, "Error! Maximum of 20 addresses per request")
+			return
+		}
+
+		balances := make([]etherscanBalance, 0, len(addresses))
+
+		for _, address := range addresses {
+			if !addressRegex.MatchString(address) {
+				a.etherscanError(w, "Error! Invalid address format")
+				return
+			}
+
+			balance, err := a.rpc.GetBalance(address, etherscanTag(q))
+			if err != nil {
+				a.etherscanError(w, "Error! "+err.Error())
+				return
+			}
+			balances = append(balances, etherscanBalance{address, balance})
+		}
+		a.etherscanResult(w, balances)
+
+	case "txlist":
+		a.etherscanTxList(w, r, q)
+	case "tokentx":
+		a.etherscanTokenTx(w, r, q)
+	default:
+		a.etherscanError(w, "Error! Missing Or invalid Action name")
+	}
+}
+
+// etherscanPaging holds the startblock, endblock, page, offset and sort parameters.
+type etherscanPaging struct {
+	start, end   uint64
+	page, offset int
+	desc         bool
+}
+
+func parseEtherscanPaging(q url.Values) (*etherscanPaging, string) {
+	p := &etherscanPaging{end: math.MaxUint64, page: 1, offset: etherscanMaxRecords}
+
+	var err error
+
+	if v := q.Get("startblock"); v != "" {
+		if p.start, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, "Error! Invalid startblock"
+		}
+	}
+	if v := q.Get("endblock"); v != "" {
+		if p.end, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, "Error! Invalid endblock"
+		}
+	}
+
+	if v := q.Get("page"); v != "" {
+		if p.page, err = strconv.Atoi(v); err != nil || p.page < 1 {
+			return nil, "Error! Invalid page"
+		}
+	}
+	if v := q.Get("offset"); v != "" && v != "0" {
+		if p.offset, err = strconv.Atoi(v); err != nil || p.offset < 1 {
+			return nil, "Error! Invalid offset"
+		}
+	}
+	if p.page*p.offset > etherscanMaxRecords {
+		return nil, "Result window is too large, PageNo x Offset size must be less than or equal to 10000"
+	}
+
+	switch q.Get("sort") {
+	case "", "asc":
+	case "desc":
+		p.desc = true
+	default:
+		return nil, "Error! Invalid sort order"
+	}
+
+	return p, ""
+}
+
+// storagePage returns the page holding everything up to the requested one, starting at the
+// bound on the side the list is read from.
+func (p *etherscanPaging) storagePage() storage.Page {
+	page := storage.Page{Limit: p.page * p.offset, Desc: p.desc}
+
+	if p.desc && p.end < math.MaxUint64 {
+		page.After = &storage.Cursor{Block: p.end + 1}
+	}
+	if !p.desc && p.start > 0 {
+		page.After = &storage.Cursor{Block: p.start - 1, Index: math.MaxUint64}
+	}
+	return page
+}
+
+// window returns the range of the requested page among n items of which the first
+// inRange are within the block range.
+func (p *etherscanPaging) window(n, inRange int) (int, int) {
+	if inRange < n {
+		n = inRange
+	}
+
+	from := (p.page - 1) * p.offset
+	if from > n {
+		from = n
+	}
+	return from, n
+}
+
+func (p *etherscanPaging) contains(block uint64) bool {
+	return block >= p.start && block <= p.end
+}
+
+func (a *ApiServer) etherscanTxList(w http.ResponseWriter, r *http.Request, q url.Values) {
+	address := strings.ToLower(q.Get("address"))
+	if !addressRegex.MatchString(address) {
+		a.etherscanError(w, "Error! Invalid address format")
+		return
+	}
+
+	paging, msg := parseEtherscanPaging(q)
+	if paging == nil {
+		a.etherscanError(w, msg)
+		return
+	}
+
+	txns, _, err := a.backend.LatestTransactionsByAccount(r.Context(), address, paging.storagePage())
+	if err != nil {
+		a.etherscanError(w, "Error! "+err.Error())
+		return
+	}
+
+	head := a.etherscanHead(r)
+
+	inRange := len(txns)
+	for i, v := range txns {
+		if !paging.contains(v.BlockNumber) {
+			inRange = i
+			break
+		}
+	}
+	from, to := paging.window(len(txns), inRange)
+
+	result := make([]etherscanTx, 0, to-from)
+	for _, v := range txns[from:to] {
+		tx := etherscanTx{
+			BlockNumber:      strconv.FormatUint(v.BlockNumber, 10),
+			TimeStamp:        strconv.FormatUint(v.Timestamp, 10),
+			Hash:             v.Hash,
+			Nonce:            strconv.FormatUint(util.DecodeHex(v.Nonce), 10),
+			BlockHash:        v.BlockHash,
+			TransactionIndex: strconv.FormatUint(v.TransactionIndex, 10),
+			From:             v.From,
+			To:               v.To,
+			Value:            v.Value,
+			Gas:              strconv.FormatUint(v.Gas, 10),
+			GasPrice:         strconv.FormatUint(v.GasPrice, 10),
+			Input:            v.Input,
+			ContractAddress:  v.ContractAddress,
+			GasUsed:          strconv.FormatUint(v.GasUsed, 10),
+			Confirmations:    confirmations(head, v.BlockNumber),
+		}
+		tx.IsError, tx.TxReceiptStatus, tx.CumulativeGasUsed = etherscanReceipt(&v)
+		result = append(result, tx)
+	}
+
+	a.etherscanList(w, result, len(result), "No transactions found")
+}
+
+func (a *ApiServer) etherscanTokenTx(w http.ResponseWriter, r *http.Request, q url.Values) {
+	address := strings.ToLower(q.Get("address"))
+	contract := strings.ToLower(q.Get("contractaddress"))
+
+	if address == "" && contract == "" || address != "" && !addressRegex.MatchString(address) || contract != "" && !addressRegex.MatchString(contract) {
+		a.etherscanError(w, "Error! Invalid address format")
+		return
+	}
+
+	paging, msg := parseEtherscanPaging(q)
+	if paging == nil {
+		a.etherscanError(w, msg)
+		return
+	}
+
+	var transfers []models.TokenTransfer
+	var err error
+
+	switch {
+	case address != "" && contract != "":
+		transfers, _, err = a.backend.TokenTransfersByAccount(r.Context(), contract, address, paging.storagePage())
+	case address != "":
+		transfers, _, err = a.backend.LatestTokenTransfersByAccount(r.Context(), address, paging.storagePage())
+	default:
+		transfers, _, err = a.backend.LatestTransfersByToken(r.Context(), contract, paging.storagePage())
+	}
+	if err != nil {
+		a.etherscanError(w, "Error! "+err.Error())
+		return
+	}
+
+	head := a.etherscanHead(r)
+
+	inRange := len(transfers)
+	for i, v := range transfers {
+		if !paging.contains(v.BlockNumber) {
+			inRange = i
+			break
+		}
+	}
+	from, to := paging.window(len(transfers), inRange)
+
+	tokens := a.newTokenSet(r.Context())
+	if err := tokens.load(transfers[from:to]); err != nil {
+		a.etherscanError(w, "Error! "+err.Error())
+		return
+	}
+
+	txns, err := a.backend.TransferTransactions(r.Context(), transfers[from:to])
+	if err != nil {
+		a.etherscanError(w, "Error! "+err.Error())
+		return
+	}
+
+	result := make([]etherscanTokenTx, 0, to-from)
+	for _, v := range transfers[from:to] {
+		tx := etherscanTokenTx{
+			BlockNumber:      strconv.FormatUint(v.BlockNumber, 10),
+			TimeStamp:        strconv.FormatUint(v.Timestamp, 10),
+			Hash:             v.Hash,
+			From:             v.From,
+			ContractAddress:  v.Contract,
+			To:               v.To,
+			Value:            v.Value,
+			TransactionIndex: strconv.FormatUint(v.TransactionIndex, 10),
+			Confirmations:    confirmations(head, v.BlockNumber),
+		}
+		if token := tokens.get(v.Contract); token != nil {
+			tx.TokenName = token.Name
+			tx.TokenSymbol = token.Symbol
+			tx.TokenDecimal = strconv.FormatUint(token.Decimals, 10)
+		}
+		// Transactions pruned with their block body leave these empty
+		if txn, ok := txns[v.Hash]; ok {
+			tx.Nonce = strconv.FormatUint(util.DecodeHex(txn.Nonce), 10)
+			tx.BlockHash = txn.BlockHash
+			tx.Gas = strconv.FormatUint(txn.Gas, 10)
+			tx.GasPrice = strconv.FormatUint(txn.GasPrice, 10)
+			tx.GasUsed = strconv.FormatUint(txn.GasUsed, 10)
+			tx.Input = txn.Input
+			_, _, tx.CumulativeGasUsed = etherscanReceipt(&txn)
+		}
+		result = append(result, tx)
+	}
+
+	a.etherscanList(w, result, len(result), "No transactions found")
+}
+
+// etherscanReceipt returns isError, txreceipt_status and cumulativeGasUsed of txn. Receipt
+// fields weren't stored for transactions indexed before, they're left empty.
+func etherscanReceipt(txn *models.Transaction) (string, string, string) {
+	switch txn.Status {
+	case "0x1":
+		return "0", "1", strconv.FormatUint(txn.CumulativeGasUsed, 10)
+	case "0x0":
+		return "1", "0", strconv.FormatUint(txn.CumulativeGasUsed, 10)
+	}
+	return "0", "", ""
+}
+
+func (a *ApiServer) etherscanHead(r *http.Request) uint64 {
+	block, err := a.backend.LatestBlock(r.Context())
+	if err != nil {
+		return 0
+	}
+	return block.Number
+}
+
+func confirmations(head, block uint64) string {
+	if head < block {
+		return "0"
+	}
+	return strconv.FormatUint(head-block+1, 10)
+}
+
+func etherscanTag(q url.Values) string {
+	if tag := q.Get("tag"); tag != "" {
+		return tag
+	}
+	return "latest"
+}
+
+// Block
+
+func (a *ApiServer) etherscanBlock(w http.ResponseWriter, r *http.Request, q url.Values) {
+	switch q.Get("action") {
+	case "getblockreward":
+		number, err := strconv.ParseUint(q.Get("blockno"), 10, 64)
+		if err != nil {
+			a.etherscanError(w, "Error! Block number is invalid")
+			return
+		}
+
+		block, err := a.backend.BlockByNumber(r.Context(), number)
+		if err != nil {
+			a.etherscanError(w, "Error! Block not found")
+			return
+		}
+
+		uncles, err := a.backend.BlockUncles(r.Context(), number)
+		if err != nil {
+			a.etherscanError(w, "Error! "+err.Error())
+			return
+		}
+
+		// The miner gets the base reward, the inclusion reward for each uncle and the fees
+		base := util.CaculateBlockReward(number, 0)
+		withUncles := util.CaculateBlockReward(number, len(uncles))
+
+		fees, ok := new(big.Int).SetString(block.TxFees, 10)
+		if !ok {
+			fees = big.NewInt(0)
+		}
+
+		result := etherscanBlockReward{
+			BlockNumber:          strconv.FormatUint(block.Number, 10),
+			TimeStamp:            strconv.FormatUint(block.Timestamp, 10),
+			BlockMiner:           block.Miner,
+			BlockReward:          new(big.Int).Add(withUncles, fees).String(),
+			Uncles:               make([]etherscanUncleReward, 0, len(uncles)),
+			UncleInclusionReward: new(big.Int).Sub(withUncles, base).String(),
+		}
+
+		for _, v := range uncles {
+			result.Uncles = append(result.Uncles, etherscanUncleReward{
+				Miner:         v.Miner,
+				UnclePosition: strconv.FormatUint(v.Position, 10),
+				BlockReward:   v.Reward,
+			})
+		}
+
+		a.etherscanResult(w, result)
+
+	case "getblocknobytime":
+		timestamp, err := strconv.ParseUint(q.Get("timestamp"), 10, 64)
+		if err != nil {
+			a.etherscanError(w, "Error! Invalid timestamp")
+			return
+		}
+
+		closest := q.Get("closest")
+		if closest != "before" && closest != "after" {
+			a.etherscanError(w, "Error! Invalid closest parameter, use before or after")
+			return
+		}
+
+		block, err := a.backend.BlockByTimestamp(r.Context(), timestamp, closest == "before")
+		if err != nil {
+			a.etherscanError(w, "Error! No closest block found")
+			return
+		}
+
+		a.etherscanResult(w, strconv.FormatUint(block.Number, 10))
+
+	default:
+		a.etherscanError(w, "Error! Missing Or invalid Action name")
+	}
+}
+
+// Stats
+
+func (a *ApiServer) etherscanStats(w http.ResponseWriter, r *http.Request, q url.Values) {
+	switch q.Get("action") {
+	case "ethsupply":
+		store, err := a.backend.SupplyObject(r.Context(), "ubq")
+		if err != nil {
+			a.etherscanError(w, "Error! "+err.Error())
+			return
+		}
+		a.etherscanResult(w, store.Supply)
+
+	case "tokensupply":
+		contract := strings.ToLower(q.Get("contractaddress"))
+		if !addressRegex.MatchString(contract) {
+			a.etherscanError(w, "Error! Invalid address format")
+			return
+		}
+
+		// totalSupply()
+		raw, err := a.rpc.Call("eth_call", []interface{}{map[string]string{"to": contract, "data": "0x18160ddd"}, "latest"})
+		if err != nil {
+			a.etherscanError(w, "Error! "+err.Error())
+			return
+		}
+
+		var data string
+		if err := json.Unmarshal(raw, &data); err != nil || len(data) < 3 {
+			a.etherscanError(w, "Error! Invalid token contract")
+			return
+		}
+
+		supply, ok := new(big.Int).SetString(data[2:], 16)
+		if !ok {
+			a.etherscanError(w, "Error! Invalid token contract")
+			return
+		}
+		a.etherscanResult(w, supply.String())
+
+	default:
+		a.etherscanError(w, "Error! Missing Or invalid Action name")
+	}
+}
+
+// Proxy
+
+// etherscanProxyParams builds the node parameters of the read only methods the proxy module
+// passes through, from Etherscan's query parameter names.
+var etherscanProxyParams = map[string]func(q url.Values) []interface{}{
+	"eth_blockNumber": func(q url.Values) []interface{} { return []interface{}{} },
+	"eth_gasPrice":    func(q url.Values) []interface{} { return []interface{}{} },
+	"eth_getBlockByNumber": func(q url.Values) []interface{} {
+		return []interface{}{q.Get("tag"), q.Get("boolean") == "true"}
+	},
+	"eth_getUncleByBlockNumberAndIndex": func(q url.Values) []interface{} {
+		return []interface{}{q.Get("tag"), q.Get("index")}
+	},
+	"eth_getBlockTransactionCountByNumber": func(q url.Values) []interface{} {
+		return []interface{}{q.Get("tag")}
+	},
+	"eth_getTransactionByHash": func(q url.Values) []interface{} {
+		return []interface{}{q.Get("txhash")}
+	},
+	"eth_getTransactionByBlockNumberAndIndex": func(q url.Values) []interface{} {
+		return []interface{}{q.Get("tag"), q.Get("index")}
+	},
+	"eth_getTransactionCount": func(q url.Values) []interface{} {
+		return []interface{}{q.Get("address"), etherscanTag(q)}
+	},
+	"eth_getTransactionReceipt": func(q url.Values) []interface{} {
+		return []interface{}{q.Get("txhash")}
+	},
+	"eth_call": func(q url.Values) []interface{} {
+		return []interface{}{map[string]string{"to": q.Get("to"), "data": q.Get("data")}, etherscanTag(q)}
+	},
+	"eth_getCode": func(q url.Values) []interface{} {
+		return []interface{}{q.Get("address"), etherscanTag(q)}
+	},
+	"eth_getStorageAt": func(q url.Values) []interface{} {
+		return []interface{}{q.Get("address"), q.Get("position"), etherscanTag(q)}
+	},
+	"eth_estimateGas": func(q url.Values) []interface{} {
+		call := map[string]string{}
+		for _, k := range []string{"to", "value", "gas", "gasPrice", "data"} {
+			if v := q.Get(k); v != "" {
+				call[k] = v
+			}
+		}
+		return []interface{}{call}
+	},
+}
+
+func (a *ApiServer) etherscanProxy(w http.ResponseWriter, r *http.Request, q url.Values) {
+	params, ok := etherscanProxyParams[q.Get("action")]
+	if !ok {
+		a.etherscanError(w, "Error! Missing Or invalid Action name")
+		return
+	}
+
+	res := rpcResponse{JsonRpc: "2.0", Id: json.RawMessage("1")}
+	if id, err := strconv.Atoi(q.Get("id")); err == nil {
+		res.Id = json.RawMessage(strconv.Itoa(id))
+	}
+
+	// Node calls share the /rpc/proxy limit
+	if ok, _ := a.proxyLimiter.take(clientIP(r, a.cfg.TrustForwarded), 1); !ok {
+		res.Error = &rpcError{rpcLimitExceeded, "rate limit exceeded"}
+		a.sendJson(w, http.StatusOK, res)
+		return
+	}
+
+	result, err := a.rpc.Call(q.Get("action"), params(q))
+	if err != nil {
+		res.Error = &rpcError{rpcServerError, err.Error()}
+	} else {
+		res.Result = result
+	}
+
+	a.sendJson(w, http.StatusOK, res)
+}
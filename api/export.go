@@ -0,0 +1,409 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubiq/spectrum-backend/models"
+	"github.com/ubiq/spectrum-backend/storage"
+	"github.com/ubiq/spectrum-backend/util"
+)
+
+/*
+	/export/address/{addr} and /export/token/{contract} stream a history as CSV or NDJSON
+	while it is read from the database. The row cap is only known to be hit once the body
+	is under way, so it is reported in the X-Export-Truncated and X-Export-Next-Block
+	trailers, and as a last line of NDJSON. A read failing once rows were sent ends NDJSON
+	with an error line and the X-Export-Error trailer, CSV has no way to tell so the
+	response is aborted and clients see an incomplete transfer.
+*/
+
+const (
+	defaultExportRows = 100000
+	exportFlushRows   = 100
+)
+
+var (
+	txnColumns      = []string{"blockNumber", "timestamp", "date", "hash", "from", "to", "direction", "value", "valueUBQ", "gasUsed", "gasPrice", "fee", "feeUBQ", "contractAddress", "status"}
+	transferColumns = []string{"blockNumber", "timestamp", "date", "hash", "contract", "from", "to", "direction", "value", "amount", "method"}
+)
+
+type exportRange struct {
+	from, to uint64
+}
+
+// parseExportRange reads the startblock/endblock and from/to date filters, dates are
+// YYYY-MM-DD in UTC or unix timestamps and are mapped to the blocks mined within them.
+func (a *ApiServer) parseExportRange(r *http.Request) (*exportRange, error) {
+	q := r.URL.Query()
+	rng := &exportRange{0, math.MaxUint64}
+
+	var err error
+
+	if v := q.Get("startblock"); v != "" {
+		if rng.from, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, errors.New("invalid startblock")
+		}
+	}
+	if v := q.Get("endblock"); v != "" {
+		if rng.to, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, errors.New("invalid endblock")
+		}
+	}
+
+	if v := q.Get("from"); v != "" {
+		ts, err := parseExportDate(v, false)
+		if err != nil {
+			return nil, err
+		}
+
+		block, err := a.backend.BlockByTimestamp(r.Context(), ts, false)
+		if err == storage.ErrNotFound {
+			// Nothing was mined since
+			rng.from = math.MaxUint64
+		} else if err != nil {
+			return nil, err
+		} else if block.Number > rng.from {
+			rng.from = block.Number
+		}
+	}
+
+	if v := q.Get("to"); v != "" {
+		ts, err := parseExportDate(v, true)
+		if err != nil {
+			return nil, err
+		}
+
+		block, err := a.backend.BlockByTimestamp(r.Context(), ts, true)
+		if err == storage.ErrNotFound {
+			return &exportRange{1, 0}, nil
+		} else if err != nil {
+			return nil, err
+		} else if block.Number < rng.to {
+			rng.to = block.Number
+		}
+	}
+
+	return rng, nil
+}
+
+// parseExportDate returns the first second of a date, or the last one for the end of a range.
+func parseExportDate(v string, end bool) (uint64, error) {
+	if ts, err := strconv.ParseUint(v, 10, 64); err == nil {
+		return ts, nil
+	}
+
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid date %v, use YYYY-MM-DD or a unix timestamp", v)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return uint64(t.Unix()), nil
+}
+
+// exportWriter writes rows in the requested format.
+type exportWriter struct {
+	w       http.ResponseWriter
+	csv     *csv.Writer
+	columns []string
+	rows    int
+	// Set once the response is under way
+	flushed bool
+}
+
+func newExportWriter(w http.ResponseWriter, format, name string, columns []string) (*exportWriter, error) {
+	e := &exportWriter{w: w, columns: columns}
+
+	w.Header().Set("Trailer", "X-Export-Truncated, X-Export-Next-Block, X-Export-Error")
+
+	switch format {
+	case "", "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+		e.csv = csv.NewWriter(w)
+		e.csv.Write(columns)
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".ndjson"))
+	default:
+		return nil, errors.New("format must be csv or ndjson")
+	}
+	return e, nil
+}
+
+func (e *exportWriter) write(values []string) error {
+	e.rows++
+
+	if e.csv != nil {
+		e.csv.Write(values)
+	} else {
+		row := make(map[string]string, len(values))
+		for i, v := range values {
+			row[e.columns[i]] = v
+		}
+		line, _ := json.Marshal(row)
+		if _, err := e.w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+
+	if e.rows%exportFlushRows == 0 {
+		e.flush()
+	}
+
+	if e.csv != nil {
+		return e.csv.Error()
+	}
+	return nil
+}
+
+func (e *exportWriter) flush() {
+	if e.csv != nil {
+		e.csv.Flush()
+	}
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	e.flushed = true
+}
+
+// failed ends an export the history read failed in.
+func (e *exportWriter) failed() {
+	if e.csv != nil {
+		e.csv.Flush()
+		panic(http.ErrAbortHandler)
+	}
+
+	line, _ := json.Marshal(&ErrorRes{Error: "export failed", Code: errorCode(http.StatusInternalServerError), RequestId: e.w.Header().Get(requestIdHeader)})
+	e.w.Write(append(line, '\n'))
+	e.flush()
+
+	e.w.Header().Set("X-Export-Error", "true")
+}
+
+// truncated reports that the export stopped at the row cap, next is the block to resume from.
+func (e *exportWriter) truncated(next uint64) {
+	if e.csv == nil {
+		line, _ := json.Marshal(map[string]interface{}{"truncated": true, "nextBlock": next})
+		e.w.Write(append(line, '\n'))
+	}
+	e.flush()
+
+	e.w.Header().Set("X-Export-Truncated", "true")
+	e.w.Header().Set("X-Export-Next-Block", strconv.FormatUint(next, 10))
+}
+
+func (a *ApiServer) exportRows() int {
+	if a.cfg.Export.MaxRows > 0 {
+		return a.cfg.Export.MaxRows
+	}
+	return defaultExportRows
+}
+
+func (a *ApiServer) getExportAddress(w http.ResponseWriter, r *http.Request) {
+	address := strings.ToLower(mux.Vars(r)["addr"])
+	if !addressRegex.MatchString(address) {
+		a.sendError(w, http.StatusBadRequest, "invalid address")
+		return
+	}
+
+	kind := models.KIND_TX
+	columns := txnColumns
+
+	switch r.URL.Query().Get("type") {
+	case "", "tx":
+	case "token":
+		kind = models.KIND_TRANSFER
+		columns = transferColumns
+	default:
+		a.sendError(w, http.StatusBadRequest, "type must be tx or token")
+		return
+	}
+
+	rng, err := a.parseExportRange(r)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	out, err := newExportWriter(w, r.URL.Query().Get("format"), address+"-"+kind, columns)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	iter := a.backend.AccountHistory(r.Context(), address, kind, rng.from, rng.to)
+	a.export(r.Context(), iter, out, address, kind)
+}
+
+func (a *ApiServer) getExportToken(w http.ResponseWriter, r *http.Request) {
+	contract := strings.ToLower(mux.Vars(r)["contract"])
+	if !addressRegex.MatchString(contract) {
+		a.sendError(w, http.StatusBadRequest, "invalid contract address")
+		return
+	}
+
+	rng, err := a.parseExportRange(r)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	out, err := newExportWriter(w, r.URL.Query().Get("format"), contract+"-transfers", transferColumns)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	iter := a.backend.TokenHistory(r.Context(), contract, rng.from, rng.to)
+	a.export(r.Context(), iter, out, "", models.KIND_TRANSFER)
+}
+
+// export writes the rows of iter up to the cap, direction is relative to address when set.
+func (a *ApiServer) export(ctx context.Context, iter *storage.HistoryIter, out *exportWriter, address, kind string) {
+	// Read errors are answered below, the iterator keeps returning them
+	defer iter.Close()
+
+	limit := a.exportRows()
+	tokens := a.newTokenSet(ctx)
+
+	for {
+		var values []string
+		var block uint64
+
+		if kind == models.KIND_TX {
+			var txn models.Transaction
+			if !iter.Next(&txn) {
+				break
+			}
+			block = txn.BlockNumber
+			values = txnRow(&txn, address)
+		} else {
+			var transfer models.TokenTransfer
+			if !iter.Next(&transfer) {
+				break
+			}
+			block = transfer.BlockNumber
+			tokens.format(&transfer)
+			values = transferRow(&transfer, address)
+		}
+
+		// The first row past the cap tells where to resume, a block can hold more rows so
+		// resuming repeats the rows of that block that were written
+		if out.rows == limit {
+			out.truncated(block)
+			return
+		}
+
+		if err := out.write(values); err != nil {
+			// The client went away
+			return
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		if !out.flushed {
+			// Nothing was sent yet, answer with the error instead
+			for _, h := range []string{"Trailer", "Content-Disposition"} {
+				out.w.Header().Del(h)
+			}
+			a.sendStorageError(out.w, err)
+			return
+		}
+		log.Errorf("Request %v: error exporting history: %v", out.w.Header().Get(requestIdHeader), err)
+		out.failed()
+		return
+	}
+
+	out.flush()
+}
+
+func direction(from, to, address string) string {
+	switch {
+	case address == "":
+		return ""
+	case from == address && to == address:
+		return "self"
+	case from == address:
+		return "out"
+	}
+	return "in"
+}
+
+func exportDate(ts uint64) string {
+	return time.Unix(int64(ts), 0).UTC().Format(time.RFC3339)
+}
+
+func txnRow(txn *models.Transaction, address string) []string {
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(txn.GasUsed), new(big.Int).SetUint64(txn.GasPrice)).String()
+
+	return []string{
+		strconv.FormatUint(txn.BlockNumber, 10),
+		strconv.FormatUint(txn.Timestamp, 10),
+		exportDate(txn.Timestamp),
+		txn.Hash,
+		txn.From,
+		txn.To,
+		direction(txn.From, txn.To, address),
+		txn.Value,
+		util.FromWei(txn.Value),
+		strconv.FormatUint(txn.GasUsed, 10),
+		strconv.FormatUint(txn.GasPrice, 10),
+		fee,
+		util.FromWei(fee),
+		txn.ContractAddress,
+		txnStatus(txn),
+	}
+}
+
+// txnStatus is empty for transactions indexed before receipt statuses were stored.
+func txnStatus(txn *models.Transaction) string {
+	switch {
+	case txn.Status == "0x1":
+		return "success"
+	case txn.Status == "0x0":
+		return "failed"
+	case txn.Pruned && txn.From == "":
+		// Stub of a transaction pruned with its block body
+		return "pruned"
+	}
+	return ""
+}
+
+func transferRow(t *models.TokenTransfer, address string) []string {
+	return []string{
+		strconv.FormatUint(t.BlockNumber, 10),
+		strconv.FormatUint(t.Timestamp, 10),
+		exportDate(t.Timestamp),
+		t.Hash,
+		t.Contract,
+		t.From,
+		t.To,
+		direction(t.From, t.To, address),
+		t.Value,
+		amount(t),
+		t.Method,
+	}
+}
+
+// amount is the value in token units, tokens missing from the registry are assumed to have 18
+// decimals.
+func amount(t *models.TokenTransfer) string {
+	if t.FormattedValue != "" {
+		return t.FormattedValue
+	}
+	return util.FromWei(t.Value)
+}
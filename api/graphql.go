@@ -0,0 +1,419 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ubiq/spectrum-backend/graphql"
+	"github.com/ubiq/spectrum-backend/models"
+	"github.com/ubiq/spectrum-backend/storage"
+)
+
+/*
+	GraphQL schema over the storage getters, so a page can fetch a block with its
+	transactions and their transfers, or an account with its history, in one request. Lists
+	take the same limit, order and cursor arguments as the REST endpoints.
+*/
+
+const (
+	defaultGraphQLDepth      = 10
+	defaultGraphQLComplexity = 5000
+)
+
+var pageArgs = []string{"limit", "order", "cursor"}
+
+// graphPage is a page of a list with the cursors of the pages around it.
+type graphPage struct {
+	Items interface{} `json:"items"`
+	Next  string      `json:"next"`
+	Prev  string      `json:"prev"`
+}
+
+type graphAccount struct {
+	Address string `json:"address"`
+}
+
+func graphPager(args graphql.Args) (*pager, error) {
+	limit, err := args.Int("limit", defaultPageSize)
+	if err != nil {
+		return nil, err
+	}
+	return newPager(limit, args.String("order"), args.String("cursor"))
+}
+
+// pageSize is the number of items a page can hold, for the query complexity.
+func pageSize(args graphql.Args) int {
+	limit, err := args.Int("limit", defaultPageSize)
+	if err != nil || limit <= 0 || limit > maxPageSize {
+		return maxPageSize
+	}
+	return limit
+}
+
+// found turns a missing document into a null.
+func found(v interface{}, err error) (interface{}, error) {
+	if err == storage.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (a *ApiServer) graphSchema() *graphql.Schema {
+	var (
+		block         = &graphql.Object{Name: "Block"}
+		transaction   = &graphql.Object{Name: "Transaction"}
+		txLog         = &graphql.Object{Name: "Log"}
+		uncle         = &graphql.Object{Name: "Uncle"}
+		tokenTransfer = &graphql.Object{Name: "TokenTransfer"}
+		account       = &graphql.Object{Name: "Account"}
+		chart         = &graphql.Object{Name: "Chart"}
+		store         = &graphql.Object{Name: "Store"}
+		query         = &graphql.Object{Name: "Query"}
+	)
+
+	page := func(name string, of *graphql.Object) *graphql.Object {
+		return &graphql.Object{Name: name, Fields: map[string]*graphql.FieldDef{
+			"items": {Type: graphql.List{Of: of}},
+			"next":  {Type: graphql.String},
+			"prev":  {Type: graphql.String},
+		}}
+	}
+
+	blockPage := page("BlockPage", block)
+	transactionPage := page("TransactionPage", transaction)
+	unclePage := page("UnclePage", uncle)
+	tokenTransferPage := page("TokenTransferPage", tokenTransfer)
+
+	blockByNumber := func(p graphql.Params, number uint64) (interface{}, error) {
+		return found(a.backend.BlockByNumber(p.Context, number))
+	}
+
+	block.Fields = map[string]*graphql.FieldDef{
+		"number":          {Type: graphql.Int},
+		"timestamp":       {Type: graphql.Int},
+		"hash":            {Type: graphql.String},
+		"parentHash":      {Type: graphql.String},
+		"sha3Uncles":      {Type: graphql.String},
+		"miner":           {Type: graphql.String},
+		"difficulty":      {Type: graphql.String},
+		"totalDifficulty": {Type: graphql.String},
+		"size":            {Type: graphql.Int},
+		"gasUsed":         {Type: graphql.Int},
+		"gasLimit":        {Type: graphql.Int},
+		"nonce":           {Type: graphql.String},
+		"blockReward":     {Type: graphql.String},
+		"unclesReward":    {Type: graphql.String},
+		"avgGasPrice":     {Type: graphql.String},
+		"txFees":          {Type: graphql.String},
+		"extraData":       {Type: graphql.String},
+		"pruned":          {Type: graphql.Boolean},
+		"transactionCount": {Type: graphql.Int, Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(models.Block).Txs, nil
+		}},
+		"uncleCount": {Type: graphql.Int, Resolve: func(p graphql.Params) (interface{}, error) {
+			return p.Source.(models.Block).UncleNo, nil
+		}},
+		"transactions": {Type: transactionPage, Args: pageArgs, Size: pageSize, Resolve: func(p graphql.Params) (interface{}, error) {
+			page, err := graphPager(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			txns, more, err := a.backend.BlockTransactions(p.Context, p.Source.(models.Block).Number, page.Page)
+			if err != nil {
+				return nil, err
+			}
+			res := graphPage{Items: txns}
+			res.Next, res.Prev = page.links(&txns, more)
+			return res, nil
+		}},
+		"uncles": {Type: graphql.List{Of: uncle}, Resolve: func(p graphql.Params) (interface{}, error) {
+			return a.backend.BlockUncles(p.Context, p.Source.(models.Block).Number)
+		}},
+	}
+
+	transaction.Fields = map[string]*graphql.FieldDef{
+		"blockHash":        {Type: graphql.String},
+		"blockNumber":      {Type: graphql.Int},
+		"hash":             {Type: graphql.String},
+		"timestamp":        {Type: graphql.Int},
+		"input":            {Type: graphql.String},
+		"value":            {Type: graphql.String},
+		"gas":              {Type: graphql.Int},
+		"gasPrice":         {Type: graphql.Int},
+		"nonce":            {Type: graphql.String},
+		"transactionIndex": {Type: graphql.Int},
+		"from":             {Type: graphql.String},
+		"to":               {Type: graphql.String},
+		"gasUsed":          {Type: graphql.Int},
+		"contractAddress":  {Type: graphql.String},
+		"pruned":           {Type: graphql.Boolean},
+		"logs":             {Type: graphql.List{Of: txLog}},
+		"block": {Type: block, Resolve: func(p graphql.Params) (interface{}, error) {
+			return blockByNumber(p, p.Source.(models.Transaction).BlockNumber)
+		}},
+		"transfers": {Type: graphql.List{Of: tokenTransfer}, Resolve: func(p graphql.Params) (interface{}, error) {
+			txn := p.Source.(models.Transaction)
+			return a.backend.TransactionTokenTransfers(p.Context, txn.Hash, txn.BlockNumber)
+		}},
+	}
+
+	txLog.Fields = map[string]*graphql.FieldDef{
+		"address":          {Type: graphql.String},
+		"topics":           {Type: graphql.List{Of: graphql.String}},
+		"data":             {Type: graphql.String},
+		"blockNumber":      {Type: graphql.String},
+		"transactionIndex": {Type: graphql.String},
+		"transactionHash":  {Type: graphql.String},
+		"blockHash":        {Type: graphql.String},
+		"logIndex":         {Type: graphql.String},
+		"removed":          {Type: graphql.Boolean},
+	}
+
+	uncle.Fields = map[string]*graphql.FieldDef{
+		"number":      {Type: graphql.Int},
+		"position":    {Type: graphql.Int},
+		"blockNumber": {Type: graphql.Int},
+		"hash":        {Type: graphql.String},
+		"parentHash":  {Type: graphql.String},
+		"sha3Uncles":  {Type: graphql.String},
+		"miner":       {Type: graphql.String},
+		"difficulty":  {Type: graphql.String},
+		"gasUsed":     {Type: graphql.Int},
+		"gasLimit":    {Type: graphql.Int},
+		"timestamp":   {Type: graphql.Int},
+		"reward":      {Type: graphql.String},
+		"block": {Type: block, Resolve: func(p graphql.Params) (interface{}, error) {
+			return blockByNumber(p, p.Source.(models.Uncle).BlockNumber)
+		}},
+	}
+
+	tokenTransfer.Fields = map[string]*graphql.FieldDef{
+		"blockNumber":      {Type: graphql.Int},
+		"transactionIndex": {Type: graphql.Int},
+		"hash":             {Type: graphql.String},
+		"timestamp":        {Type: graphql.Int},
+		"from":             {Type: graphql.String},
+		"to":               {Type: graphql.String},
+		"value":            {Type: graphql.String},
+		"contract":         {Type: graphql.String},
+		"method":           {Type: graphql.String},
+		"pruned":           {Type: graphql.Boolean},
+		"transaction": {Type: transaction, Resolve: func(p graphql.Params) (interface{}, error) {
+			return found(a.backend.TransactionByHash(p.Context, p.Source.(models.TokenTransfer).Hash))
+		}},
+	}
+
+	account.Fields = map[string]*graphql.FieldDef{
+		"address": {Type: graphql.String},
+		"balance": {Type: graphql.String, Resolve: func(p graphql.Params) (interface{}, error) {
+			return a.rpc.GetBalance(p.Source.(graphAccount).Address, "latest")
+		}},
+		"transactionCount": {Type: graphql.Int, Resolve: func(p graphql.Params) (interface{}, error) {
+			return a.backend.TxnCount(p.Context, p.Source.(graphAccount).Address)
+		}},
+		"tokenTransferCount": {Type: graphql.Int, Resolve: func(p graphql.Params) (interface{}, error) {
+			return a.backend.TokenTransferCount(p.Context, p.Source.(graphAccount).Address)
+		}},
+		"transactions": {Type: transactionPage, Args: pageArgs, Size: pageSize, Resolve: func(p graphql.Params) (interface{}, error) {
+			page, err := graphPager(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			txns, more, err := a.backend.LatestTransactionsByAccount(p.Context, p.Source.(graphAccount).Address, page.Page)
+			if err != nil {
+				return nil, err
+			}
+			res := graphPage{Items: txns}
+			res.Next, res.Prev = page.links(&txns, more)
+			return res, nil
+		}},
+		"tokenTransfers": {Type: tokenTransferPage, Args: append([]string{"contract"}, pageArgs...), Size: pageSize, Resolve: func(p graphql.Params) (interface{}, error) {
+			page, err := graphPager(p.Args)
+			if err != nil {
+				return nil, err
+			}
+
+			address := p.Source.(graphAccount).Address
+
+			var transfers []models.TokenTransfer
+			var more bool
+
+			if contract := strings.ToLower(p.Args.String("contract")); contract != "" {
+				transfers, more, err = a.backend.TokenTransfersByAccount(p.Context, contract, address, page.Page)
+			} else {
+				transfers, more, err = a.backend.LatestTokenTransfersByAccount(p.Context, address, page.Page)
+			}
+			if err != nil {
+				return nil, err
+			}
+			res := graphPage{Items: transfers}
+			res.Next, res.Prev = page.links(&transfers, more)
+			return res, nil
+		}},
+	}
+
+	chart.Fields = map[string]*graphql.FieldDef{
+		"chart":  {Type: graphql.String},
+		"labels": {Type: graphql.List{Of: graphql.String}},
+		"values": {Type: graphql.List{Of: graphql.String}},
+	}
+
+	store.Fields = map[string]*graphql.FieldDef{
+		"timestamp":   {Type: graphql.Int},
+		"symbol":      {Type: graphql.String},
+		"supply":      {Type: graphql.String},
+		"price":       {Type: graphql.String},
+		"latestBlock": {Type: block},
+	}
+
+	query.Fields = map[string]*graphql.FieldDef{
+		"block": {Type: block, Args: []string{"number", "hash"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			if hash := p.Args.String("hash"); hash != "" {
+				return found(a.backend.BlockByHash(p.Context, strings.ToLower(hash)))
+			}
+			if !p.Args.Has("number") {
+				return nil, errors.New("block needs a number or a hash")
+			}
+			number, err := p.Args.Int("number", 0)
+			if err != nil || number < 0 {
+				return nil, errors.New("invalid block number")
+			}
+			return blockByNumber(p, uint64(number))
+		}},
+		"latestBlock": {Type: block, Resolve: func(p graphql.Params) (interface{}, error) {
+			return found(a.backend.LatestBlock(p.Context))
+		}},
+		"blocks": {Type: blockPage, Args: pageArgs, Size: pageSize, Resolve: func(p graphql.Params) (interface{}, error) {
+			page, err := graphPager(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			blocks, more, err := a.backend.LatestBlocks(p.Context, page.Page)
+			if err != nil {
+				return nil, err
+			}
+			res := graphPage{Items: blocks}
+			res.Next, res.Prev = page.links(&blocks, more)
+			return res, nil
+		}},
+		"transaction": {Type: transaction, Args: []string{"hash"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			return found(a.backend.TransactionByHash(p.Context, strings.ToLower(p.Args.String("hash"))))
+		}},
+		"transactions": {Type: transactionPage, Args: pageArgs, Size: pageSize, Resolve: func(p graphql.Params) (interface{}, error) {
+			page, err := graphPager(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			txns, more, err := a.backend.LatestTransactions(p.Context, page.Page)
+			if err != nil {
+				return nil, err
+			}
+			res := graphPage{Items: txns}
+			res.Next, res.Prev = page.links(&txns, more)
+			return res, nil
+		}},
+		"uncle": {Type: uncle, Args: []string{"hash"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			return found(a.backend.UncleByHash(p.Context, strings.ToLower(p.Args.String("hash"))))
+		}},
+		"uncles": {Type: unclePage, Args: pageArgs, Size: pageSize, Resolve: func(p graphql.Params) (interface{}, error) {
+			page, err := graphPager(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			uncles, more, err := a.backend.LatestUncles(p.Context, page.Page)
+			if err != nil {
+				return nil, err
+			}
+			res := graphPage{Items: uncles}
+			res.Next, res.Prev = page.links(&uncles, more)
+			return res, nil
+		}},
+		"tokenTransfers": {Type: tokenTransferPage, Args: append([]string{"contract"}, pageArgs...), Size: pageSize, Resolve: func(p graphql.Params) (interface{}, error) {
+			page, err := graphPager(p.Args)
+			if err != nil {
+				return nil, err
+			}
+
+			var transfers []models.TokenTransfer
+			var more bool
+
+			if contract := strings.ToLower(p.Args.String("contract")); contract != "" {
+				transfers, more, err = a.backend.LatestTransfersByToken(p.Context, contract, page.Page)
+			} else {
+				transfers, more, err = a.backend.LatestTokenTransfers(p.Context, page.Page)
+			}
+			if err != nil {
+				return nil, err
+			}
+			res := graphPage{Items: transfers}
+			res.Next, res.Prev = page.links(&transfers, more)
+			return res, nil
+		}},
+		"account": {Type: account, Args: []string{"address"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			address := strings.ToLower(p.Args.String("address"))
+			if !addressRegex.MatchString(address) {
+				return nil, errors.New("invalid address")
+			}
+			return graphAccount{address}, nil
+		}},
+		"chart": {Type: chart, Args: []string{"name", "limit", "miner"}, Resolve: func(p graphql.Params) (interface{}, error) {
+			limit, err := p.Args.Int("limit", 1<<30)
+			if err != nil {
+				return nil, err
+			}
+
+			// Mined blocks are kept per miner
+			if name := p.Args.String("name"); name == "minedblocks" {
+				return found(a.backend.ChartDataML(p.Context, name, int64(limit), strings.ToLower(p.Args.String("miner"))))
+			}
+			return found(a.backend.ChartData(p.Context, p.Args.String("name"), int64(limit)))
+		}},
+		"store": {Type: store, Resolve: func(p graphql.Params) (interface{}, error) {
+			return found(a.backend.Store(p.Context))
+		}},
+	}
+
+	schema := &graphql.Schema{
+		Query:         query,
+		MaxDepth:      a.cfg.GraphQL.MaxDepth,
+		MaxComplexity: a.cfg.GraphQL.MaxComplexity,
+	}
+	if schema.MaxDepth == 0 {
+		schema.MaxDepth = defaultGraphQLDepth
+	}
+	if schema.MaxComplexity == 0 {
+		schema.MaxComplexity = defaultGraphQLComplexity
+	}
+	return schema
+}
+
+func (a *ApiServer) graphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				a.sendJson(w, http.StatusBadRequest, graphql.Response{Errors: []*graphql.Error{{Message: "invalid variables"}}})
+				return
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRpcBody)).Decode(&req); err != nil {
+		a.sendJson(w, http.StatusBadRequest, graphql.Response{Errors: []*graphql.Error{{Message: "invalid request body"}}})
+		return
+	}
+
+	res := a.graph.Execute(r.Context(), req)
+	if res.Data == nil {
+		a.sendJson(w, http.StatusBadRequest, res)
+		return
+	}
+	a.sendJson(w, http.StatusOK, res)
+}
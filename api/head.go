@@ -0,0 +1,40 @@
+package api
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const headInterval = 5 * time.Second
+
+// headWatcher follows the latest indexed block, responses use it to tell how deep their
+// data is and the result cache is dropped when it moves.
+type headWatcher struct {
+	number uint64
+}
+
+func (h *headWatcher) get() uint64 {
+	return atomic.LoadUint64(&h.number)
+}
+
+// final reports whether block is at least depth blocks below the head.
+func (h *headWatcher) final(block, depth uint64) bool {
+	head := h.get()
+	return head >= depth && block <= head-depth
+}
+
+func (a *ApiServer) watchHead() {
+	for {
+		block, err := a.backend.LatestBlock(context.Background())
+		if err != nil {
+			log.Errorf("Could not get the head block: %v", err)
+		} else if block.Number != a.head.get() {
+			atomic.StoreUint64(&a.head.number, block.Number)
+			a.results.purge()
+		}
+		time.Sleep(headInterval)
+	}
+}
@@ -0,0 +1,661 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ubiq/spectrum-backend/models"
+	"github.com/ubiq/spectrum-backend/storage"
+	"github.com/ubiq/spectrum-backend/util"
+)
+
+/*
+	JSON-RPC 2.0 endpoint answering the block, transaction, receipt and log lookups from the
+	index, in the node's encoding. Data the index doesn't hold, pruned or indexed before the
+	fields were stored, and the read only methods it doesn't serve are forwarded to the node
+	when passthrough is enabled. Forwarded calls take from the /rpc/proxy rate limit.
+*/
+
+const (
+	maxRpcBody       = 1 << 20
+	maxRpcBatch      = 100
+	maxLogsRange     = 10000
+	maxLogsResults   = 10000
+	rpcInvalidReq    = -32600
+	rpcNoMethod      = -32601
+	rpcInvalidParam  = -32602
+	rpcInternal      = -32603
+	rpcParseError    = -32700
+	rpcServerError   = -32000
+	rpcLimitExceeded = -32005
+)
+
+var errNotIndexed = errors.New("not available in the index")
+
+type rpcRequest struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+type rpcMethod func(a *ApiServer, ctx context.Context, params []json.RawMessage) (interface{}, error)
+
+var rpcMethods = map[string]rpcMethod{
+	"eth_getBlockByNumber":      (*ApiServer).rpcBlockByNumber,
+	"eth_getBlockByHash":        (*ApiServer).rpcBlockByHash,
+	"eth_getTransactionByHash":  (*ApiServer).rpcTransactionByHash,
+	"eth_getTransactionReceipt": (*ApiServer).rpcTransactionReceipt,
+	"eth_getLogs":               (*ApiServer).rpcLogs,
+}
+
+func (a *ApiServer) postJsonRpc(w http.ResponseWriter, r *http.Request) {
+	reqs, batch, failure := readJsonRpc(w, r)
+	if failure != nil {
+		a.sendJson(w, http.StatusOK, failure)
+		return
+	}
+
+	ip := clientIP(r, a.cfg.TrustForwarded)
+
+	responses := make([]*rpcResponse, 0, len(reqs))
+	for _, req := range reqs {
+		responses = append(responses, a.rpcCall(r.Context(), req, ip))
+	}
+
+	if !batch {
+		a.sendJson(w, http.StatusOK, responses[0])
+		return
+	}
+	a.sendJson(w, http.StatusOK, responses)
+}
+
+// readJsonRpc decodes a single request or a batch. Batch entries that aren't requests are
+// returned empty so they are answered as invalid, a body that can't be read at all is
+// answered with the failure response.
+func readJsonRpc(w http.ResponseWriter, r *http.Request) ([]*rpcRequest, bool, *rpcResponse) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRpcBody))
+	if err != nil {
+		return nil, false, rpcFailure(nil, rpcParseError, err.Error())
+	}
+
+	body = bytes.TrimSpace(body)
+
+	if len(body) == 0 || body[0] != '[' {
+		var req rpcRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, false, rpcFailure(nil, rpcParseError, "parse error")
+		}
+		return []*rpcRequest{&req}, false, nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, true, rpcFailure(nil, rpcParseError, "parse error")
+	}
+	if len(batch) == 0 {
+		return nil, true, rpcFailure(nil, rpcInvalidReq, "empty batch")
+	}
+	if len(batch) > maxRpcBatch {
+		return nil, true, rpcFailure(nil, rpcInvalidReq, "batch too large")
+	}
+
+	reqs := make([]*rpcRequest, len(batch))
+	for i, raw := range batch {
+		reqs[i] = &rpcRequest{}
+		if err := json.Unmarshal(raw, reqs[i]); err != nil {
+			reqs[i] = &rpcRequest{}
+		}
+	}
+	return reqs, true, nil
+}
+
+func (a *ApiServer) rpcCall(ctx context.Context, req *rpcRequest, ip string) *rpcResponse {
+	if req.JsonRpc != "2.0" || req.Method == "" {
+		return rpcFailure(req.Id, rpcInvalidReq, "invalid request")
+	}
+
+	var params []json.RawMessage
+	if len(req.Params) > 0 && string(req.Params) != "null" {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return rpcFailure(req.Id, rpcInvalidParam, "params must be an array")
+		}
+	}
+
+	method, ok := rpcMethods[req.Method]
+	if !ok {
+		if a.cfg.JsonRpc.Passthrough && readOnly[req.Method] {
+			return a.rpcPassthrough(req, params, ip)
+		}
+		return rpcFailure(req.Id, rpcNoMethod, "the method "+req.Method+" does not exist/is not available")
+	}
+
+	result, err := method(a, ctx, params)
+
+	switch e := err.(type) {
+	case nil:
+	case *rpcError:
+		return rpcFailure(req.Id, e.Code, e.Message)
+	default:
+		if err == errNotIndexed && a.cfg.JsonRpc.Passthrough {
+			return a.rpcPassthrough(req, params, ip)
+		}
+		if err != errNotIndexed {
+			log.Errorf("Error serving %v: %v", req.Method, err)
+		}
+		return rpcFailure(req.Id, rpcServerError, err.Error())
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return rpcFailure(req.Id, rpcInternal, err.Error())
+	}
+	return &rpcResponse{JsonRpc: "2.0", Id: rpcId(req.Id), Result: data}
+}
+
+// rpcPassthrough forwards a call to the node once the client has a proxy token left.
+func (a *ApiServer) rpcPassthrough(req *rpcRequest, params []json.RawMessage, ip string) *rpcResponse {
+	if ok, _ := a.proxyLimiter.take(ip, 1); !ok {
+		return rpcFailure(req.Id, rpcLimitExceeded, "rate limit exceeded")
+	}
+	return a.rpcForward(req.Id, req.Method, params)
+}
+
+func (a *ApiServer) rpcForward(id json.RawMessage, method string, params []json.RawMessage) *rpcResponse {
+	if params == nil {
+		params = []json.RawMessage{}
+	}
+
+	result, err := a.rpc.Call(method, params)
+	if err != nil {
+		return rpcFailure(id, rpcServerError, err.Error())
+	}
+	return &rpcResponse{JsonRpc: "2.0", Id: rpcId(id), Result: result}
+}
+
+func rpcFailure(id json.RawMessage, code int, msg string) *rpcResponse {
+	return &rpcResponse{JsonRpc: "2.0", Id: rpcId(id), Error: &rpcError{code, msg}}
+}
+
+func rpcId(id json.RawMessage) json.RawMessage {
+	if len(id) == 0 {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+func invalidParams(msg string) error {
+	return &rpcError{rpcInvalidParam, msg}
+}
+
+// Params
+
+func stringParam(params []json.RawMessage, i int) (string, error) {
+	var s string
+	if i >= len(params) {
+		return "", invalidParams("missing value for required argument " + strconv.Itoa(i))
+	}
+	if err := json.Unmarshal(params[i], &s); err != nil {
+		return "", invalidParams("invalid argument " + strconv.Itoa(i) + ": " + err.Error())
+	}
+	return s, nil
+}
+
+func boolParam(params []json.RawMessage, i int) (bool, error) {
+	var b bool
+	if i >= len(params) {
+		return false, nil
+	}
+	if err := json.Unmarshal(params[i], &b); err != nil {
+		return false, invalidParams("invalid argument " + strconv.Itoa(i) + ": " + err.Error())
+	}
+	return b, nil
+}
+
+// blockNumber resolves a block tag or hex number, pending blocks aren't indexed so
+// "pending" is the latest one.
+func (a *ApiServer) blockNumber(ctx context.Context, tag string) (uint64, error) {
+	switch tag {
+	case "", "latest", "pending":
+		block, err := a.backend.LatestBlock(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return block.Number, nil
+	case "earliest":
+		return 0, nil
+	}
+
+	n, err := util.DecodeUint64(tag)
+	if err != nil {
+		return 0, invalidParams("invalid block number " + tag + ": " + err.Error())
+	}
+	return n, nil
+}
+
+// Methods
+
+func (a *ApiServer) rpcBlockByNumber(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	tag, err := stringParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	full, err := boolParam(params, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	number, err := a.blockNumber(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := a.backend.BlockByNumber(ctx, number)
+	if err == storage.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a.rpcBlock(ctx, &block, full)
+}
+
+func (a *ApiServer) rpcBlockByHash(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	hash, err := stringParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	full, err := boolParam(params, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := a.backend.BlockByHash(ctx, strings.ToLower(hash))
+	if err == storage.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a.rpcBlock(ctx, &block, full)
+}
+
+func (a *ApiServer) rpcTransactionByHash(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	hash, err := stringParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	txn, err := a.backend.TransactionByHash(ctx, strings.ToLower(hash))
+	if err == storage.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rpcTransaction(&txn)
+}
+
+func (a *ApiServer) rpcTransactionReceipt(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	hash, err := stringParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	txn, err := a.backend.TransactionByHash(ctx, strings.ToLower(hash))
+	if err == storage.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rpcReceipt(&txn)
+}
+
+type logFilter struct {
+	FromBlock string            `json:"fromBlock"`
+	ToBlock   string            `json:"toBlock"`
+	BlockHash string            `json:"blockHash"`
+	Address   json.RawMessage   `json:"address"`
+	Topics    []json.RawMessage `json:"topics"`
+}
+
+func (a *ApiServer) rpcLogs(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var filter logFilter
+
+	if len(params) == 0 {
+		return nil, invalidParams("missing value for required argument 0")
+	}
+	if err := json.Unmarshal(params[0], &filter); err != nil {
+		return nil, invalidParams("invalid argument 0: " + err.Error())
+	}
+
+	addresses, err := stringOrList(filter.Address)
+	if err != nil {
+		return nil, invalidParams("invalid address: " + err.Error())
+	}
+
+	topics := make([][]string, len(filter.Topics))
+	for i, raw := range filter.Topics {
+		if topics[i], err = stringOrList(raw); err != nil {
+			return nil, invalidParams("invalid topic: " + err.Error())
+		}
+	}
+
+	var from, to uint64
+
+	if filter.BlockHash != "" {
+		if filter.FromBlock != "" || filter.ToBlock != "" {
+			return nil, invalidParams("cannot specify both BlockHash and FromBlock/ToBlock, choose one or the other")
+		}
+
+		block, err := a.backend.BlockByHash(ctx, strings.ToLower(filter.BlockHash))
+		if err == storage.ErrNotFound {
+			return nil, &rpcError{rpcServerError, "unknown block"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		from, to = block.Number, block.Number
+	} else {
+		if from, err = a.blockNumber(ctx, filter.FromBlock); err != nil {
+			return nil, err
+		}
+		if to, err = a.blockNumber(ctx, filter.ToBlock); err != nil {
+			return nil, err
+		}
+	}
+
+	if from > to {
+		return []models.TxLog{}, nil
+	}
+	if to-from >= maxLogsRange {
+		return nil, &rpcError{rpcServerError, "block range is limited to 10000 blocks"}
+	}
+
+	txns, err := a.backend.LogTransactions(ctx, from, to, addresses, maxLogsResults+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(txns) > maxLogsResults {
+		return nil, &rpcError{rpcServerError, "query returned more than 10000 results"}
+	}
+
+	logs := make([]models.TxLog, 0)
+
+	for _, txn := range txns {
+		if txn.Pruned {
+			return nil, errNotIndexed
+		}
+		for _, l := range txn.Logs {
+			if matchLog(&l, addresses, topics) {
+				logs = append(logs, l)
+			}
+		}
+	}
+
+	if len(logs) > maxLogsResults {
+		return nil, &rpcError{rpcServerError, "query returned more than 10000 results"}
+	}
+	return logs, nil
+}
+
+// stringOrList decodes a filter value that is either null, a string or a list of strings.
+func stringOrList(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return []string{strings.ToLower(s)}, nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i] = strings.ToLower(list[i])
+	}
+	return list, nil
+}
+
+// matchLog applies the address and topic filters, an empty topic position matches anything.
+func matchLog(l *models.TxLog, addresses []string, topics [][]string) bool {
+	if len(addresses) > 0 && !contains(addresses, strings.ToLower(l.Address)) {
+		return false
+	}
+	if len(topics) > len(l.Topics) {
+		return false
+	}
+	for i, options := range topics {
+		if len(options) > 0 && !contains(options, strings.ToLower(l.Topics[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Encoding
+
+type rpcBlockRes struct {
+	Difficulty       string        `json:"difficulty"`
+	ExtraData        string        `json:"extraData"`
+	GasLimit         string        `json:"gasLimit"`
+	GasUsed          string        `json:"gasUsed"`
+	Hash             string        `json:"hash"`
+	LogsBloom        string        `json:"logsBloom"`
+	Miner            string        `json:"miner"`
+	MixHash          string        `json:"mixHash"`
+	Nonce            string        `json:"nonce"`
+	Number           string        `json:"number"`
+	ParentHash       string        `json:"parentHash"`
+	ReceiptsRoot     string        `json:"receiptsRoot"`
+	Sha3Uncles       string        `json:"sha3Uncles"`
+	Size             string        `json:"size"`
+	StateRoot        string        `json:"stateRoot"`
+	Timestamp        string        `json:"timestamp"`
+	TotalDifficulty  string        `json:"totalDifficulty"`
+	Transactions     []interface{} `json:"transactions"`
+	TransactionsRoot string        `json:"transactionsRoot"`
+	Uncles           []string      `json:"uncles"`
+}
+
+type rpcTransactionRes struct {
+	BlockHash        string  `json:"blockHash"`
+	BlockNumber      string  `json:"blockNumber"`
+	From             string  `json:"from"`
+	Gas              string  `json:"gas"`
+	GasPrice         string  `json:"gasPrice"`
+	Hash             string  `json:"hash"`
+	Input            string  `json:"input"`
+	Nonce            string  `json:"nonce"`
+	To               *string `json:"to"`
+	TransactionIndex string  `json:"transactionIndex"`
+	Value            string  `json:"value"`
+	V                string  `json:"v"`
+	R                string  `json:"r"`
+	S                string  `json:"s"`
+}
+
+type rpcReceiptRes struct {
+	BlockHash         string         `json:"blockHash"`
+	BlockNumber       string         `json:"blockNumber"`
+	ContractAddress   *string        `json:"contractAddress"`
+	CumulativeGasUsed string         `json:"cumulativeGasUsed"`
+	From              string         `json:"from"`
+	GasUsed           string         `json:"gasUsed"`
+	Logs              []models.TxLog `json:"logs"`
+	LogsBloom         string         `json:"logsBloom"`
+	Status            string         `json:"status"`
+	To                *string        `json:"to"`
+	TransactionHash   string         `json:"transactionHash"`
+	TransactionIndex  string         `json:"transactionIndex"`
+}
+
+func (a *ApiServer) rpcBlock(ctx context.Context, block *models.Block, full bool) (*rpcBlockRes, error) {
+	if block.LogsBloom == "" || (block.Pruned && block.Txs+block.UncleNo > 0) {
+		return nil, errNotIndexed
+	}
+
+	res := &rpcBlockRes{
+		Difficulty:       hexDecimal(block.Difficulty),
+		ExtraData:        block.ExtraData,
+		GasLimit:         util.EncodeUint64(block.GasLimit),
+		GasUsed:          util.EncodeUint64(block.GasUsed),
+		Hash:             block.Hash,
+		LogsBloom:        block.LogsBloom,
+		Miner:            block.Miner,
+		MixHash:          block.MixHash,
+		Nonce:            block.Nonce,
+		Number:           util.EncodeUint64(block.Number),
+		ParentHash:       block.ParentHash,
+		ReceiptsRoot:     block.ReceiptsRoot,
+		Sha3Uncles:       block.Sha3Uncles,
+		Size:             util.EncodeUint64(block.Size),
+		StateRoot:        block.StateRoot,
+		Timestamp:        util.EncodeUint64(block.Timestamp),
+		TotalDifficulty:  hexDecimal(block.TotalDifficulty),
+		Transactions:     make([]interface{}, 0, block.Txs),
+		TransactionsRoot: block.TransactionsRoot,
+		Uncles:           make([]string, 0, block.UncleNo),
+	}
+
+	if block.Txs > 0 {
+		txns, _, err := a.backend.BlockTransactions(ctx, block.Number, storage.Page{Limit: block.Txs})
+		if err != nil {
+			return nil, err
+		}
+		if len(txns) != block.Txs {
+			return nil, errNotIndexed
+		}
+
+		for i := range txns {
+			if !full {
+				res.Transactions = append(res.Transactions, txns[i].Hash)
+				continue
+			}
+
+			txn, err := rpcTransaction(&txns[i])
+			if err != nil {
+				return nil, err
+			}
+			res.Transactions = append(res.Transactions, txn)
+		}
+	}
+
+	if block.UncleNo > 0 {
+		uncles, err := a.backend.BlockUncles(ctx, block.Number)
+		if err != nil {
+			return nil, err
+		}
+		if len(uncles) != block.UncleNo {
+			return nil, errNotIndexed
+		}
+
+		for _, v := range uncles {
+			res.Uncles = append(res.Uncles, v.Hash)
+		}
+	}
+
+	return res, nil
+}
+
+func rpcTransaction(txn *models.Transaction) (*rpcTransactionRes, error) {
+	if txn.R == "" || txn.Pruned {
+		return nil, errNotIndexed
+	}
+
+	return &rpcTransactionRes{
+		BlockHash:        txn.BlockHash,
+		BlockNumber:      util.EncodeUint64(txn.BlockNumber),
+		From:             txn.From,
+		Gas:              util.EncodeUint64(txn.Gas),
+		GasPrice:         util.EncodeUint64(txn.GasPrice),
+		Hash:             txn.Hash,
+		Input:            txn.Input,
+		Nonce:            txn.Nonce,
+		To:               nullable(txn.To),
+		TransactionIndex: util.EncodeUint64(txn.TransactionIndex),
+		Value:            hexDecimal(txn.Value),
+		V:                txn.V,
+		R:                txn.R,
+		S:                txn.S,
+	}, nil
+}
+
+func rpcReceipt(txn *models.Transaction) (*rpcReceiptRes, error) {
+	if txn.LogsBloom == "" || txn.Status == "" || txn.Pruned {
+		return nil, errNotIndexed
+	}
+
+	logs := txn.Logs
+	if logs == nil {
+		logs = []models.TxLog{}
+	}
+
+	return &rpcReceiptRes{
+		BlockHash:         txn.BlockHash,
+		BlockNumber:       util.EncodeUint64(txn.BlockNumber),
+		ContractAddress:   nullable(txn.ContractAddress),
+		CumulativeGasUsed: util.EncodeUint64(txn.CumulativeGasUsed),
+		From:              txn.From,
+		GasUsed:           util.EncodeUint64(txn.GasUsed),
+		Logs:              logs,
+		LogsBloom:         txn.LogsBloom,
+		Status:            txn.Status,
+		To:                nullable(txn.To),
+		TransactionHash:   txn.Hash,
+		TransactionIndex:  util.EncodeUint64(txn.TransactionIndex),
+	}, nil
+}
+
+// hexDecimal encodes a decimal string stored by the crawler as a hex quantity.
+func hexDecimal(dec string) string {
+	n, ok := new(big.Int).SetString(dec, 10)
+	if !ok {
+		return "0x0"
+	}
+	return util.EncodeBig(n)
+}
+
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -143,8 +143,8 @@ func (a *ApiServer) updateGeodata() {
 
 func (a *ApiServer) getGeodata(w http.ResponseWriter, r *http.Request) {
 
-	if a.nodemap.nodes == nil {
-		a.sendError(w, http.StatusOK, "Geodata not fetched")
+	if a.nodemap.geodata == nil {
+		a.sendError(w, http.StatusServiceUnavailable, "geodata not fetched yet")
 		return
 	}
 	a.sendJson(w, http.StatusOK, *a.nodemap.geodata)
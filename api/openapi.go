@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/ubiq/spectrum-backend/params"
+)
+
+/*
+	The OpenAPI 3 document is generated from the route table when the server starts, the
+	schemas are read from the json tags of the response types.
+*/
+
+var pathParamRegex = regexp.MustCompile(`{([^}]+)}`)
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+type schemas map[string]interface{}
+
+// schema returns the schema of t, named structs are added to defs and referenced.
+func (defs schemas) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == rawMessageType {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": defs.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": defs.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return defs.object(t)
+		}
+		if _, ok := defs[t.Name()]; !ok {
+			// Registered before its fields so recursive types end
+			defs[t.Name()] = nil
+			defs[t.Name()] = defs.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	// interface{} can hold anything
+	return map[string]interface{}{}
+}
+
+func (defs schemas) object(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	defs.fields(t, props)
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+func (defs schemas) fields(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				defs.fields(ft, props)
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		props[name] = defs.schema(f.Type)
+	}
+}
+
+func (defs schemas) content(rt *route) map[string]interface{} {
+	if len(rt.content) > 0 {
+		content := make(map[string]interface{}, len(rt.content))
+		for _, c := range rt.content {
+			content[c] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		}
+		return content
+	}
+
+	var schema map[string]interface{}
+	if len(rt.response) == 1 {
+		schema = defs.schema(reflect.TypeOf(rt.response[0]))
+	} else {
+		alternatives := make([]interface{}, len(rt.response))
+		for i, v := range rt.response {
+			alternatives[i] = defs.schema(reflect.TypeOf(v))
+		}
+		schema = map[string]interface{}{"oneOf": alternatives}
+	}
+
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+func pathParams(path string) []string {
+	var names []string
+	for _, m := range pathParamRegex.FindAllStringSubmatch(path, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// openApi builds the document of the enabled routes.
+func (a *ApiServer) openApi() map[string]interface{} {
+	defs := make(schemas)
+	paths := make(map[string]interface{})
+
+	errorRes := map[string]interface{}{
+		"description": "Error",
+		"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": defs.schema(reflect.TypeOf(ErrorRes{}))}},
+	}
+
+	for _, rt := range a.routes() {
+		rt := rt
+
+		parameters := make([]interface{}, 0)
+		for _, name := range pathParams(rt.path) {
+			parameters = append(parameters, map[string]interface{}{
+				"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, p := range rt.query {
+			kind := p.kind
+			if kind == "" {
+				kind = "string"
+			}
+			parameters = append(parameters, map[string]interface{}{
+				"name": p.name, "in": "query", "description": p.description, "schema": map[string]interface{}{"type": kind},
+			})
+		}
+
+		ops := make(map[string]interface{})
+		for _, method := range rt.routeMethods() {
+			op := map[string]interface{}{
+				"summary":    rt.summary,
+				"parameters": parameters,
+				"responses": map[string]interface{}{
+					"200":     map[string]interface{}{"description": "OK", "content": defs.content(&rt)},
+					"default": errorRes,
+				},
+			}
+			if method == "POST" && rt.body != nil {
+				op["requestBody"] = map[string]interface{}{
+					"required": true,
+					"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": defs.schema(reflect.TypeOf(rt.body))}},
+				}
+			}
+			ops[strings.ToLower(method)] = op
+		}
+		paths[rt.path] = ops
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Spectrum API",
+			"version": params.VersionWithMeta,
+		},
+		"servers": []interface{}{map[string]interface{}{"url": apiPrefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": defs,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-Api-Key"},
+			},
+		},
+		// Keys are optional unless the server requires them
+		"security": []interface{}{map[string]interface{}{"apiKey": []string{}}, map[string]interface{}{}},
+	}
+}
+
+func (a *ApiServer) getOpenApi(w http.ResponseWriter, r *http.Request) {
+	a.sendJson(w, http.StatusOK, a.spec)
+}
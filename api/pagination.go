@@ -0,0 +1,208 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/ubiq/spectrum-backend/models"
+	"github.com/ubiq/spectrum-backend/storage"
+)
+
+/*
+	List endpoints take ?limit=&order=asc|desc&cursor=. Cursors are opaque to clients, they
+	encode the order of the list, the direction to move in and the position of the item the
+	page is relative to. A "prev" cursor is served by reading the list backwards from that
+	position and reversing the result.
+*/
+
+const (
+	defaultPageSize = 25
+	maxPageSize     = 1000
+)
+
+type pager struct {
+	storage.Page
+	desc bool
+	// Reading backwards from a prev cursor
+	backwards bool
+}
+
+type cursor struct {
+	desc      bool
+	backwards bool
+	pos       storage.Cursor
+}
+
+func (c cursor) encode() string {
+	order, dir := 'a', 'n'
+	if c.desc {
+		order = 'd'
+	}
+	if c.backwards {
+		dir = 'p'
+	}
+	raw := fmt.Sprintf("%c%c:%d:%d", order, dir, c.pos.Block, c.pos.Index)
+	if c.pos.Key != "" {
+		raw += ":" + c.pos.Key
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	var order, dir rune
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errors.New("invalid cursor")
+	}
+
+	// The key is optional, cursors of block ordered lists end after the index
+	parts := strings.SplitN(string(raw), ":", 4)
+	if len(parts) == 4 {
+		c.pos.Key = parts[3]
+		raw = raw[:len(raw)-len(parts[3])-1]
+	}
+
+	n, err := fmt.Sscanf(string(raw), "%c%c:%d:%d", &order, &dir, &c.pos.Block, &c.pos.Index)
+	if err != nil || n != 4 || (order != 'a' && order != 'd') || (dir != 'n' && dir != 'p') {
+		return c, errors.New("invalid cursor")
+	}
+
+	c.desc = order == 'd'
+	c.backwards = dir == 'p'
+	return c, nil
+}
+
+// parsePage reads the pagination parameters of a request. The limit falls back to the
+// {limit} route variable of the older endpoints.
+func parsePage(r *http.Request) (*pager, error) {
+	q := r.URL.Query()
+
+	limit := defaultPageSize
+
+	l := q.Get("limit")
+	if l == "" {
+		l = mux.Vars(r)["limit"]
+	}
+	if l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil {
+			return nil, errors.New("invalid limit")
+		}
+		limit = n
+	}
+
+	return newPager(limit, q.Get("order"), q.Get("cursor"))
+}
+
+// newPager checks the pagination parameters, a cursor carries its own order.
+func newPager(limit int, order, cur string) (*pager, error) {
+	if limit <= 0 {
+		return nil, errors.New("invalid limit")
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	p := &pager{desc: true}
+
+	switch order {
+	case "", "desc":
+	case "asc":
+		p.desc = false
+	default:
+		return nil, errors.New("order must be asc or desc")
+	}
+
+	if cur != "" {
+		c, err := decodeCursor(cur)
+		if err != nil {
+			return nil, err
+		}
+		p.desc = c.desc
+		p.backwards = c.backwards
+		p.After = &c.pos
+	}
+
+	p.Limit = limit
+	p.Desc = p.desc != p.backwards
+
+	return p, nil
+}
+
+// links returns the next and prev cursors of a page of items, a pointer to a slice fetched
+// with p.Page. Items read backwards are put back in the order of the list. more tells
+// whether the read stopped before the end of the list.
+func (p *pager) links(items interface{}, more bool) (string, string) {
+	slice := reflect.ValueOf(items).Elem()
+	n := slice.Len()
+
+	if p.backwards {
+		swap := reflect.Swapper(slice.Interface())
+		for i := 0; i < n/2; i++ {
+			swap(i, n-1-i)
+		}
+	}
+
+	if n == 0 {
+		return "", ""
+	}
+
+	first := position(slice.Index(0).Interface())
+	last := position(slice.Index(n - 1).Interface())
+
+	var next, prev string
+
+	// Moving forward there is something behind us when we came from a cursor, moving
+	// backwards there is something ahead
+	hasNext, hasPrev := more, p.After != nil
+	if p.backwards {
+		hasNext, hasPrev = p.After != nil, more
+	}
+
+	if hasNext {
+		next = cursor{desc: p.desc, pos: last}.encode()
+	}
+	if hasPrev {
+		prev = cursor{desc: p.desc, backwards: true, pos: first}.encode()
+	}
+	return next, prev
+}
+
+// position returns the key a list item is paged by.
+func position(item interface{}) storage.Cursor {
+	switch v := item.(type) {
+	case models.Transaction:
+		return storage.Cursor{Block: v.BlockNumber, Index: v.TransactionIndex}
+	case models.TokenTransfer:
+		return storage.Cursor{Block: v.BlockNumber, Index: v.TransactionIndex}
+	case models.Uncle:
+		return storage.Cursor{Block: v.BlockNumber, Index: v.Position}
+	case models.Block:
+		// Forked blocks share numbers, the timestamp tells them apart
+		return storage.Cursor{Block: v.Number, Index: v.Timestamp}
+	case models.Token:
+		return storage.Cursor{Block: v.FirstBlock, Index: v.FirstIndex}
+	case models.TokenBalance:
+		// Holders are ordered by balance
+		return storage.Cursor{Key: v.Rank + v.Holder}
+	}
+	panic(fmt.Sprintf("no page position for %T", item))
+}
+
+// setLinks adds the cursors as headers, for endpoints whose body is a bare list.
+func setLinks(w http.ResponseWriter, next, prev string) {
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+	if prev != "" {
+		w.Header().Set("X-Prev-Cursor", prev)
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+	/rpc/proxy forwards a whitelist of JSON-RPC methods to the node, so wallets can submit
+	transactions and estimate gas without talking to a public node. Calls are rate limited
+	per client, a batch takes one token per call and can't be larger than the burst. The
+	JSON-RPC passthrough shares the limit and only forwards the read only methods.
+*/
+
+// readOnlyMethods only read the chain state, any client may have them forwarded to the node.
+var readOnlyMethods = []string{
+	"eth_estimateGas",
+	"eth_call",
+	"eth_gasPrice",
+	"eth_getBalance",
+	"eth_getTransactionCount",
+	"eth_getCode",
+	"eth_blockNumber",
+	"eth_chainId",
+	"net_version",
+}
+
+var (
+	defaultProxyMethods = append([]string{"eth_sendRawTransaction"}, readOnlyMethods...)
+	readOnly            = methodSet(readOnlyMethods)
+)
+
+func methodSet(methods []string) map[string]bool {
+	set := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		set[m] = true
+	}
+	return set
+}
+
+func (a *ApiServer) postProxy(w http.ResponseWriter, r *http.Request) {
+	ip := clientIP(r, a.cfg.TrustForwarded)
+
+	reqs, batch, failure := readJsonRpc(w, r)
+	if failure != nil {
+		a.sendJson(w, http.StatusOK, failure)
+		return
+	}
+
+	// A batch the bucket can't ever hold would be refused forever
+	if limit := a.proxyLimiter.capacity(); limit > 0 && len(reqs) > limit {
+		a.sendJson(w, http.StatusBadRequest, rpcFailure(nil, rpcInvalidReq, fmt.Sprintf("batch of %v calls exceeds the limit of %v", len(reqs), limit)))
+		return
+	}
+
+	if ok, wait := a.proxyLimiter.take(ip, len(reqs)); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		a.sendJson(w, http.StatusTooManyRequests, rpcFailure(nil, rpcLimitExceeded, "rate limit exceeded"))
+		return
+	}
+
+	responses := make([]*rpcResponse, 0, len(reqs))
+	for _, req := range reqs {
+		responses = append(responses, a.proxyCall(r.Context(), req, ip))
+	}
+
+	if !batch {
+		a.sendJson(w, http.StatusOK, responses[0])
+		return
+	}
+	a.sendJson(w, http.StatusOK, responses)
+}
+
+func (a *ApiServer) proxyCall(ctx context.Context, req *rpcRequest, ip string) *rpcResponse {
+	if req.JsonRpc != "2.0" || req.Method == "" {
+		return rpcFailure(req.Id, rpcInvalidReq, "invalid request")
+	}
+
+	if !a.proxyMethods[req.Method] {
+		return rpcFailure(req.Id, rpcNoMethod, "the method "+req.Method+" is not available")
+	}
+
+	var params []json.RawMessage
+	if len(req.Params) > 0 && string(req.Params) != "null" {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return rpcFailure(req.Id, rpcInvalidParam, "params must be an array")
+		}
+	}
+
+	res := a.rpcForward(req.Id, req.Method, params)
+
+	if req.Method == "eth_sendRawTransaction" {
+		if res.Error != nil {
+			log.Warnf("Proxy: transaction from %v rejected: %v", ip, res.Error.Message)
+		} else {
+			log.Printf("Proxy: broadcast transaction %v from %v", strings.Trim(string(res.Result), `"`), ip)
+		}
+	}
+
+	return res
+}
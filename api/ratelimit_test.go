@@ -0,0 +1,101 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	tests := []struct {
+		rate     float64
+		burst    int
+		capacity int
+	}{
+		{2, 10, 10},
+		// Without a burst a second of calls is allowed
+		{2, 0, 2},
+		{0.5, 0, 1},
+		{2.5, 0, 3},
+		// No limit
+		{0, 10, 0},
+	}
+
+	for _, tt := range tests {
+		l := newRateLimiter(tt.rate, tt.burst)
+		if got := l.capacity(); got != tt.capacity {
+			t.Errorf("rate %v burst %v: capacity %v, want %v", tt.rate, tt.burst, got, tt.capacity)
+		}
+	}
+}
+
+func TestRateLimiterTake(t *testing.T) {
+	l := newRateLimiter(2, 4)
+
+	tests := []struct {
+		n  int
+		ok bool
+	}{
+		{3, true},
+		{2, false},
+		{1, true},
+		{1, false},
+	}
+
+	for i, tt := range tests {
+		ok, wait := l.take("client", tt.n)
+		if ok != tt.ok {
+			t.Errorf("take %v: %v, want %v", i, ok, tt.ok)
+		}
+		if !ok && wait <= 0 {
+			t.Errorf("take %v: refused without a wait", i)
+		}
+	}
+
+	// Other clients have their own bucket
+	if ok, _ := l.take("other", 4); !ok {
+		t.Error("other client refused")
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	l := newRateLimiter(2, 4)
+
+	if ok, _ := l.take("client", 4); !ok {
+		t.Fatal("full bucket refused")
+	}
+
+	ok, wait := l.take("client", 2)
+	if ok {
+		t.Fatal("empty bucket served")
+	}
+	// Less the refill since the first take
+	if wait > time.Second || wait < 900*time.Millisecond {
+		t.Errorf("wait %v, want about 1s", wait)
+	}
+
+	// A second later the bucket holds 2 tokens
+	l.buckets["client"].last = l.buckets["client"].last.Add(-time.Second)
+	if ok, _ := l.take("client", 2); !ok {
+		t.Error("refilled bucket refused")
+	}
+
+	// Refills stop at the burst
+	l.buckets["client"].last = l.buckets["client"].last.Add(-time.Hour)
+	if ok, _ := l.take("client", 4); !ok {
+		t.Error("full bucket refused")
+	}
+	if ok, _ := l.take("client", 1); ok {
+		t.Error("bucket refilled past the burst")
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	var l *rateLimiter
+
+	if ok, _ := l.take("client", 1000); !ok {
+		t.Error("nil limiter refused")
+	}
+	if ok, _ := newRateLimiter(0, 0).take("client", 1000); !ok {
+		t.Error("limiter without a rate refused")
+	}
+}
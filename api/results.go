@@ -0,0 +1,145 @@
+package api
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+	Hot endpoints keep their responses in a bounded LRU cache keyed by the request URI.
+	Entries are dropped when the head moves, and after a ttl for data that changes without
+	a new block, like prices and charts.
+*/
+
+const (
+	defaultResultEntries = 1000
+	defaultResultTTL     = 60
+)
+
+type cachedResult struct {
+	key     string
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+type resultCache struct {
+	sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func newResultCache(size int, ttl time.Duration) *resultCache {
+	return &resultCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *resultCache) get(key string) (*cachedResult, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	res := el.Value.(*cachedResult)
+	if time.Now().After(res.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	return res, true
+}
+
+func (c *resultCache) put(key string, header http.Header, body []byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	res := &cachedResult{key, header, body, time.Now().Add(c.ttl)}
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = res
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(res)
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResult).key)
+	}
+}
+
+// purge drops every entry, the head moved.
+func (c *resultCache) purge() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// resultRecorder keeps the headers and body of a response apart from the ones of the
+// middlewares around it.
+type resultRecorder struct {
+	header http.Header
+	code   int
+	buf    bytes.Buffer
+}
+
+func (rec *resultRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *resultRecorder) WriteHeader(code int) {
+	rec.code = code
+}
+
+func (rec *resultRecorder) Write(p []byte) (int, error) {
+	return rec.buf.Write(p)
+}
+
+func writeResult(w http.ResponseWriter, header http.Header, code int, body []byte) {
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// cached serves the responses of h from the result cache, only successful ones are kept.
+func (a *ApiServer) cached(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.RequestURI()
+
+		if res, ok := a.results.get(key); ok {
+			writeResult(w, res.header, http.StatusOK, res.body)
+			return
+		}
+
+		// Errors carry the request id, it's never kept with the result
+		rec := &resultRecorder{header: make(http.Header), code: http.StatusOK}
+		rec.header.Set(requestIdHeader, w.Header().Get(requestIdHeader))
+		h(rec, r)
+		rec.header.Del(requestIdHeader)
+
+		if rec.code == http.StatusOK {
+			a.results.put(key, rec.header, rec.buf.Bytes())
+		}
+		writeResult(w, rec.header, rec.code, rec.buf.Bytes())
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResultCacheEviction(t *testing.T) {
+	c := newResultCache(2, time.Minute)
+
+	c.put("a", http.Header{}, []byte("a"))
+	c.put("b", http.Header{}, []byte("b"))
+
+	// "a" becomes the most recently used, "b" goes first
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("a is missing")
+	}
+	c.put("c", http.Header{}, []byte("c"))
+
+	tests := []struct {
+		key    string
+		cached bool
+	}{
+		{"a", true},
+		{"b", false},
+		{"c", true},
+	}
+
+	for _, tt := range tests {
+		if _, ok := c.get(tt.key); ok != tt.cached {
+			t.Errorf("get(%v) cached = %v, want %v", tt.key, ok, tt.cached)
+		}
+	}
+	if n := c.order.Len(); n != 2 {
+		t.Errorf("%v entries kept, want 2", n)
+	}
+}
+
+func TestResultCacheReplace(t *testing.T) {
+	c := newResultCache(2, time.Minute)
+
+	c.put("a", http.Header{}, []byte("old"))
+	c.put("a", http.Header{}, []byte("new"))
+
+	res, ok := c.get("a")
+	if !ok || string(res.body) != "new" {
+		t.Errorf("get(a) = %v, %v, want the new body", res, ok)
+	}
+	if n := c.order.Len(); n != 1 {
+		t.Errorf("%v entries kept, want 1", n)
+	}
+}
+
+func TestResultCacheExpiry(t *testing.T) {
+	c := newResultCache(10, time.Minute)
+
+	c.put("fresh", http.Header{}, nil)
+	c.put("stale", http.Header{}, nil)
+	c.entries["stale"].Value.(*cachedResult).expires = time.Now().Add(-time.Second)
+
+	if _, ok := c.get("fresh"); !ok {
+		t.Error("fresh entry expired")
+	}
+	if _, ok := c.get("stale"); ok {
+		t.Error("stale entry served")
+	}
+	if _, ok := c.entries["stale"]; ok {
+		t.Error("stale entry kept")
+	}
+}
+
+func TestResultCachePurge(t *testing.T) {
+	c := newResultCache(10, time.Minute)
+
+	c.put("a", http.Header{}, nil)
+	c.put("b", http.Header{}, nil)
+	c.purge()
+
+	for _, key := range []string{"a", "b"} {
+		if _, ok := c.get(key); ok {
+			t.Errorf("%v served after purge", key)
+		}
+	}
+	if n := c.order.Len(); n != 0 {
+		t.Errorf("%v entries kept after purge, want 0", n)
+	}
+
+	c.put("c", http.Header{}, nil)
+	if _, ok := c.get("c"); !ok {
+		t.Error("c missing after purge")
+	}
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/ubiq/spectrum-backend/graphql"
+	"github.com/ubiq/spectrum-backend/models"
+)
+
+/*
+	Every route is mounted under /v1, the paths served before versioning stay as aliases.
+	The table is also the source of the OpenAPI document, a route, its parameters and its
+	response shape are declared once here.
+*/
+
+const apiPrefix = "/v1"
+
+type param struct {
+	name        string
+	description string
+	// OpenAPI type, string when empty
+	kind string
+}
+
+type route struct {
+	path string
+	// Unversioned path kept for older clients, empty when there is none
+	legacy  string
+	methods []string
+	handler func(*ApiServer, http.ResponseWriter, *http.Request)
+	// Served from the result cache
+	cached  bool
+	summary string
+	// Path parameters are taken from the path, these are the query ones
+	query []param
+	// Request body of POST routes
+	body interface{}
+	// Shapes of the response body, several when it depends on the request
+	response []interface{}
+	// Content types of the response, JSON when empty
+	content []string
+	// Routes registered only when enabled returns true
+	enabled func(*Config) bool
+}
+
+var (
+	pageParams = []param{
+		{"limit", "Items per page, up to 1000", "integer"},
+		{"order", "asc or desc", ""},
+		{"cursor", "Position to continue from, as returned in X-Next-Cursor or X-Prev-Cursor", ""},
+	}
+	exportParams = []param{
+		{"format", "csv or ndjson", ""},
+		{"startblock", "First block", "integer"},
+		{"endblock", "Last block", "integer"},
+		{"from", "First day, YYYY-MM-DD or a unix timestamp", ""},
+		{"to", "Last day, YYYY-MM-DD or a unix timestamp", ""},
+	}
+)
+
+func withParams(params []param, more ...param) []param {
+	return append(append([]param{}, params...), more...)
+}
+
+var routes = []route{
+	{path: "/supply/{symbol}", legacy: "/supply/{symbol}", handler: (*ApiServer).getSupply, cached: true,
+		summary: "Supply and price of ubq or qwark, or only the formatted supply with supplyOnly=true",
+		query:   []param{{"supplyOnly", "Only return the supply", "boolean"}}, response: []interface{}{models.Store{}, ""}},
+	{path: "/forkedblock/{number}", legacy: "/forkedblock/{number}", handler: (*ApiServer).getForkedBlockByNumber,
+		summary: "Block replaced by a reorganization", response: []interface{}{models.Block{}}},
+	{path: "/block/{number}", legacy: "/block/{number}", handler: (*ApiServer).getBlockByNumber,
+		summary: "Block by number", response: []interface{}{models.Block{}}},
+	{path: "/block/{number}/txns", legacy: "/block/{number}/txns", handler: (*ApiServer).getBlockTransactions,
+		summary: "Transactions of a block", query: pageParams, response: []interface{}{[]models.Transaction{}}},
+	{path: "/blockbyhash/{hash}", legacy: "/blockbyhash/{hash}", handler: (*ApiServer).getBlockByHash,
+		summary: "Block by hash", response: []interface{}{models.Block{}}},
+	{path: "/latest", legacy: "/latest", handler: (*ApiServer).getLatestBlock, cached: true,
+		summary: "Latest indexed block", response: []interface{}{models.Block{}}},
+	{path: "/latestblocks/{limit}", legacy: "/latestblocks/{limit}", handler: (*ApiServer).getLatestBlocks, cached: true,
+		summary: "Latest blocks", query: pageParams, response: []interface{}{BlockRes{}}},
+	{path: "/latestforkedblocks/{limit}", legacy: "/latestforkedblocks/{limit}", handler: (*ApiServer).getLatestForkedBlocks, cached: true,
+		summary: "Latest forked blocks", query: pageParams, response: []interface{}{[]models.Block{}}},
+	{path: "/latesttransactions/{limit}", legacy: "/latesttransactions/{limit}", handler: (*ApiServer).getLatestTransactions, cached: true,
+		summary: "Latest transactions", query: pageParams, response: []interface{}{AccountTxn{}}},
+	{path: "/latestaccounttxns/{hash}", legacy: "/latestaccounttxns/{hash}", handler: (*ApiServer).getLatestTransactionsByAccount,
+		summary: "Transactions of an account", query: pageParams, response: []interface{}{AccountTxn{}}},
+	{path: "/latestaccounttokentxns/{hash}", legacy: "/latestaccounttokentxns/{hash}", handler: (*ApiServer).getLatestTokenTransfersByAccount,
+		summary: "Token transfers of an account", query: pageParams, response: []interface{}{AccountTokenTransfer{}}},
+	{path: "/latesttokentransfers/{limit}", legacy: "/latesttokentransfers/{limit}", handler: (*ApiServer).getLatestTokenTransfers, cached: true,
+		summary: "Latest token transfers", query: pageParams, response: []interface{}{AccountTokenTransfer{}}},
+	{path: "/latestuncles/{limit}", legacy: "/latestuncles/{limit}", handler: (*ApiServer).getLatestUncles, cached: true,
+		summary: "Latest uncles", query: pageParams, response: []interface{}{UncleRes{}}},
+	{path: "/transaction/{hash}", legacy: "/transaction/{hash}", handler: (*ApiServer).getTransactionByHash,
+		summary: "Transaction by hash", response: []interface{}{models.Transaction{}}},
+	{path: "/transactionbycontract/{hash}", legacy: "/transactionbycontract/{hash}", handler: (*ApiServer).getTransactionByContractAddress,
+		summary: "Transaction that created a contract", response: []interface{}{models.Transaction{}}},
+	{path: "/latesttransfersbytoken/{hash}", legacy: "/latesttransfersbytoken/{hash}", handler: (*ApiServer).getLatestTransfersByToken,
+		summary: "Transfers of a token", query: pageParams, response: []interface{}{AccountTokenTransfer{}}},
+	{path: "/tokentransfersbyaccount/{token}/{account}", legacy: "/tokentransfersbyaccount/{token}/{account}", handler: (*ApiServer).getTokenTransfersByAccount,
+		summary: "Transfers of a token by an account", query: pageParams, response: []interface{}{AccountTokenTransfer{}}},
+	{path: "/tokens", handler: (*ApiServer).getTokens, cached: true,
+		summary: "Known tokens, newest first", query: pageParams, response: []interface{}{TokenRes{}}},
+	{path: "/token/{contract}", handler: (*ApiServer).getToken,
+		summary: "Metadata and holder count of a token", response: []interface{}{models.Token{}}},
+	{path: "/token/{contract}/holders", handler: (*ApiServer).getTokenHolders,
+		summary: "Holders of a token by balance, largest first unless order=asc", query: pageParams, response: []interface{}{HolderRes{}}},
+	{path: "/uncle/{hash}", legacy: "/uncle/{hash}", handler: (*ApiServer).getUncleByHash,
+		summary: "Uncle by hash", response: []interface{}{models.Uncle{}}},
+	{path: "/charts/{chart}/{limit}", legacy: "/charts/{chart}/{limit}", handler: (*ApiServer).getChartData, cached: true,
+		summary: "Chart data, minedblocks has a series per miner",
+		query:   []param{{"miner", "Miner address, required by poolhashrate", ""}}, response: []interface{}{models.LineChart{}, models.MLineChart{}}},
+	{path: "/geodata", legacy: "/geodata", handler: (*ApiServer).getGeodata,
+		summary: "Locations of the known nodes", response: []interface{}{[]Peer{}}},
+	{path: "/address/{address}", legacy: "/address/{address}", handler: (*ApiServer).getAddress,
+		summary: "Summary of an address", response: []interface{}{AddressRes{}}},
+	{path: "/search", legacy: "/search", handler: (*ApiServer).getSearch,
+		summary: "Look up a block number, hash, hash prefix or address",
+		query:   []param{{"q", "Search input", ""}}, response: []interface{}{SearchRes{}}},
+	{path: "/export/address/{addr}", legacy: "/export/address/{addr}", handler: (*ApiServer).getExportAddress,
+		summary: "Transactions or token transfers of an address as CSV or NDJSON",
+		query:   withParams(exportParams, param{"type", "tx or token", ""}), content: []string{"text/csv", "application/x-ndjson"}},
+	{path: "/export/token/{contract}", legacy: "/export/token/{contract}", handler: (*ApiServer).getExportToken,
+		summary: "Transfers of a token as CSV or NDJSON", query: exportParams, content: []string{"text/csv", "application/x-ndjson"}},
+	{path: "/api", legacy: "/api", handler: (*ApiServer).getEtherscan,
+		summary: "Etherscan compatible api, the action parameters depend on the module",
+		query:   []param{{"module", "account, block, stats or proxy", ""}, {"action", "Action of the module", ""}}, response: []interface{}{etherscanResponse{}}},
+	{path: "/rpc", legacy: "/rpc", methods: []string{"POST"}, handler: (*ApiServer).postJsonRpc,
+		summary: "JSON-RPC served from the index", body: rpcRequest{}, response: []interface{}{rpcResponse{}, []rpcResponse{}}},
+	{path: "/graphql", legacy: "/graphql", methods: []string{"GET", "POST"}, handler: (*ApiServer).graphQL,
+		summary: "GraphQL over the index",
+		query:   []param{{"query", "Query document, for GET", ""}, {"operationName", "Operation to run, for GET", ""}, {"variables", "JSON object of variables, for GET", ""}},
+		body:    graphql.Request{}, response: []interface{}{graphql.Response{}}},
+	{path: "/rpc/proxy", legacy: "/rpc/proxy", methods: []string{"POST"}, handler: (*ApiServer).postProxy,
+		summary: "Rate limited JSON-RPC forwarded to the node", body: rpcRequest{}, response: []interface{}{rpcResponse{}, []rpcResponse{}},
+		enabled: func(cfg *Config) bool { return cfg.Proxy.Enabled }},
+	{path: "/openapi.json", handler: (*ApiServer).getOpenApi,
+		summary: "This document", response: []interface{}{map[string]interface{}{}}},
+}
+
+func (rt *route) routeMethods() []string {
+	if len(rt.methods) == 0 {
+		return []string{"GET"}
+	}
+	return rt.methods
+}
+
+// routes returns the routes enabled by the config.
+func (a *ApiServer) routes() []route {
+	result := make([]route, 0, len(routes))
+	for _, rt := range routes {
+		if rt.enabled == nil || rt.enabled(a.cfg) {
+			result = append(result, rt)
+		}
+	}
+	return result
+}
+
+// router mounts the routes, their aliases and the probes.
+func (a *ApiServer) router() *mux.Router {
+	root := mux.NewRouter()
+
+	// Probes skip the middlewares, they must never be limited or cached
+	root.HandleFunc("/healthz", a.health.Healthz).Methods("GET")
+	root.HandleFunc("/readyz", a.health.Readyz).Methods("GET")
+
+	r := root.PathPrefix("/").Subrouter()
+
+	for _, rt := range a.routes() {
+		handler := rt.handler
+		h := func(w http.ResponseWriter, r *http.Request) { handler(a, w, r) }
+		if rt.cached {
+			h = a.cached(h)
+		}
+
+		r.HandleFunc(apiPrefix+rt.path, h).Methods(rt.routeMethods()...)
+		if rt.legacy != "" {
+			r.HandleFunc(rt.legacy, h).Methods(rt.routeMethods()...)
+		}
+	}
+
+	r.Use(requestIdMiddleware)
+	r.Use(loggingMiddleware)
+	r.Use(a.authMiddleware)
+	r.Use(a.cacheMiddleware)
+
+	// mux skips the middlewares when nothing matches, the request id is set here instead
+	root.NotFoundHandler = requestIdMiddleware(loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.sendError(w, http.StatusNotFound, "no route for "+r.URL.Path)
+	})))
+	root.MethodNotAllowedHandler = requestIdMiddleware(loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.sendError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed on "+r.URL.Path)
+	})))
+
+	return root
+}
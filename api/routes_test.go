@@ -0,0 +1,457 @@
+package api
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ubiq/spectrum-backend/health"
+)
+
+// The tests below fail when the handlers, the router and the OpenAPI document drift apart.
+
+func testServer() *ApiServer {
+	cfg := &Config{}
+	// Every optional route is part of the document
+	cfg.Proxy.Enabled = true
+
+	a := &ApiServer{cfg: cfg, health: &health.Checker{}, auth: newApiAuth(nil, cfg)}
+	a.spec = a.openApi()
+	return a
+}
+
+func handlerName(rt *route) string {
+	name := runtime.FuncForPC(reflect.ValueOf(rt.handler).Pointer()).Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+type specOp struct {
+	path, query map[string]bool
+}
+
+// specOps returns the parameters of every operation of the document by "METHOD path".
+func specOps(t *testing.T, spec map[string]interface{}) map[string]specOp {
+	ops := make(map[string]specOp)
+
+	for path, v := range spec["paths"].(map[string]interface{}) {
+		for method, o := range v.(map[string]interface{}) {
+			op := specOp{make(map[string]bool), make(map[string]bool)}
+
+			for _, p := range o.(map[string]interface{})["parameters"].([]interface{}) {
+				param := p.(map[string]interface{})
+				switch param["in"] {
+				case "path":
+					op.path[param["name"].(string)] = true
+				case "query":
+					op.query[param["name"].(string)] = true
+				default:
+					t.Errorf("%v %v: unexpected parameter location %v", method, path, param["in"])
+				}
+			}
+			ops[strings.ToUpper(method)+" "+path] = op
+		}
+	}
+	return ops
+}
+
+func TestRouterMatchesSpec(t *testing.T) {
+	a := testServer()
+	ops := specOps(t, a.spec)
+
+	legacy := make(map[string]string)
+	for _, rt := range a.routes() {
+		if rt.legacy != "" {
+			legacy[rt.legacy] = rt.path
+		}
+	}
+
+	routed := make(map[string]bool)
+
+	err := a.router().Walk(func(r *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tpl, err := r.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := r.GetMethods()
+		if err != nil {
+			return nil
+		}
+		if tpl == "/healthz" || tpl == "/readyz" {
+			return nil
+		}
+
+		path := strings.TrimPrefix(tpl, apiPrefix)
+		if path == tpl {
+			v1, ok := legacy[tpl]
+			if !ok {
+				t.Errorf("%v is neither under %v nor an alias", tpl, apiPrefix)
+				return nil
+			}
+			path = v1
+		}
+
+		for _, m := range methods {
+			if _, ok := ops[m+" "+path]; !ok {
+				t.Errorf("%v %v is routed but not in the document", m, tpl)
+			}
+			if strings.HasPrefix(tpl, apiPrefix) {
+				routed[m+" "+path] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for op := range ops {
+		if !routed[op] {
+			t.Errorf("%v is in the document but not routed under %v", op, apiPrefix)
+		}
+	}
+}
+
+func TestSpecPathParams(t *testing.T) {
+	a := testServer()
+	ops := specOps(t, a.spec)
+
+	for _, rt := range a.routes() {
+		for _, m := range rt.routeMethods() {
+			op := ops[m+" "+rt.path]
+
+			params := pathParams(rt.path)
+			if len(params) != len(op.path) {
+				t.Errorf("%v %v: %v path parameters documented, the path has %v", m, rt.path, len(op.path), len(params))
+			}
+			for _, p := range params {
+				if !op.path[p] {
+					t.Errorf("%v %v: path parameter %v is not documented", m, rt.path, p)
+				}
+			}
+		}
+	}
+}
+
+func TestSpecRefsResolve(t *testing.T) {
+	a := testServer()
+	defs := a.spec["components"].(map[string]interface{})["schemas"].(schemas)
+
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				name := strings.TrimPrefix(ref, "#/components/schemas/")
+				if defs[name] == nil {
+					t.Errorf("%v does not resolve", ref)
+				}
+			}
+			for _, e := range v {
+				walk(e)
+			}
+		case schemas:
+			for _, e := range v {
+				walk(e)
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(a.spec)
+}
+
+// source holds the functions of the package by name, methods by their bare name.
+type source struct {
+	funcs map[string]*ast.FuncDecl
+}
+
+func parseSource(t *testing.T) *source {
+	fset := token.NewFileSet()
+
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := &source{make(map[string]*ast.FuncDecl)}
+	for _, f := range pkgs["api"].Files {
+		for _, d := range f.Decls {
+			if fn, ok := d.(*ast.FuncDecl); ok {
+				src.funcs[fn.Name.Name] = fn
+			}
+		}
+	}
+	return src
+}
+
+// isHandler reports whether fn is a method of ApiServer taking a response writer and a request.
+func isHandler(fn *ast.FuncDecl) bool {
+	if fn.Recv == nil || len(fn.Type.Params.List) != 2 {
+		return false
+	}
+	star, ok := fn.Recv.List[0].Type.(*ast.StarExpr)
+	if !ok || star.X.(*ast.Ident).Name != "ApiServer" {
+		return false
+	}
+	return typeString(fn.Type.Params.List[0].Type) == "http.ResponseWriter" &&
+		typeString(fn.Type.Params.List[1].Type) == "*http.Request"
+}
+
+func typeString(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.StarExpr:
+		return "*" + typeString(e.X)
+	case *ast.SelectorExpr:
+		return typeString(e.X) + "." + e.Sel.Name
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+func isCall(e ast.Expr, pkg, name string) bool {
+	call, ok := e.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != name {
+		return false
+	}
+	if pkg == "" {
+		return true
+	}
+	id, ok := sel.X.(*ast.Ident)
+	return ok && id.Name == pkg
+}
+
+// requestParam returns the name of the *http.Request parameter of fn.
+func requestParam(fn *ast.FuncDecl) string {
+	for _, f := range fn.Type.Params.List {
+		if typeString(f.Type) == "*http.Request" && len(f.Names) > 0 {
+			return f.Names[0].Name
+		}
+	}
+	return ""
+}
+
+type paramUse struct {
+	// Route variables read by the handler itself, and by it or the helpers it passes the
+	// request to
+	vars, allVars map[string]bool
+	query         map[string]bool
+}
+
+// uses collects the route variables and query parameters read by fn and the functions of
+// the package it passes the request to.
+func (src *source) uses(fn *ast.FuncDecl) *paramUse {
+	use := &paramUse{make(map[string]bool), make(map[string]bool), make(map[string]bool)}
+	src.collect(fn, use, true, make(map[string]bool))
+	return use
+}
+
+func (src *source) collect(fn *ast.FuncDecl, use *paramUse, top bool, seen map[string]bool) {
+	if seen[fn.Name.Name] || fn.Body == nil {
+		return
+	}
+	seen[fn.Name.Name] = true
+
+	req := requestParam(fn)
+	varsIdents := make(map[string]bool)
+	queryIdents := make(map[string]bool)
+
+	// Idents bound to mux.Vars(r) or r.URL.Query()
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		if assign, ok := n.(*ast.AssignStmt); ok && len(assign.Lhs) == 1 && len(assign.Rhs) == 1 {
+			if id, ok := assign.Lhs[0].(*ast.Ident); ok {
+				if isCall(assign.Rhs[0], "mux", "Vars") {
+					varsIdents[id.Name] = true
+				}
+				if isCall(assign.Rhs[0], "", "Query") {
+					queryIdents[id.Name] = true
+				}
+			}
+		}
+		return true
+	})
+
+	literal := func(e ast.Expr) (string, bool) {
+		lit, ok := e.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return "", false
+		}
+		s, err := strconv.Unquote(lit.Value)
+		return s, err == nil
+	}
+
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.IndexExpr:
+			id, isIdent := n.X.(*ast.Ident)
+			if (isIdent && varsIdents[id.Name]) || isCall(n.X, "mux", "Vars") {
+				if key, ok := literal(n.Index); ok {
+					use.allVars[key] = true
+					if top {
+						use.vars[key] = true
+					}
+				}
+			}
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if ok && sel.Sel.Name == "Get" && len(n.Args) == 1 {
+				id, isIdent := sel.X.(*ast.Ident)
+				if (isIdent && queryIdents[id.Name]) || isCall(sel.X, "", "Query") {
+					if key, ok := literal(n.Args[0]); ok {
+						use.query[key] = true
+					}
+				}
+			}
+
+			// Follow the request into the helpers of the package
+			passesRequest := false
+			for _, arg := range n.Args {
+				if id, ok := arg.(*ast.Ident); ok && id.Name == req {
+					passesRequest = true
+				}
+			}
+			if !passesRequest {
+				break
+			}
+
+			var callee string
+			switch f := n.Fun.(type) {
+			case *ast.Ident:
+				callee = f.Name
+			case *ast.SelectorExpr:
+				if id, ok := f.X.(*ast.Ident); ok && id.Name == "a" {
+					callee = f.Sel.Name
+				}
+			}
+			if next, ok := src.funcs[callee]; ok {
+				src.collect(next, use, false, seen)
+			}
+		}
+		return true
+	})
+}
+
+func TestHandlersAreRouted(t *testing.T) {
+	src := parseSource(t)
+
+	routed := make(map[string]bool)
+	for i := range routes {
+		routed[handlerName(&routes[i])] = true
+	}
+
+	var missing []string
+	for name, fn := range src.funcs {
+		if isHandler(fn) && !routed[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+
+	for _, name := range missing {
+		t.Errorf("handler %v is not in the route table", name)
+	}
+}
+
+func TestHandlerParamsDocumented(t *testing.T) {
+	a := testServer()
+	src := parseSource(t)
+	ops := specOps(t, a.spec)
+
+	for i, rt := range a.routes() {
+		name := handlerName(&a.routes()[i])
+		fn, ok := src.funcs[name]
+		if !ok {
+			t.Errorf("%v: handler %v not found", rt.path, name)
+			continue
+		}
+
+		use := src.uses(fn)
+		params := make(map[string]bool)
+		for _, p := range pathParams(rt.path) {
+			params[p] = true
+		}
+
+		for v := range use.vars {
+			if !params[v] {
+				t.Errorf("%v reads route variable %v missing from %v", name, v, rt.path)
+			}
+		}
+		for p := range params {
+			if !use.allVars[p] {
+				t.Errorf("%v never reads path parameter %v of %v", name, p, rt.path)
+			}
+		}
+
+		for _, m := range rt.routeMethods() {
+			op := ops[m+" "+rt.path]
+			for q := range use.query {
+				if !op.query[q] {
+					t.Errorf("%v %v: %v reads query parameter %v, it is not documented", m, rt.path, name, q)
+				}
+			}
+		}
+	}
+}
+
+func TestOpenApiServed(t *testing.T) {
+	a := testServer()
+
+	rec := httptest.NewRecorder()
+	a.router().ServeHTTP(rec, httptest.NewRequest("GET", apiPrefix+"/openapi.json", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("openapi.json answered %v", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"openapi":"3.0.3"`) {
+		t.Errorf("openapi.json is not an OpenAPI 3 document")
+	}
+}
+
+func TestUnmatchedRoutes(t *testing.T) {
+	a := testServer()
+
+	tests := []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{"GET", apiPrefix + "/nothing", http.StatusNotFound, "not_found"},
+		{"DELETE", apiPrefix + "/latest", http.StatusMethodNotAllowed, "method_not_allowed"},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		a.router().ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+		var res ErrorRes
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Errorf("%v %v: %v", tt.method, tt.path, err)
+			continue
+		}
+		if rec.Code != tt.status || res.Code != tt.code {
+			t.Errorf("%v %v answered %v %v, want %v %v", tt.method, tt.path, rec.Code, res.Code, tt.status, tt.code)
+		}
+		if res.RequestId == "" || res.RequestId != rec.Header().Get(requestIdHeader) {
+			t.Errorf("%v %v: request id %q, header %q", tt.method, tt.path, res.RequestId, rec.Header().Get(requestIdHeader))
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ubiq/spectrum-backend/storage"
+)
+
+/*
+	/search?q= classifies the input, a block number, a hash or hash prefix, or an address,
+	and looks it up everywhere it can be. Every match is a typed result, the front-end links
+	to the result's key.
+*/
+
+const searchLimit = 10
+
+var (
+	numberRegex     = regexp.MustCompile(`^[0-9]+$`)
+	hashRegex       = regexp.MustCompile(`^0x[0-9a-f]{64}$`)
+	hashPrefixRegex = regexp.MustCompile(`^0x[0-9a-f]{6,63}$`)
+)
+
+// Kinds of search input
+const (
+	searchNumber  = "number"
+	searchHash    = "hash"
+	searchAddress = "address"
+	searchUnknown = "unknown"
+)
+
+type SearchResult struct {
+	// block, forkedblock, transaction, uncle, address, contract or token
+	Type  string      `json:"type"`
+	Key   string      `json:"key"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+type SearchRes struct {
+	Query   string         `json:"query"`
+	Kind    string         `json:"kind"`
+	Results []SearchResult `json:"results"`
+}
+
+func classify(q string) string {
+	switch {
+	case numberRegex.MatchString(q):
+		return searchNumber
+	case addressRegex.MatchString(q):
+		return searchAddress
+	case hashRegex.MatchString(q), hashPrefixRegex.MatchString(q):
+		return searchHash
+	}
+	return searchUnknown
+}
+
+func (a *ApiServer) getSearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	if q == "" {
+		a.sendError(w, http.StatusBadRequest, "missing search query")
+		return
+	}
+
+	res := SearchRes{Query: q, Kind: classify(q), Results: []SearchResult{}}
+
+	var err error
+
+	switch res.Kind {
+	case searchNumber:
+		res.Results, err = a.searchNumber(r.Context(), q, res.Results)
+	case searchHash:
+		res.Results, err = a.searchHash(r.Context(), q, res.Results)
+	case searchAddress:
+		res.Results, err = a.searchAddress(r.Context(), q, res.Results)
+	}
+
+	if err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+
+	a.sendJson(w, http.StatusOK, res)
+}
+
+func (a *ApiServer) searchNumber(ctx context.Context, q string, results []SearchResult) ([]SearchResult, error) {
+	number, err := strconv.ParseUint(q, 10, 64)
+	if err != nil {
+		return results, nil
+	}
+
+	block, err := a.backend.BlockByNumber(ctx, number)
+	if err == nil {
+		results = append(results, SearchResult{"block", q, block})
+	} else if err != storage.ErrNotFound {
+		return nil, err
+	}
+
+	forked, err := a.backend.ForkedBlockByNumber(ctx, number)
+	if err == nil {
+		results = append(results, SearchResult{"forkedblock", q, forked})
+	} else if err != storage.ErrNotFound {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// searchHash matches full hashes and hash prefixes, the latter can match several documents.
+func (a *ApiServer) searchHash(ctx context.Context, q string, results []SearchResult) ([]SearchResult, error) {
+	blocks, err := a.backend.BlocksByHashPrefix(ctx, q, searchLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range blocks {
+		results = append(results, SearchResult{"block", strconv.FormatUint(v.Number, 10), v})
+	}
+
+	txns, err := a.backend.TransactionsByHashPrefix(ctx, q, searchLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range txns {
+		results = append(results, SearchResult{"transaction", v.Hash, v})
+	}
+
+	uncles, err := a.backend.UnclesByHashPrefix(ctx, q, searchLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range uncles {
+		results = append(results, SearchResult{"uncle", v.Hash, v})
+	}
+
+	forked, err := a.backend.ForkedBlocksByHashPrefix(ctx, q, searchLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range forked {
+		results = append(results, SearchResult{"forkedblock", strconv.FormatUint(v.Number, 10), v})
+	}
+
+	return results, nil
+}
+
+// searchAddress returns the account, and the contract and token when the address is one.
+func (a *ApiServer) searchAddress(ctx context.Context, q string, results []SearchResult) ([]SearchResult, error) {
+	txns, err := a.backend.TxnCount(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	results = append(results, SearchResult{"address", q, map[string]int{"transactions": txns}})
+
+	creation, err := a.backend.TransactionByContractAddress(ctx, q)
+	if err == nil {
+		results = append(results, SearchResult{"contract", q, creation})
+	} else if err != storage.ErrNotFound {
+		return nil, err
+	}
+
+	transfers, err := a.backend.TokenTransferCountByContract(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	if transfers > 0 {
+		results = append(results, SearchResult{"token", q, map[string]int{"transfers": transfers}})
+	}
+
+	return results, nil
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubiq/spectrum-backend/models"
+	"github.com/ubiq/spectrum-backend/storage"
+	"github.com/ubiq/spectrum-backend/util"
+)
+
+type TokenRes struct {
+	Tokens []models.Token `json:"tokens"`
+	Total  int            `json:"total"`
+	Next   string         `json:"next,omitempty"`
+	Prev   string         `json:"prev,omitempty"`
+}
+
+type HolderRes struct {
+	Holders []models.TokenBalance `json:"holders"`
+	Total   int                   `json:"total"`
+	Next    string                `json:"next,omitempty"`
+	Prev    string                `json:"prev,omitempty"`
+}
+
+// tokenSet resolves the registry entries of the contracts of a response, once per contract.
+type tokenSet struct {
+	ctx     context.Context
+	backend *storage.MongoDB
+	tokens  map[string]*models.Token
+}
+
+func (a *ApiServer) newTokenSet(ctx context.Context) *tokenSet {
+	return &tokenSet{ctx, a.backend, make(map[string]*models.Token)}
+}
+
+// load looks up the contracts of transfers in one query.
+func (s *tokenSet) load(transfers []models.TokenTransfer) error {
+	var contracts []string
+	for _, v := range transfers {
+		if _, ok := s.tokens[v.Contract]; !ok {
+			s.tokens[v.Contract] = nil
+			contracts = append(contracts, v.Contract)
+		}
+	}
+	if len(contracts) == 0 {
+		return nil
+	}
+
+	tokens, err := s.backend.TokensByContract(s.ctx, contracts)
+	if err != nil {
+		return err
+	}
+	for k, v := range tokens {
+		v := v
+		s.tokens[k] = &v
+	}
+	return nil
+}
+
+// get returns the token of contract, nil when it's not a known ERC20 token.
+func (s *tokenSet) get(contract string) *models.Token {
+	t, ok := s.tokens[contract]
+	if !ok {
+		token, err := s.backend.Token(s.ctx, contract)
+		if err == nil {
+			t = &token
+		} else if err != storage.ErrNotFound {
+			log.Errorf("Error getting token %v: %v", contract, err)
+		}
+		s.tokens[contract] = t
+	}
+
+	// Contracts that answered no metadata can't be formatted
+	if t == nil || (t.Symbol == "" && t.TotalSupply == "") {
+		return nil
+	}
+	return t
+}
+
+// format fills the symbol and the value in token units of t.
+func (s *tokenSet) format(t *models.TokenTransfer) {
+	if token := s.get(t.Contract); token != nil {
+		t.Symbol = token.Symbol
+		t.FormattedValue = util.FormatUnits(t.Value, token.Decimals)
+	}
+}
+
+// formatTransfers fills the token fields of a page of transfers.
+func (a *ApiServer) formatTransfers(ctx context.Context, transfers []models.TokenTransfer) error {
+	s := a.newTokenSet(ctx)
+	if err := s.load(transfers); err != nil {
+		return err
+	}
+	for i := range transfers {
+		s.format(&transfers[i])
+	}
+	return nil
+}
+
+func (a *ApiServer) getTokens(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tokens, more, err := a.backend.Tokens(r.Context(), page.Page)
+	if err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+
+	count, err := a.backend.TokenCount(r.Context())
+	if err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+
+	contracts := make([]string, len(tokens))
+	for i, v := range tokens {
+		contracts[i] = v.Contract
+	}
+	holders, err := a.backend.HolderCounts(r.Context(), contracts)
+	if err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+	for i := range tokens {
+		tokens[i].Holders = holders[tokens[i].Contract]
+	}
+
+	var res TokenRes
+	res.Next, res.Prev = page.links(&tokens, more)
+	res.Tokens = tokens
+	res.Total = count
+
+	setLinks(w, res.Next, res.Prev)
+	a.sendJson(w, http.StatusOK, res)
+}
+
+func (a *ApiServer) getToken(w http.ResponseWriter, r *http.Request) {
+	contract := strings.ToLower(mux.Vars(r)["contract"])
+	if !addressRegex.MatchString(contract) {
+		a.sendError(w, http.StatusBadRequest, "invalid contract address")
+		return
+	}
+
+	token, err := a.backend.Token(r.Context(), contract)
+	if err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+
+	token.Holders, err = a.backend.TokenHolderCount(r.Context(), contract)
+	if err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+	a.sendJson(w, http.StatusOK, token)
+}
+
+func (a *ApiServer) getTokenHolders(w http.ResponseWriter, r *http.Request) {
+	contract := strings.ToLower(mux.Vars(r)["contract"])
+	if !addressRegex.MatchString(contract) {
+		a.sendError(w, http.StatusBadRequest, "invalid contract address")
+		return
+	}
+
+	page, err := parsePage(r)
+	if err != nil {
+		a.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	holders, more, err := a.backend.TokenHolders(r.Context(), contract, page.Page)
+	if err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+
+	count, err := a.backend.TokenHolderCount(r.Context(), contract)
+	if err != nil {
+		a.sendStorageError(w, err)
+		return
+	}
+
+	if token := a.newTokenSet(r.Context()).get(contract); token != nil {
+		for i := range holders {
+			holders[i].FormattedBalance = util.FormatUnits(holders[i].Balance, token.Decimals)
+		}
+	}
+
+	var res HolderRes
+	res.Next, res.Prev = page.links(&holders, more)
+	res.Holders = holders
+	res.Total = count
+
+	setLinks(w, res.Next, res.Prev)
+	a.sendJson(w, http.StatusOK, res)
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -13,6 +16,8 @@ import (
 	"github.com/ubiq/spectrum-backend/api"
 	"github.com/ubiq/spectrum-backend/config"
 	"github.com/ubiq/spectrum-backend/crawler"
+	"github.com/ubiq/spectrum-backend/health"
+	"github.com/ubiq/spectrum-backend/metrics"
 	"github.com/ubiq/spectrum-backend/rpc"
 	"github.com/ubiq/spectrum-backend/storage"
 )
@@ -32,13 +37,12 @@ func init() {
 	}
 }
 
-func readConfig(cfg *config.Config) {
+func readConfig(cfg *config.Config, conf string) {
 
-	if len(os.Args) == 1 {
+	if conf == "" {
 		log.Fatalln("Please specify config")
 	}
 
-	conf := os.Args[1]
 	conf, _ = filepath.Abs(conf)
 
 	log.Printf("Loading config: %v", conf)
@@ -59,13 +63,41 @@ func startCrawler(mongo *storage.MongoDB, rpc *rpc.RPCClient, cfg *crawler.Confi
 	c.Start()
 }
 
-func startApi(mongo *storage.MongoDB, cfg *api.Config) {
-	a := api.New(mongo, cfg)
+func startApi(mongo *storage.MongoDB, rpc *rpc.RPCClient, checker *health.Checker, cfg *api.Config) {
+	a := api.New(mongo, rpc, checker, cfg)
 	a.Start()
 }
 
+// startOps serves /metrics and the probes on their own listener, so metrics are never
+// exposed with the api and the crawler can be probed too.
+func startOps(mongo *storage.MongoDB, checker *health.Checker, listen string) {
+	metrics.NewCounterFunc("spectrum_mongo_reconnects_total", "Times the MongoDB connection was restored after being lost.", func() float64 {
+		return float64(mongo.Reconnects())
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", checker.Healthz)
+	mux.HandleFunc("/readyz", checker.Readyz)
+
+	log.Printf("Serving metrics and probes on %v", listen)
+	if err := http.ListenAndServe(listen, mux); err != nil {
+		log.Fatalf("Ops: %v", err)
+	}
+}
+
 func main() {
-	readConfig(&cfg)
+
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		snapshot(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) == 1 {
+		log.Fatalln("Please specify config")
+	}
+
+	readConfig(&cfg, os.Args[1])
 
 	if cfg.Threads > 0 {
 		runtime.GOMAXPROCS(cfg.Threads)
@@ -75,15 +107,20 @@ func main() {
 		log.Println("Running with 1 thread")
 	}
 
-	mongo, err := storage.NewConnection(&cfg.Mongo)
+	role := storage.RoleApi
+	if cfg.Crawler.Enabled {
+		role = storage.RoleCrawler
+	}
+
+	mongo, err := storage.NewConnection(&cfg.Mongo, role)
 
 	if err != nil {
 		log.Fatalf("Can't establish connection to mongo: %v", err)
 	} else {
-		log.Printf("Successfully connected to mongo at %v", cfg.Mongo.Address)
+		log.Printf("Successfully connected to mongo at %v as %v", strings.Join(mongo.Servers(), ", "), role)
 	}
 
-	err = mongo.Ping()
+	err = mongo.Ping(context.Background())
 
 	if err != nil {
 		log.Printf("Can't establish connection to mongo: %v", err)
@@ -93,12 +130,18 @@ func main() {
 
 	rpc := rpc.NewRPCClient(&cfg.Rpc)
 
+	checker := health.New(mongo, rpc, &cfg.Health)
+
+	if cfg.Ops.Enabled {
+		go startOps(mongo, checker, cfg.Ops.Listen)
+	}
+
 	// TODO: Should be safe to run both concurrently, but for now one or the other
 
 	if cfg.Crawler.Enabled && !cfg.Api.Enabled {
 		go startCrawler(mongo, rpc, &cfg.Crawler)
 	} else if cfg.Api.Enabled && !cfg.Crawler.Enabled {
-		go startApi(mongo, &cfg.Api)
+		go startApi(mongo, rpc, checker, &cfg.Api)
 	} else {
 		log.Fatalf("Cannot run both api and crawler services at the same time")
 	}
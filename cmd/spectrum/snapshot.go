@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ubiq/spectrum-backend/storage"
+)
+
+const snapshotUsage = `Usage:
+  spectrum snapshot export -config <config.json> -out <dir> [-height <block>] [-chunk <docs>] [-timeout <duration>]
+  spectrum snapshot import -config <config.json> -in <dir> [-timeout <duration>]`
+
+// snapshot handles "spectrum snapshot export|import", used to bootstrap new instances
+// without crawling the whole chain.
+func snapshot(args []string) {
+
+	if len(args) == 0 {
+		log.Fatalln(snapshotUsage)
+	}
+
+	flags := flag.NewFlagSet("snapshot "+args[0], flag.ExitOnError)
+
+	conf := flags.String("config", "", "path to the config file")
+	out := flags.String("out", "", "directory to write the snapshot to")
+	in := flags.String("in", "", "directory to read the snapshot from")
+	height := flags.Uint64("height", 0, "highest block to export, defaults to the indexed head")
+	chunk := flags.Int("chunk", 50000, "documents per chunk file")
+	timeout := flags.Duration("timeout", 24*time.Hour, "deadline for the whole export or import")
+
+	flags.Parse(args[1:])
+
+	readConfig(&cfg, *conf)
+
+	mongo, err := storage.NewConnection(&cfg.Mongo, storage.RoleCrawler)
+	if err != nil {
+		log.Fatalf("Can't establish connection to mongo: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch args[0] {
+	case "export":
+		if *out == "" || *chunk <= 0 {
+			log.Fatalln(snapshotUsage)
+		}
+
+		manifest, err := mongo.ExportSnapshot(ctx, *out, *height, *chunk)
+		if err != nil {
+			log.Fatalf("Snapshot export failed: %v", err)
+		}
+
+		log.Printf("Exported snapshot at block %v (%v) to %v", manifest.Height, manifest.Hash, *out)
+	case "import":
+		if *in == "" {
+			log.Fatalln(snapshotUsage)
+		}
+
+		manifest, err := mongo.ImportSnapshot(ctx, *in)
+		if err != nil {
+			log.Fatalf("Snapshot import failed: %v", err)
+		}
+
+		log.Printf("Imported snapshot at block %v (%v), the crawler will continue from there", manifest.Height, manifest.Hash)
+	default:
+		log.Errorln(snapshotUsage)
+		os.Exit(2)
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"github.com/ubiq/spectrum-backend/api"
 	"github.com/ubiq/spectrum-backend/crawler"
+	"github.com/ubiq/spectrum-backend/health"
 	"github.com/ubiq/spectrum-backend/rpc"
 	"github.com/ubiq/spectrum-backend/storage"
 )
@@ -13,6 +14,12 @@ type Config struct {
 	Mongo   storage.Config `json:"mongo"`
 	Rpc     rpc.Config     `json:"rpc"`
 	Api     api.Config     `json:"api"`
+	Health  health.Config  `json:"health"`
+	// Metrics and probes served apart from the api, in both roles
+	Ops struct {
+		Enabled bool   `json:"enabled"`
+		Listen  string `json:"listen"`
+	} `json:"ops"`
 }
 
 // {
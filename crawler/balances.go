@@ -0,0 +1,84 @@
+package crawler
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Balances are checked this many blocks below the latest indexed block, blocks above it may
+// still be written by concurrent syncs. Nodes keep the state of the recent blocks.
+const balanceCheckDepth = 64
+
+// CheckBalances compares the balances checked the longest time ago with balanceOf. It only
+// runs on a complete index, blocks indexed later would count their transfers twice.
+func (c *Crawler) CheckBalances(ctx context.Context) {
+	c.tokens.Lock()
+	if c.tokens.checking {
+		c.tokens.Unlock()
+		return
+	}
+	c.tokens.checking = true
+	c.tokens.Unlock()
+
+	defer func() {
+		c.tokens.Lock()
+		c.tokens.checking = false
+		c.tokens.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, maintenanceTimeout)
+	defer cancel()
+
+	if c.backend.IndexHead(ctx)[0] != 0 {
+		log.Debugf("Skipping balance check, the index is still syncing")
+		return
+	}
+
+	head, err := c.backend.LatestBlock(ctx)
+	if err != nil {
+		log.Errorf("Error getting latest block: %v", err)
+		return
+	}
+	if head.Number <= balanceCheckDepth {
+		return
+	}
+	block := head.Number - balanceCheckDepth
+
+	batch := c.cfg.Balances.Batch
+	if batch <= 0 {
+		batch = 1000
+	}
+
+	balances, err := c.backend.BalancesToCheck(ctx, batch)
+	if err != nil {
+		log.Errorf("Error getting balances to check: %v", err)
+		return
+	}
+
+	start := time.Now()
+	checked := 0
+
+	for _, v := range balances {
+		if ctx.Err() != nil {
+			log.Errorf("Balance check stopped: %v", ctx.Err())
+			return
+		}
+
+		balance, err := c.rpc.TokenBalance(v.Contract, v.Holder, block)
+		if err != nil {
+			log.Debugf("Could not get balance of %v in %v: %v", v.Holder, v.Contract, err)
+			// Checked anyway, contracts without balanceOf would hold the queue
+			balance = nil
+		}
+
+		if err := c.backend.CheckBalance(ctx, v.Contract, v.Holder, balance, block); err != nil {
+			log.Errorf("Error checking balance of %v in %v: %v", v.Holder, v.Contract, err)
+			continue
+		}
+		checked++
+	}
+
+	log.Printf("Checked %v token balances at block %v, took %v", checked, block, time.Since(start))
+}
@@ -1,6 +1,7 @@
 package crawler
 
 import (
+	"context"
 	"math/big"
 	"sync"
 
@@ -10,10 +11,10 @@ import (
 	"github.com/ubiq/spectrum-backend/util"
 )
 
-func (c *Crawler) SyncLoop() {
+func (c *Crawler) SyncLoop(ctx context.Context) {
 	var currentBlock uint64
 
-	indexHead := c.backend.IndexHead()
+	indexHead := c.backend.IndexHead(ctx)
 
 	syncUtility := NewSync()
 
@@ -23,7 +24,7 @@ func (c *Crawler) SyncLoop() {
 		syncUtility.setType("first")
 		c.state.syncing = true
 
-		startBlock, err := c.rpc.LatestBlockNumber()
+		startBlock, err := c.nodeHead()
 		if err != nil {
 			log.Errorf("Error getting blockNo: %v", err)
 		}
@@ -32,7 +33,7 @@ func (c *Crawler) SyncLoop() {
 		syncUtility.setType("top")
 		c.state.topsyncing = true
 
-		startBlock, err := c.rpc.LatestBlockNumber()
+		startBlock, err := c.nodeHead()
 		if err != nil {
 			log.Errorf("Error getting blockNo: %v", err)
 		}
@@ -49,9 +50,9 @@ func (c *Crawler) SyncLoop() {
 
 			// Purging last block from previous sync, in case it was half-synced
 			// WARNING: errors from purge can only be not found, we can safely ignore them
-			c.backend.Purge(currentBlock)
+			c.backend.Purge(ctx, currentBlock)
 		} else {
-			startBlock, err := c.rpc.LatestBlockNumber()
+			startBlock, err := c.nodeHead()
 			if err != nil {
 				log.Errorf("Error getting blockNo: %v", err)
 			}
@@ -61,8 +62,11 @@ func (c *Crawler) SyncLoop() {
 
 	syncUtility.setInit(currentBlock)
 
+	// Forked blocks replaced in this pass, consecutive ones are a single reorg
+	forked := 0
+
 mainloop:
-	for ; !c.backend.IsPresent(currentBlock); currentBlock-- {
+	for ; !c.backend.IsPresent(ctx, currentBlock); currentBlock-- {
 		block, err := c.rpc.GetBlockByHeight(currentBlock)
 
 		if err != nil {
@@ -71,10 +75,11 @@ mainloop:
 
 		syncUtility.add(1)
 
-		if isPresent, isForkedBlock := c.backend.IsInDB(currentBlock, block.Hash); isPresent && isForkedBlock {
-			go c.SyncForkedBlock(block, syncUtility)
+		if isPresent, isForkedBlock := c.backend.IsInDB(ctx, currentBlock, block.Hash); isPresent && isForkedBlock {
+			forked++
+			go c.SyncForkedBlock(ctx, block, syncUtility)
 		} else if !isPresent {
-			go c.Sync(block, syncUtility)
+			go c.Sync(ctx, block, syncUtility)
 		} else {
 			break mainloop
 		}
@@ -86,37 +91,44 @@ mainloop:
 
 	syncUtility.close(currentBlock)
 
+	if forked > 0 {
+		reorgs.Inc()
+		reorgDepth.Observe(float64(forked))
+	}
+
 	if syncUtility.synctype == "back" || syncUtility.synctype == "first" {
 		c.state.syncing = false
 	}
 
 }
 
-func (c *Crawler) SyncForkedBlock(block *models.Block, syncUtility Sync) {
+func (c *Crawler) SyncForkedBlock(ctx context.Context, block *models.Block, syncUtility Sync) {
 
 	height := block.Number
 
-	dbblock, err := c.backend.GetBlock(height)
+	dbblock, err := c.backend.GetBlock(ctx, height)
 	if err != nil {
 		log.Errorf("Error getting forked block: %v", err)
 	}
 
-	c.backend.AddForkedBlock(dbblock)
-	c.backend.Purge(height)
+	c.backend.AddForkedBlock(ctx, dbblock)
+	c.backend.Purge(ctx, height)
 
 	log.Warnf("Reorg detected at block: %v", block.Number)
 	log.Warnf("HEAD - %v %v", block.Number, block.Hash)
 	log.Warnf("FORKED - %v %v", dbblock.Number, dbblock.Hash)
 
-	c.Sync(block, syncUtility)
+	c.Sync(ctx, block, syncUtility)
 
 }
 
-func (c *Crawler) Sync(block *models.Block, syncUtility Sync) {
+func (c *Crawler) Sync(ctx context.Context, block *models.Block, syncUtility Sync) {
 
 	syncUtility.recieve()
 
-	var tokentransfers int
+	var txns []*models.Transaction
+	var transfers []*models.TokenTransfer
+	var uncles []*models.Uncle
 
 	uncleRewards := big.NewInt(0)
 	avgGasPrice := big.NewInt(0)
@@ -126,11 +138,11 @@ func (c *Crawler) Sync(block *models.Block, syncUtility Sync) {
 	blockReward := util.CaculateBlockReward(block.Number, len(block.Uncles))
 
 	if len(block.Transactions) > 0 {
-		avgGasPrice, txFees, tokentransfers = c.ProcessTransactions(block.Transactions, block.Timestamp)
+		avgGasPrice, txFees, txns, transfers = c.ProcessTransactions(block.Transactions, block.Timestamp)
 	}
 
 	if len(block.Uncles) > 0 {
-		uncleRewards = c.ProcessUncles(block.Uncles, block.Number)
+		uncleRewards, uncles = c.ProcessUncles(block.Uncles, block.Number)
 	}
 
 	minted.Add(blockReward, uncleRewards)
@@ -140,31 +152,38 @@ func (c *Crawler) Sync(block *models.Block, syncUtility Sync) {
 	block.TxFees = txFees.String()
 	block.UnclesReward = uncleRewards.String()
 
-	err := c.backend.UpdateStore(block, syncUtility.synctype)
+	err := c.backend.UpdateStore(ctx, block, syncUtility.synctype)
 	if err != nil {
 		log.Errorf("Error updating sysStore: %v", err)
 	}
 
-	err = c.backend.AddBlock(block)
+	err = c.backend.AddBlockData(ctx, block, txns, transfers, uncles)
 	if err != nil {
-		log.Errorf("Error adding block: %v", err)
+		log.Errorf("Error adding block data: %v", err)
+	} else {
+		indexedHead.SetMax(float64(block.Number))
+		blocksIndexed.Inc()
+		txnsIndexed.Add(float64(len(txns)))
+		transfersIndexed.Add(float64(len(transfers)))
+		c.registerTokens(ctx, transfers)
 	}
 
-	syncUtility.log(block.Number, block.Txs, tokentransfers, block.UncleNo)
+	syncUtility.log(block.Number, block.Txs, len(transfers), block.UncleNo)
 	syncUtility.send(block.Number - 1)
 	syncUtility.done()
 }
 
-func (c *Crawler) ProcessUncles(uncles []string, height uint64) *big.Int {
+func (c *Crawler) ProcessUncles(uncles []string, height uint64) (*big.Int, []*models.Uncle) {
 
 	uncleRewards := big.NewInt(0)
+	result := make([]*models.Uncle, 0, len(uncles))
 
 	for k, _ := range uncles {
 
 		uncle, err := c.rpc.GetUncleByBlockNumberAndIndex(height, k)
 		if err != nil {
 			log.Errorf("Error getting uncle: %v", err)
-			return big.NewInt(0)
+			return big.NewInt(0), nil
 		}
 
 		uncleReward := util.CaculateUncleReward(height, uncle.Number)
@@ -174,43 +193,35 @@ func (c *Crawler) ProcessUncles(uncles []string, height uint64) *big.Int {
 		uncle.BlockNumber = height
 		uncle.Reward = uncleReward.String()
 
-		err = c.backend.AddUncle(uncle)
-
-		if err != nil {
-			log.Errorf("Error inserting uncle into backend: %v", err)
-			return big.NewInt(0)
-		}
+		result = append(result, uncle)
 	}
-	return uncleRewards
+	return uncleRewards, result
 }
 
-func (c *Crawler) ProcessTransactions(txs []models.RawTransaction, timestamp uint64) (*big.Int, *big.Int, int) {
+func (c *Crawler) ProcessTransactions(txs []models.RawTransaction, timestamp uint64) (*big.Int, *big.Int, []*models.Transaction, []*models.TokenTransfer) {
 
 	var twg sync.WaitGroup
 
 	data := &data{
 		avgGasPrice:    big.NewInt(0),
 		txFees:         big.NewInt(0),
-		tokentransfers: 0,
+		txns:           make([]*models.Transaction, len(txs)),
+		tokentransfers: make([]*models.TokenTransfer, 0),
 	}
 
 	twg.Add(len(txs))
 
-	for _, v := range txs {
-		go c.processTransaction(v, timestamp, data, &twg)
+	for i, v := range txs {
+		go c.processTransaction(i, v, timestamp, data, &twg)
 	}
 	twg.Wait()
-	return data.avgGasPrice.Div(data.avgGasPrice, big.NewInt(int64(len(txs)))), data.txFees, data.tokentransfers
+	return data.avgGasPrice.Div(data.avgGasPrice, big.NewInt(int64(len(txs)))), data.txFees, data.txns, data.tokentransfers
 }
 
-func (c *Crawler) processTransaction(rt models.RawTransaction, timestamp uint64, data *data, twg *sync.WaitGroup) {
+func (c *Crawler) processTransaction(i int, rt models.RawTransaction, timestamp uint64, data *data, twg *sync.WaitGroup) {
 
 	v := rt.Convert()
 
-	// Create a channel
-
-	ch := make(chan struct{}, 1)
-
 	receipt, err := c.rpc.GetTxReceipt(v.Hash)
 	if err != nil {
 		log.Errorf("Error getting tx receipt: %v", err)
@@ -230,43 +241,34 @@ func (c *Crawler) processTransaction(rt models.RawTransaction, timestamp uint64,
 	v.GasUsed = receipt.GasUsed
 	v.ContractAddress = receipt.ContractAddress
 	v.Logs = receipt.Logs
+	v.CumulativeGasUsed = receipt.CumulativeGasUsed
+	v.Status = receipt.Status
+	v.LogsBloom = receipt.LogsBloom
 
 	if v.IsTokenTransfer() {
-		// Here we fork to a secondary process to insert the token transfer.
-		// We use the channel to block the function util the token transfer is inserted.
+		tktx := c.processTokenTransfer(v)
+
 		data.Lock()
-		data.tokentransfers++
+		data.tokentransfers = append(data.tokentransfers, tktx)
 		data.Unlock()
-		go c.processTokenTransfer(v, ch)
 	}
 
-	err = c.backend.AddTransaction(v)
-	if err != nil {
-		log.Errorf("Error inserting tx into backend: %#v", err)
-
-	}
+	// Each routine owns its own slot, no locking needed
+	data.txns[i] = v
 
-	if v.IsTokenTransfer() {
-		<-ch
-	}
 	twg.Done()
 }
 
-func (c *Crawler) processTokenTransfer(v *models.Transaction, ch chan struct{}) {
+func (c *Crawler) processTokenTransfer(v *models.Transaction) *models.TokenTransfer {
 
 	tktx := v.GetTokenTransfer()
 
 	tktx.BlockNumber = v.BlockNumber
+	tktx.TransactionIndex = v.TransactionIndex
 	tktx.Hash = v.Hash
 	tktx.Timestamp = v.Timestamp
 
-	err := c.backend.AddTokenTransfer(tktx)
-	if err != nil {
-		log.Errorf("Error processing token transfer into backend: %v", err)
-	}
-
-	ch <- struct{}{}
-
+	return tktx
 }
 
 func (c *Crawler) getPrice() string {
@@ -1,6 +1,7 @@
 package crawler
 
 import (
+	"context"
 	"math/big"
 	"net/http"
 	"net/url"
@@ -8,16 +9,37 @@ import (
 	"sync"
 	"time"
 
-	mgo "github.com/globalsign/mgo"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/ubiq/spectrum-backend/models"
+	"github.com/ubiq/spectrum-backend/storage"
 )
 
 type Config struct {
 	Enabled     bool   `json:"enabled"`
 	Interval    string `json:"interval"`
 	MaxRoutines int    `json:"routines"`
+	// Interval between counter reconciliations, defaults to 1h
+	Reconcile string `json:"reconcile"`
+	// Interval between token metadata refreshes, defaults to 6h
+	Tokens string `json:"tokens"`
+	// Token balances checked against balanceOf, every interval (defaults to 1h) up to batch
+	// of them (defaults to 1000) starting with the ones checked the longest time ago
+	Balances struct {
+		Interval string `json:"interval"`
+		Batch    int    `json:"batch"`
+	} `json:"balances"`
+	Retention struct {
+		Enabled  bool   `json:"enabled"`
+		Interval string `json:"interval"`
+		Batch    uint64 `json:"batch"`
+		// Drop transaction input and logs older than this many blocks, 0 keeps everything
+		TxData uint64 `json:"txdata"`
+		// Keep only block headers below this height, 0 keeps everything
+		HeadersBefore uint64 `json:"headersbefore"`
+		// Maximum number of forked blocks to keep, 0 keeps everything
+		ForkedBlocks int `json:"forkedblocks"`
+	} `json:"retention"`
 }
 
 type RPCClient interface {
@@ -27,39 +49,60 @@ type RPCClient interface {
 	GetUncleByBlockNumberAndIndex(height uint64, index int) (*models.Uncle, error)
 	LatestBlockNumber() (uint64, error)
 	GetTxReceipt(hash string) (*models.TxReceipt, error)
+	GetToken(contract string) (*models.Token, error)
+	TokenBalance(contract, holder string, block uint64) (*big.Int, error)
 	Ping() error
 }
 
 type Database interface {
 	// Init
-	Init()
+	Init(ctx context.Context)
+	InitIndex(ctx context.Context)
 
 	// storage
-	IsFirstRun() bool
-	IsPresent(height uint64) bool
-	IsInDB(height uint64, hash string) (bool, bool)
-	IndexHead() [1]uint64
-	UpdateStore(latestBlock *models.Block, synctype string) error
-	SupplyObject(symbol string) (models.Store, error)
-	UpdateSupply(ticker string, new *models.Store) error
-	GetBlock(height uint64) (*models.Block, error)
-	Purge(height uint64)
-	Ping() error
+	IsFirstRun(ctx context.Context) bool
+	IsPresent(ctx context.Context, height uint64) bool
+	IsInDB(ctx context.Context, height uint64, hash string) (bool, bool)
+	IndexHead(ctx context.Context) [1]uint64
+	UpdateStore(ctx context.Context, latestBlock *models.Block, synctype string) error
+	SupplyObject(ctx context.Context, symbol string) (models.Store, error)
+	UpdateSupply(ctx context.Context, ticker string, new *models.Store) error
+	GetBlock(ctx context.Context, height uint64) (*models.Block, error)
+	Purge(ctx context.Context, height uint64)
+	Ping(ctx context.Context) error
+	BackfillActivity(ctx context.Context)
+	ReconcileCounters(ctx context.Context)
+
+	// tokens
+	Token(ctx context.Context, contract string) (models.Token, error)
+	AddToken(ctx context.Context, t *models.Token) error
+	UpdateToken(ctx context.Context, t *models.Token) error
+	TransferContracts(ctx context.Context) ([]models.Token, error)
+	BackfillBalances(ctx context.Context)
+	BalancesToCheck(ctx context.Context, limit int) ([]models.TokenBalance, error)
+	CheckBalance(ctx context.Context, contract, holder string, balance *big.Int, block uint64) error
+	LatestBlock(ctx context.Context) (models.Block, error)
+
+	// retention
+	PruneTxData(ctx context.Context, below uint64, batch uint64) (int, error)
+	PruneBodies(ctx context.Context, below uint64, batch uint64) (int, error)
+	CapForkedBlocks(ctx context.Context, max int, batch int) (int, error)
 
 	// iterators
-	GetTxnCounts(days int) *mgo.Iter
-	GetBlocks(days int) *mgo.Iter
-	BlocksIter(blockno uint64) *mgo.Iter
-	GetTokenTransfers(contractAddress, address string, after int64) *mgo.Iter
+	GetTxnCounts(ctx context.Context, days int) *storage.Iter
+	GetBlocks(ctx context.Context, days int) *storage.Iter
+	BlocksIter(ctx context.Context, blockno uint64) *storage.Iter
+	GetTokenTransfers(ctx context.Context, contractAddress, address string, after int64) *storage.Iter
 
 	// setters
-	AddTransaction(tx *models.Transaction) error
-	AddTokenTransfer(tt *models.TokenTransfer) error
-	AddUncle(u *models.Uncle) error
-	AddBlock(b *models.Block) error
-	AddForkedBlock(b *models.Block) error
-	AddLineChart(t *models.LineChart) error
-	AddMLChart(t *models.MLineChart) error
+	AddTransaction(ctx context.Context, tx *models.Transaction) error
+	AddTokenTransfer(ctx context.Context, tt *models.TokenTransfer) error
+	AddUncle(ctx context.Context, u *models.Uncle) error
+	AddBlock(ctx context.Context, b *models.Block) error
+	AddBlockData(ctx context.Context, b *models.Block, txs []*models.Transaction, transfers []*models.TokenTransfer, uncles []*models.Uncle) error
+	AddForkedBlock(ctx context.Context, b *models.Block) error
+	AddLineChart(ctx context.Context, t *models.LineChart) error
+	AddMLChart(ctx context.Context, t *models.MLineChart) error
 }
 
 type Crawler struct {
@@ -70,7 +113,13 @@ type Crawler struct {
 		syncing    bool
 		topsyncing bool
 	}
-	price string
+	price  string
+	tokens struct {
+		sync.Mutex
+		known      map[string]bool
+		refreshing bool
+		checking   bool
+	}
 }
 
 type apiResponse struct {
@@ -95,7 +144,8 @@ type apiResponse struct {
 
 type data struct {
 	avgGasPrice, txFees *big.Int
-	tokentransfers      int
+	txns                []*models.Transaction
+	tokentransfers      []*models.TokenTransfer
 	sync.Mutex
 }
 
@@ -126,7 +176,19 @@ func (l *logObject) clear() {
 var client = &http.Client{Timeout: 60 * time.Second}
 
 func New(db Database, rpc RPCClient, cfg *Config) *Crawler {
-	return &Crawler{db, rpc, cfg, struct{ syncing, topsyncing bool }{false, false}, "0.00000000"}
+	c := &Crawler{backend: db, rpc: rpc, cfg: cfg, price: "0.00000000"}
+	c.tokens.known = make(map[string]bool)
+	return c
+}
+
+// Backfills, reconciliations and pruning run long queries, they get their own deadline
+const maintenanceTimeout = time.Hour
+
+func (c *Crawler) reconcile(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, maintenanceTimeout)
+	defer cancel()
+
+	c.backend.ReconcileCounters(ctx)
 }
 
 func (c *Crawler) Start() {
@@ -143,27 +205,76 @@ func (c *Crawler) Start() {
 		}
 	}
 
-	if c.backend.IsFirstRun() {
-		c.backend.Init()
+	ctx := context.Background()
+
+	if c.backend.IsFirstRun(ctx) {
+		c.backend.Init(ctx)
+	} else {
+		c.backend.InitIndex(ctx)
 	}
 
+	// Counters are reconciled once the activity index is complete, this also seeds them on
+	// databases created before they existed
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, maintenanceTimeout)
+		defer cancel()
+
+		c.backend.BackfillActivity(ctx)
+		c.backend.BackfillBalances(ctx)
+		c.backend.ReconcileCounters(ctx)
+	}()
+
 	interval, err := time.ParseDuration(c.cfg.Interval)
 	if err != nil {
 		log.Fatalf("Crawler: can't parse duration: %v", err)
 	}
 
+	reconcile := time.Hour
+	if c.cfg.Reconcile != "" {
+		reconcile, err = time.ParseDuration(c.cfg.Reconcile)
+		if err != nil {
+			log.Fatalf("Crawler: can't parse reconcile duration: %v", err)
+		}
+	}
+
 	ticker := time.NewTicker(interval)
 	ticker2 := time.NewTicker(10 * time.Minute)
+	ticker3 := time.NewTicker(reconcile)
+
+	tokens := 6 * time.Hour
+	if c.cfg.Tokens != "" {
+		tokens, err = time.ParseDuration(c.cfg.Tokens)
+		if err != nil {
+			log.Fatalf("Crawler: can't parse tokens duration: %v", err)
+		}
+	}
+	ticker4 := time.NewTicker(tokens)
+
+	balances := time.Hour
+	if c.cfg.Balances.Interval != "" {
+		balances, err = time.ParseDuration(c.cfg.Balances.Interval)
+		if err != nil {
+			log.Fatalf("Crawler: can't parse balances duration: %v", err)
+		}
+	}
+	ticker5 := time.NewTicker(balances)
 
 	log.Printf("Block refresh interval: %v", interval)
 
-	go c.SyncLoop()
-	c.StoreUbqSupply()
-	c.StoreQwarkSupply()
-	c.ChartBlocktime()
-	c.ChartMinedBlocks()
-	c.ChartBlocks()
-	c.ChartTxns()
+	if c.cfg.Retention.Enabled {
+		go c.startPruner(ctx)
+	}
+
+	go c.SyncLoop(ctx)
+	c.StoreUbqSupply(ctx)
+	c.StoreQwarkSupply(ctx)
+	c.ChartBlocktime(ctx)
+	c.ChartMinedBlocks(ctx)
+	c.ChartBlocks(ctx)
+	c.ChartTxns(ctx)
+
+	// Also registers the tokens transferred before the registry existed
+	go c.RefreshTokens(ctx)
 
 	go func() {
 		for {
@@ -171,15 +282,24 @@ func (c *Crawler) Start() {
 			case <-ticker.C:
 				log.Debugf("Loop: %v, sync: %v", time.Now().UTC(), c.state.syncing)
 				c.fetchPrice()
-				c.StoreUbqSupply()
-				go c.SyncLoop()
+				c.StoreUbqSupply(ctx)
+				go c.SyncLoop(ctx)
 			case <-ticker2.C:
 				log.Debugf("Chart Loop: %v", time.Now().UTC())
-				go c.StoreQwarkSupply()
-				go c.ChartBlocktime()
-				go c.ChartMinedBlocks()
-				go c.ChartTxns()
-				go c.ChartBlocks()
+				go c.StoreQwarkSupply(ctx)
+				go c.ChartBlocktime(ctx)
+				go c.ChartMinedBlocks(ctx)
+				go c.ChartTxns(ctx)
+				go c.ChartBlocks(ctx)
+			case <-ticker3.C:
+				log.Debugf("Reconcile Loop: %v", time.Now().UTC())
+				go c.reconcile(ctx)
+			case <-ticker4.C:
+				log.Debugf("Token Loop: %v", time.Now().UTC())
+				go c.RefreshTokens(ctx)
+			case <-ticker5.C:
+				log.Debugf("Balance Loop: %v", time.Now().UTC())
+				go c.CheckBalances(ctx)
 			}
 		}
 	}()
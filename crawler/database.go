@@ -1,6 +1,7 @@
 package crawler
 
 import (
+	"context"
 	"math/big"
 	"sort"
 	"strconv"
@@ -59,13 +60,13 @@ func (c *chartdata) print() {
 
 // Functions here are used to iterate through different objects and extract chart data
 
-func (c *Crawler) ChartTxns() {
+func (c *Crawler) ChartTxns(ctx context.Context) {
 	var transaction models.Transaction
 
 	start := time.Now()
 	log.Debugf("Start txns gather loop: %v", start)
 
-	iter := c.backend.GetTxnCounts(0)
+	iter := c.backend.GetTxnCounts(ctx, 0)
 
 	data := make(map[string]int)
 
@@ -124,7 +125,8 @@ func (c *Crawler) ChartTxns() {
 			Values: values,
 		}
 
-		c.backend.AddLineChart(doc)
+		c.backend.AddLineChart(ctx, doc)
+		chartDuration.Since(start, "txns")
 		log.Debugf("End txns loop: %v", time.Since(start))
 
 	}
@@ -142,13 +144,13 @@ func (b *block_chart_data) Add(bcd interface{}) {
 	b.blocks.Add(b.blocks, bcd.(*block_chart_data).blocks)
 }
 
-func (c *Crawler) ChartBlocks() {
+func (c *Crawler) ChartBlocks(ctx context.Context) {
 	var block models.Block
 
 	start := time.Now()
 	log.Debugf("Start block gather loop: %v", start)
 
-	iter := c.backend.GetBlocks(0)
+	iter := c.backend.GetBlocks(ctx, 0)
 
 	data := &chartdata{}
 	data.init()
@@ -258,12 +260,13 @@ func (c *Crawler) ChartBlocks() {
 			Values: blocktime,
 		}
 
-		c.backend.AddLineChart(avggasprice_c)
-		c.backend.AddLineChart(gaslimit_c)
-		c.backend.AddLineChart(difficulty_c)
-		c.backend.AddLineChart(hashrate_c)
-		c.backend.AddLineChart(blocktime_c)
+		c.backend.AddLineChart(ctx, avggasprice_c)
+		c.backend.AddLineChart(ctx, gaslimit_c)
+		c.backend.AddLineChart(ctx, difficulty_c)
+		c.backend.AddLineChart(ctx, hashrate_c)
+		c.backend.AddLineChart(ctx, blocktime_c)
 
+		chartDuration.Since(start, "blocks")
 		log.Debugf("End blocks loop: %v", time.Since(start))
 	}
 }
@@ -283,7 +286,7 @@ func (u *btime) set(ns string) {
 	u.stamp = ns
 }
 
-func (c *Crawler) ChartBlocktime() {
+func (c *Crawler) ChartBlocktime(ctx context.Context) {
 	var block models.Block
 	var wg sync.WaitGroup
 	var routines int
@@ -292,7 +295,7 @@ func (c *Crawler) ChartBlocktime() {
 	start := time.Now()
 	log.Debugf("Start blocktime gather loop: %v", start)
 
-	iter := c.backend.GetBlocks(365)
+	iter := c.backend.GetBlocks(ctx, 365)
 
 	data := make(map[string]*big.Int)
 
@@ -391,8 +394,9 @@ func (c *Crawler) ChartBlocktime() {
 			Values: blocktime,
 		}
 
-		c.backend.AddLineChart(blocktime)
+		c.backend.AddLineChart(ctx, blocktime)
 
+		chartDuration.Since(start, "blocktime88")
 		log.Debugf("End blocktime loop: %v", time.Since(start))
 	}
 }
@@ -429,13 +433,13 @@ func (p *mined_blocks) Map() map[string]string {
 	return result
 }
 
-func (c *Crawler) ChartMinedBlocks() {
+func (c *Crawler) ChartMinedBlocks(ctx context.Context) {
 	var block models.Block
 
 	start := time.Now()
 	log.Debugf("Start hashrate gather loop: %v", start)
 
-	iter := c.backend.GetBlocks(0)
+	iter := c.backend.GetBlocks(ctx, 0)
 
 	data := &chartdata{}
 	data.init()
@@ -506,21 +510,22 @@ func (c *Crawler) ChartMinedBlocks() {
 			Values: blocks,
 		}
 
-		c.backend.AddMLChart(hashrateChart)
+		c.backend.AddMLChart(ctx, hashrateChart)
 
+		chartDuration.Since(start, "minedblocks")
 		log.Debugf("End hashrate loop: %v", time.Since(start))
 	}
 }
 
-func (c *Crawler) StoreUbqSupply() {
+func (c *Crawler) StoreUbqSupply(ctx context.Context) {
 	var block models.Block
 
 	start := time.Now()
 	log.Debugf("Start ubq supply gather loop: %v", start)
 
-	store, err := c.backend.SupplyObject("ubq")
+	store, err := c.backend.SupplyObject(ctx, "ubq")
 
-	iter := c.backend.BlocksIter(store.LatestBlock.Number)
+	iter := c.backend.BlocksIter(ctx, store.LatestBlock.Number)
 
 	s, _ := big.NewInt(0).SetString(store.Supply, 10)
 
@@ -567,24 +572,24 @@ func (c *Crawler) StoreUbqSupply() {
 			Price:       c.price,
 		}
 
-		c.backend.UpdateSupply("ubq", new_supply)
+		c.backend.UpdateSupply(ctx, "ubq", new_supply)
 
 		log.Debugf("End ubq supply loop: %v", time.Since(start))
 	}
 }
 
-func (c *Crawler) StoreQwarkSupply() {
+func (c *Crawler) StoreQwarkSupply(ctx context.Context) {
 	var tokentx models.TokenTransfer
 
 	start := time.Now()
 	log.Debugf("Start qwark supply gather loop: %v", start)
 
-	store, err := c.backend.SupplyObject("qwark")
+	store, err := c.backend.SupplyObject(ctx, "qwark")
 
 	// 0x4b4899a10f3e507db207b0ee2426029efa168a67 -- Qwark token address
 	// 0xae3f04584446aa081cd98011f80f19977f8c10e0 -- Infinitum flame
 
-	iter := c.backend.GetTokenTransfers("0x4b4899a10f3e507db207b0ee2426029efa168a67", "0xae3f04584446aa081cd98011f80f19977f8c10e0", store.Timestamp)
+	iter := c.backend.GetTokenTransfers(ctx, "0x4b4899a10f3e507db207b0ee2426029efa168a67", "0xae3f04584446aa081cd98011f80f19977f8c10e0", store.Timestamp)
 
 	if err != nil {
 		log.Errorf("Error retrieving store/supply: %v", err)
@@ -629,7 +634,7 @@ func (c *Crawler) StoreQwarkSupply() {
 			Supply:    s.String(),
 		}
 
-		c.backend.UpdateSupply("qwark", new_supply)
+		c.backend.UpdateSupply(ctx, "qwark", new_supply)
 
 		log.Debugf("End qwark supply loop: %v", time.Since(start))
 	}
@@ -0,0 +1,39 @@
+package crawler
+
+import (
+	"github.com/ubiq/spectrum-backend/metrics"
+)
+
+// Throughput is exposed as counters, blocks per second is their rate
+var (
+	indexedHead   = metrics.NewGauge("spectrum_crawler_indexed_head", "Highest block indexed since the crawler started.")
+	nodeHeadGauge = metrics.NewGauge("spectrum_crawler_node_head", "Latest block number reported by the node.")
+
+	blocksIndexed    = metrics.NewCounter("spectrum_crawler_blocks_total", "Blocks indexed.")
+	txnsIndexed      = metrics.NewCounter("spectrum_crawler_transactions_total", "Transactions indexed.")
+	transfersIndexed = metrics.NewCounter("spectrum_crawler_transfers_total", "Token transfers indexed.")
+
+	reorgs     = metrics.NewCounter("spectrum_crawler_reorgs_total", "Chain reorganizations detected.")
+	reorgDepth = metrics.NewHistogram("spectrum_crawler_reorg_depth_blocks", "Blocks replaced by a reorganization.", []float64{1, 2, 3, 5, 10, 20, 50, 100})
+
+	chartDuration = metrics.NewHistogram("spectrum_crawler_chart_duration_seconds", "Duration of chart jobs by chart.", []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800}, "chart")
+)
+
+func init() {
+	metrics.NewGaugeFunc("spectrum_crawler_head_lag_blocks", "Blocks the indexed head is behind the node head.", func() float64 {
+		indexed, node := indexedHead.Value(), nodeHeadGauge.Value()
+		if indexed == 0 || node < indexed {
+			return 0
+		}
+		return node - indexed
+	})
+}
+
+// nodeHead returns the latest block number of the node.
+func (c *Crawler) nodeHead() (uint64, error) {
+	number, err := c.rpc.LatestBlockNumber()
+	if err == nil {
+		nodeHeadGauge.Set(float64(number))
+	}
+	return number, err
+}
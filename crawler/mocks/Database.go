@@ -2,22 +2,24 @@
 
 package mocks
 
-import mgo "github.com/globalsign/mgo"
+import context "context"
 import mock "github.com/stretchr/testify/mock"
 import models "github.com/ubiq/spectrum-backend/models"
+import storage "github.com/ubiq/spectrum-backend/storage"
+import big "math/big"
 
 // Database is an autogenerated mock type for the Database type
 type Database struct {
 	mock.Mock
 }
 
-// AddBlock provides a mock function with given fields: b
-func (_m *Database) AddBlock(b *models.Block) error {
-	ret := _m.Called(b)
+// AddBlock provides a mock function with given fields: ctx, b
+func (_m *Database) AddBlock(ctx context.Context, b *models.Block) error {
+	ret := _m.Called(ctx, b)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*models.Block) error); ok {
-		r0 = rf(b)
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Block) error); ok {
+		r0 = rf(ctx, b)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -25,13 +27,13 @@ func (_m *Database) AddBlock(b *models.Block) error {
 	return r0
 }
 
-// AddForkedBlock provides a mock function with given fields: b
-func (_m *Database) AddForkedBlock(b *models.Block) error {
-	ret := _m.Called(b)
+// AddBlockData provides a mock function with given fields: ctx, b, txs, transfers, uncles
+func (_m *Database) AddBlockData(ctx context.Context, b *models.Block, txs []*models.Transaction, transfers []*models.TokenTransfer, uncles []*models.Uncle) error {
+	ret := _m.Called(ctx, b, txs, transfers, uncles)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*models.Block) error); ok {
-		r0 = rf(b)
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Block, []*models.Transaction, []*models.TokenTransfer, []*models.Uncle) error); ok {
+		r0 = rf(ctx, b, txs, transfers, uncles)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -39,13 +41,13 @@ func (_m *Database) AddForkedBlock(b *models.Block) error {
 	return r0
 }
 
-// AddLineChart provides a mock function with given fields: t
-func (_m *Database) AddLineChart(t *models.LineChart) error {
-	ret := _m.Called(t)
+// AddForkedBlock provides a mock function with given fields: ctx, b
+func (_m *Database) AddForkedBlock(ctx context.Context, b *models.Block) error {
+	ret := _m.Called(ctx, b)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*models.LineChart) error); ok {
-		r0 = rf(t)
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Block) error); ok {
+		r0 = rf(ctx, b)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -53,13 +55,13 @@ func (_m *Database) AddLineChart(t *models.LineChart) error {
 	return r0
 }
 
-// AddMLChart provides a mock function with given fields: t
-func (_m *Database) AddMLChart(t *models.MLineChart) error {
-	ret := _m.Called(t)
+// AddLineChart provides a mock function with given fields: ctx, t
+func (_m *Database) AddLineChart(ctx context.Context, t *models.LineChart) error {
+	ret := _m.Called(ctx, t)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*models.MLineChart) error); ok {
-		r0 = rf(t)
+	if rf, ok := ret.Get(0).(func(context.Context, *models.LineChart) error); ok {
+		r0 = rf(ctx, t)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -67,13 +69,13 @@ func (_m *Database) AddMLChart(t *models.MLineChart) error {
 	return r0
 }
 
-// AddTokenTransfer provides a mock function with given fields: tt
-func (_m *Database) AddTokenTransfer(tt *models.TokenTransfer) error {
-	ret := _m.Called(tt)
+// AddMLChart provides a mock function with given fields: ctx, t
+func (_m *Database) AddMLChart(ctx context.Context, t *models.MLineChart) error {
+	ret := _m.Called(ctx, t)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*models.TokenTransfer) error); ok {
-		r0 = rf(tt)
+	if rf, ok := ret.Get(0).(func(context.Context, *models.MLineChart) error); ok {
+		r0 = rf(ctx, t)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -81,13 +83,13 @@ func (_m *Database) AddTokenTransfer(tt *models.TokenTransfer) error {
 	return r0
 }
 
-// AddTransaction provides a mock function with given fields: tx
-func (_m *Database) AddTransaction(tx *models.Transaction) error {
-	ret := _m.Called(tx)
+// AddToken provides a mock function with given fields: ctx, t
+func (_m *Database) AddToken(ctx context.Context, t *models.Token) error {
+	ret := _m.Called(ctx, t)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*models.Transaction) error); ok {
-		r0 = rf(tx)
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Token) error); ok {
+		r0 = rf(ctx, t)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -95,13 +97,13 @@ func (_m *Database) AddTransaction(tx *models.Transaction) error {
 	return r0
 }
 
-// AddUncle provides a mock function with given fields: u
-func (_m *Database) AddUncle(u *models.Uncle) error {
-	ret := _m.Called(u)
+// AddTokenTransfer provides a mock function with given fields: ctx, tt
+func (_m *Database) AddTokenTransfer(ctx context.Context, tt *models.TokenTransfer) error {
+	ret := _m.Called(ctx, tt)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*models.Uncle) error); ok {
-		r0 = rf(u)
+	if rf, ok := ret.Get(0).(func(context.Context, *models.TokenTransfer) error); ok {
+		r0 = rf(ctx, tt)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -109,29 +111,125 @@ func (_m *Database) AddUncle(u *models.Uncle) error {
 	return r0
 }
 
-// BlocksIter provides a mock function with given fields: blockno
-func (_m *Database) BlocksIter(blockno uint64) *mgo.Iter {
-	ret := _m.Called(blockno)
+// AddTransaction provides a mock function with given fields: ctx, tx
+func (_m *Database) AddTransaction(ctx context.Context, tx *models.Transaction) error {
+	ret := _m.Called(ctx, tx)
 
-	var r0 *mgo.Iter
-	if rf, ok := ret.Get(0).(func(uint64) *mgo.Iter); ok {
-		r0 = rf(blockno)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Transaction) error); ok {
+		r0 = rf(ctx, tx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AddUncle provides a mock function with given fields: ctx, u
+func (_m *Database) AddUncle(ctx context.Context, u *models.Uncle) error {
+	ret := _m.Called(ctx, u)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Uncle) error); ok {
+		r0 = rf(ctx, u)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// BackfillActivity provides a mock function with given fields: ctx
+func (_m *Database) BackfillActivity(ctx context.Context) {
+	_m.Called(ctx)
+}
+
+// BackfillBalances provides a mock function with given fields: ctx
+func (_m *Database) BackfillBalances(ctx context.Context) {
+	_m.Called(ctx)
+}
+
+// BalancesToCheck provides a mock function with given fields: ctx, limit
+func (_m *Database) BalancesToCheck(ctx context.Context, limit int) ([]models.TokenBalance, error) {
+	ret := _m.Called(ctx, limit)
+
+	var r0 []models.TokenBalance
+	if rf, ok := ret.Get(0).(func(context.Context, int) []models.TokenBalance); ok {
+		r0 = rf(ctx, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.TokenBalance)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// BlocksIter provides a mock function with given fields: ctx, blockno
+func (_m *Database) BlocksIter(ctx context.Context, blockno uint64) *storage.Iter {
+	ret := _m.Called(ctx, blockno)
+
+	var r0 *storage.Iter
+	if rf, ok := ret.Get(0).(func(context.Context, uint64) *storage.Iter); ok {
+		r0 = rf(ctx, blockno)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*mgo.Iter)
+			r0 = ret.Get(0).(*storage.Iter)
 		}
 	}
 
 	return r0
 }
 
-// GetBlock provides a mock function with given fields: height
-func (_m *Database) GetBlock(height uint64) (*models.Block, error) {
-	ret := _m.Called(height)
+// CapForkedBlocks provides a mock function with given fields: ctx, max, batch
+func (_m *Database) CapForkedBlocks(ctx context.Context, max int, batch int) (int, error) {
+	ret := _m.Called(ctx, max, batch)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, int, int) int); ok {
+		r0 = rf(ctx, max, batch)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int, int) error); ok {
+		r1 = rf(ctx, max, batch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CheckBalance provides a mock function with given fields: ctx, contract, holder, balance, block
+func (_m *Database) CheckBalance(ctx context.Context, contract string, holder string, balance *big.Int, block uint64) error {
+	ret := _m.Called(ctx, contract, holder, balance, block)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *big.Int, uint64) error); ok {
+		r0 = rf(ctx, contract, holder, balance, block)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetBlock provides a mock function with given fields: ctx, height
+func (_m *Database) GetBlock(ctx context.Context, height uint64) (*models.Block, error) {
+	ret := _m.Called(ctx, height)
 
 	var r0 *models.Block
-	if rf, ok := ret.Get(0).(func(uint64) *models.Block); ok {
-		r0 = rf(height)
+	if rf, ok := ret.Get(0).(func(context.Context, uint64) *models.Block); ok {
+		r0 = rf(ctx, height)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*models.Block)
@@ -139,8 +237,8 @@ func (_m *Database) GetBlock(height uint64) (*models.Block, error) {
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(uint64) error); ok {
-		r1 = rf(height)
+	if rf, ok := ret.Get(1).(func(context.Context, uint64) error); ok {
+		r1 = rf(ctx, height)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -148,61 +246,61 @@ func (_m *Database) GetBlock(height uint64) (*models.Block, error) {
 	return r0, r1
 }
 
-// GetBlocks provides a mock function with given fields: days
-func (_m *Database) GetBlocks(days int) *mgo.Iter {
-	ret := _m.Called(days)
+// GetBlocks provides a mock function with given fields: ctx, days
+func (_m *Database) GetBlocks(ctx context.Context, days int) *storage.Iter {
+	ret := _m.Called(ctx, days)
 
-	var r0 *mgo.Iter
-	if rf, ok := ret.Get(0).(func(int) *mgo.Iter); ok {
-		r0 = rf(days)
+	var r0 *storage.Iter
+	if rf, ok := ret.Get(0).(func(context.Context, int) *storage.Iter); ok {
+		r0 = rf(ctx, days)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*mgo.Iter)
+			r0 = ret.Get(0).(*storage.Iter)
 		}
 	}
 
 	return r0
 }
 
-// GetTokenTransfers provides a mock function with given fields: contractAddress, address, after
-func (_m *Database) GetTokenTransfers(contractAddress string, address string, after int64) *mgo.Iter {
-	ret := _m.Called(contractAddress, address, after)
+// GetTokenTransfers provides a mock function with given fields: ctx, contractAddress, address, after
+func (_m *Database) GetTokenTransfers(ctx context.Context, contractAddress string, address string, after int64) *storage.Iter {
+	ret := _m.Called(ctx, contractAddress, address, after)
 
-	var r0 *mgo.Iter
-	if rf, ok := ret.Get(0).(func(string, string, int64) *mgo.Iter); ok {
-		r0 = rf(contractAddress, address, after)
+	var r0 *storage.Iter
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64) *storage.Iter); ok {
+		r0 = rf(ctx, contractAddress, address, after)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*mgo.Iter)
+			r0 = ret.Get(0).(*storage.Iter)
 		}
 	}
 
 	return r0
 }
 
-// GetTxnCounts provides a mock function with given fields: days
-func (_m *Database) GetTxnCounts(days int) *mgo.Iter {
-	ret := _m.Called(days)
+// GetTxnCounts provides a mock function with given fields: ctx, days
+func (_m *Database) GetTxnCounts(ctx context.Context, days int) *storage.Iter {
+	ret := _m.Called(ctx, days)
 
-	var r0 *mgo.Iter
-	if rf, ok := ret.Get(0).(func(int) *mgo.Iter); ok {
-		r0 = rf(days)
+	var r0 *storage.Iter
+	if rf, ok := ret.Get(0).(func(context.Context, int) *storage.Iter); ok {
+		r0 = rf(ctx, days)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*mgo.Iter)
+			r0 = ret.Get(0).(*storage.Iter)
 		}
 	}
 
 	return r0
 }
 
-// IndexHead provides a mock function with given fields:
-func (_m *Database) IndexHead() [1]uint64 {
-	ret := _m.Called()
+// IndexHead provides a mock function with given fields: ctx
+func (_m *Database) IndexHead(ctx context.Context) [1]uint64 {
+	ret := _m.Called(ctx)
 
 	var r0 [1]uint64
-	if rf, ok := ret.Get(0).(func() [1]uint64); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(context.Context) [1]uint64); ok {
+		r0 = rf(ctx)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([1]uint64)
@@ -212,18 +310,23 @@ func (_m *Database) IndexHead() [1]uint64 {
 	return r0
 }
 
-// Init provides a mock function with given fields:
-func (_m *Database) Init() {
-	_m.Called()
+// Init provides a mock function with given fields: ctx
+func (_m *Database) Init(ctx context.Context) {
+	_m.Called(ctx)
+}
+
+// InitIndex provides a mock function with given fields: ctx
+func (_m *Database) InitIndex(ctx context.Context) {
+	_m.Called(ctx)
 }
 
-// IsFirstRun provides a mock function with given fields:
-func (_m *Database) IsFirstRun() bool {
-	ret := _m.Called()
+// IsFirstRun provides a mock function with given fields: ctx
+func (_m *Database) IsFirstRun(ctx context.Context) bool {
+	ret := _m.Called(ctx)
 
 	var r0 bool
-	if rf, ok := ret.Get(0).(func() bool); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(context.Context) bool); ok {
+		r0 = rf(ctx)
 	} else {
 		r0 = ret.Get(0).(bool)
 	}
@@ -231,20 +334,20 @@ func (_m *Database) IsFirstRun() bool {
 	return r0
 }
 
-// IsInDB provides a mock function with given fields: height, hash
-func (_m *Database) IsInDB(height uint64, hash string) (bool, bool) {
-	ret := _m.Called(height, hash)
+// IsInDB provides a mock function with given fields: ctx, height, hash
+func (_m *Database) IsInDB(ctx context.Context, height uint64, hash string) (bool, bool) {
+	ret := _m.Called(ctx, height, hash)
 
 	var r0 bool
-	if rf, ok := ret.Get(0).(func(uint64, string) bool); ok {
-		r0 = rf(height, hash)
+	if rf, ok := ret.Get(0).(func(context.Context, uint64, string) bool); ok {
+		r0 = rf(ctx, height, hash)
 	} else {
 		r0 = ret.Get(0).(bool)
 	}
 
 	var r1 bool
-	if rf, ok := ret.Get(1).(func(uint64, string) bool); ok {
-		r1 = rf(height, hash)
+	if rf, ok := ret.Get(1).(func(context.Context, uint64, string) bool); ok {
+		r1 = rf(ctx, height, hash)
 	} else {
 		r1 = ret.Get(1).(bool)
 	}
@@ -252,13 +355,13 @@ func (_m *Database) IsInDB(height uint64, hash string) (bool, bool) {
 	return r0, r1
 }
 
-// IsPresent provides a mock function with given fields: height
-func (_m *Database) IsPresent(height uint64) bool {
-	ret := _m.Called(height)
+// IsPresent provides a mock function with given fields: ctx, height
+func (_m *Database) IsPresent(ctx context.Context, height uint64) bool {
+	ret := _m.Called(ctx, height)
 
 	var r0 bool
-	if rf, ok := ret.Get(0).(func(uint64) bool); ok {
-		r0 = rf(height)
+	if rf, ok := ret.Get(0).(func(context.Context, uint64) bool); ok {
+		r0 = rf(ctx, height)
 	} else {
 		r0 = ret.Get(0).(bool)
 	}
@@ -266,13 +369,34 @@ func (_m *Database) IsPresent(height uint64) bool {
 	return r0
 }
 
-// Ping provides a mock function with given fields:
-func (_m *Database) Ping() error {
-	ret := _m.Called()
+// LatestBlock provides a mock function with given fields: ctx
+func (_m *Database) LatestBlock(ctx context.Context) (models.Block, error) {
+	ret := _m.Called(ctx)
+
+	var r0 models.Block
+	if rf, ok := ret.Get(0).(func(context.Context) models.Block); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(models.Block)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Ping provides a mock function with given fields: ctx
+func (_m *Database) Ping(ctx context.Context) error {
+	ret := _m.Called(ctx)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func() error); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -280,25 +404,93 @@ func (_m *Database) Ping() error {
 	return r0
 }
 
-// Purge provides a mock function with given fields: height
-func (_m *Database) Purge(height uint64) {
-	_m.Called(height)
+// PruneBodies provides a mock function with given fields: ctx, below, batch
+func (_m *Database) PruneBodies(ctx context.Context, below uint64, batch uint64) (int, error) {
+	ret := _m.Called(ctx, below, batch)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, uint64, uint64) int); ok {
+		r0 = rf(ctx, below, batch)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uint64, uint64) error); ok {
+		r1 = rf(ctx, below, batch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// SupplyObject provides a mock function with given fields: symbol
-func (_m *Database) SupplyObject(symbol string) (models.Store, error) {
-	ret := _m.Called(symbol)
+// PruneTxData provides a mock function with given fields: ctx, below, batch
+func (_m *Database) PruneTxData(ctx context.Context, below uint64, batch uint64) (int, error) {
+	ret := _m.Called(ctx, below, batch)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, uint64, uint64) int); ok {
+		r0 = rf(ctx, below, batch)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uint64, uint64) error); ok {
+		r1 = rf(ctx, below, batch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Purge provides a mock function with given fields: ctx, height
+func (_m *Database) Purge(ctx context.Context, height uint64) {
+	_m.Called(ctx, height)
+}
+
+// ReconcileCounters provides a mock function with given fields: ctx
+func (_m *Database) ReconcileCounters(ctx context.Context) {
+	_m.Called(ctx)
+}
+
+// SupplyObject provides a mock function with given fields: ctx, symbol
+func (_m *Database) SupplyObject(ctx context.Context, symbol string) (models.Store, error) {
+	ret := _m.Called(ctx, symbol)
 
 	var r0 models.Store
-	if rf, ok := ret.Get(0).(func(string) models.Store); ok {
-		r0 = rf(symbol)
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.Store); ok {
+		r0 = rf(ctx, symbol)
 	} else {
 		r0 = ret.Get(0).(models.Store)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(symbol)
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, symbol)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Token provides a mock function with given fields: ctx, contract
+func (_m *Database) Token(ctx context.Context, contract string) (models.Token, error) {
+	ret := _m.Called(ctx, contract)
+
+	var r0 models.Token
+	if rf, ok := ret.Get(0).(func(context.Context, string) models.Token); ok {
+		r0 = rf(ctx, contract)
+	} else {
+		r0 = ret.Get(0).(models.Token)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, contract)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -306,13 +498,50 @@ func (_m *Database) SupplyObject(symbol string) (models.Store, error) {
 	return r0, r1
 }
 
-// UpdateStore provides a mock function with given fields: latestBlock, synctype
-func (_m *Database) UpdateStore(latestBlock *models.Block, synctype string) error {
-	ret := _m.Called(latestBlock, synctype)
+// TransferContracts provides a mock function with given fields: ctx
+func (_m *Database) TransferContracts(ctx context.Context) ([]models.Token, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []models.Token
+	if rf, ok := ret.Get(0).(func(context.Context) []models.Token); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Token)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateStore provides a mock function with given fields: ctx, latestBlock, synctype
+func (_m *Database) UpdateStore(ctx context.Context, latestBlock *models.Block, synctype string) error {
+	ret := _m.Called(ctx, latestBlock, synctype)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Block, string) error); ok {
+		r0 = rf(ctx, latestBlock, synctype)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateSupply provides a mock function with given fields: ctx, ticker, new
+func (_m *Database) UpdateSupply(ctx context.Context, ticker string, new *models.Store) error {
+	ret := _m.Called(ctx, ticker, new)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*models.Block, string) error); ok {
-		r0 = rf(latestBlock, synctype)
+	if rf, ok := ret.Get(0).(func(context.Context, string, *models.Store) error); ok {
+		r0 = rf(ctx, ticker, new)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -320,13 +549,13 @@ func (_m *Database) UpdateStore(latestBlock *models.Block, synctype string) erro
 	return r0
 }
 
-// UpdateSupply provides a mock function with given fields: ticker, new
-func (_m *Database) UpdateSupply(ticker string, new *models.Store) error {
-	ret := _m.Called(ticker, new)
+// UpdateToken provides a mock function with given fields: ctx, t
+func (_m *Database) UpdateToken(ctx context.Context, t *models.Token) error {
+	ret := _m.Called(ctx, t)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, *models.Store) error); ok {
-		r0 = rf(ticker, new)
+	if rf, ok := ret.Get(0).(func(context.Context, *models.Token) error); ok {
+		r0 = rf(ctx, t)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -4,6 +4,7 @@ package mocks
 
 import mock "github.com/stretchr/testify/mock"
 import models "github.com/ubiq/spectrum-backend/models"
+import big "math/big"
 
 // RPCClient is an autogenerated mock type for the RPCClient type
 type RPCClient struct {
@@ -79,6 +80,29 @@ func (_m *RPCClient) GetLatestBlock() (*models.Block, error) {
 	return r0, r1
 }
 
+// GetToken provides a mock function with given fields: contract
+func (_m *RPCClient) GetToken(contract string) (*models.Token, error) {
+	ret := _m.Called(contract)
+
+	var r0 *models.Token
+	if rf, ok := ret.Get(0).(func(string) *models.Token); ok {
+		r0 = rf(contract)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Token)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(contract)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetTxReceipt provides a mock function with given fields: hash
 func (_m *RPCClient) GetTxReceipt(hash string) (*models.TxReceipt, error) {
 	ret := _m.Called(hash)
@@ -159,3 +183,26 @@ func (_m *RPCClient) Ping() error {
 
 	return r0
 }
+
+// TokenBalance provides a mock function with given fields: contract, holder, block
+func (_m *RPCClient) TokenBalance(contract string, holder string, block uint64) (*big.Int, error) {
+	ret := _m.Called(contract, holder, block)
+
+	var r0 *big.Int
+	if rf, ok := ret.Get(0).(func(string, string, uint64) *big.Int); ok {
+		r0 = rf(contract, holder, block)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*big.Int)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string, uint64) error); ok {
+		r1 = rf(contract, holder, block)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
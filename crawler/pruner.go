@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func (c *Crawler) startPruner(ctx context.Context) {
+	interval := 10 * time.Minute
+
+	if c.cfg.Retention.Interval != "" {
+		var err error
+
+		interval, err = time.ParseDuration(c.cfg.Retention.Interval)
+		if err != nil {
+			log.Fatalf("Crawler: can't parse retention duration: %v", err)
+		}
+	}
+
+	log.Printf("Retention interval: %v", interval)
+
+	c.Prune(ctx)
+
+	for range time.Tick(interval) {
+		c.Prune(ctx)
+	}
+}
+
+// Prune applies the configured retention rules.
+func (c *Crawler) Prune(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, maintenanceTimeout)
+	defer cancel()
+
+	rules := c.cfg.Retention
+
+	start := time.Now()
+	log.Debugf("Start pruning: %v", start)
+
+	batch := rules.Batch
+	if batch == 0 {
+		batch = 1000
+	}
+
+	if rules.TxData > 0 {
+		head, err := c.rpc.LatestBlockNumber()
+		if err != nil {
+			log.Errorf("Error getting blockNo: %v", err)
+		} else if head > rules.TxData {
+			n, err := c.backend.PruneTxData(ctx, head-rules.TxData, batch)
+			if err != nil {
+				log.Errorf("Error pruning transaction data: %v", err)
+			}
+			if n > 0 {
+				log.Printf("Pruned input and logs of %v transactions (below block %v)", n, head-rules.TxData)
+			}
+		}
+	}
+
+	if rules.HeadersBefore > 0 {
+		n, err := c.backend.PruneBodies(ctx, rules.HeadersBefore, batch)
+		if err != nil {
+			log.Errorf("Error pruning block bodies: %v", err)
+		}
+		if n > 0 {
+			log.Printf("Pruned %v blocks to headers (below block %v)", n, rules.HeadersBefore)
+		}
+	}
+
+	if rules.ForkedBlocks > 0 {
+		n, err := c.backend.CapForkedBlocks(ctx, rules.ForkedBlocks, int(batch))
+		if err != nil {
+			log.Errorf("Error pruning forked blocks: %v", err)
+		}
+		if n > 0 {
+			log.Printf("Pruned %v forked blocks", n)
+		}
+	}
+
+	log.Debugf("End pruning: %v", time.Since(start))
+}
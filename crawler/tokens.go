@@ -0,0 +1,123 @@
+package crawler
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ubiq/spectrum-backend/models"
+	"github.com/ubiq/spectrum-backend/storage"
+)
+
+// registerTokens adds the contracts of transfers missing from the token registry. Contracts
+// are looked up once per run, failed metadata reads are retried by the next refresh.
+func (c *Crawler) registerTokens(ctx context.Context, transfers []*models.TokenTransfer) {
+	for _, tt := range transfers {
+		c.tokens.Lock()
+		known := c.tokens.known[tt.Contract]
+		c.tokens.known[tt.Contract] = true
+		c.tokens.Unlock()
+
+		if known {
+			continue
+		}
+
+		_, err := c.backend.Token(ctx, tt.Contract)
+		if err == nil {
+			continue
+		}
+		if err != storage.ErrNotFound {
+			log.Errorf("Error getting token %v: %v", tt.Contract, err)
+			c.forgetToken(tt.Contract)
+			continue
+		}
+
+		token, err := c.rpc.GetToken(tt.Contract)
+		if err != nil {
+			log.Debugf("Could not read token metadata of %v: %v", tt.Contract, err)
+			token = &models.Token{Contract: tt.Contract}
+		}
+		token.FirstBlock = tt.BlockNumber
+		token.FirstIndex = tt.TransactionIndex
+		token.UpdatedAt = time.Now().Unix()
+
+		if err := c.backend.AddToken(ctx, token); err != nil {
+			log.Errorf("Error adding token %v: %v", tt.Contract, err)
+			c.forgetToken(tt.Contract)
+			continue
+		}
+		log.Debugf("New token %v (%v)", tt.Contract, token.Symbol)
+	}
+}
+
+func (c *Crawler) forgetToken(contract string) {
+	c.tokens.Lock()
+	delete(c.tokens.known, contract)
+	c.tokens.Unlock()
+}
+
+// RefreshTokens reads the metadata of every contract with transfers again, total supplies
+// change and tokens missed by registerTokens are added.
+func (c *Crawler) RefreshTokens(ctx context.Context) {
+	c.tokens.Lock()
+	if c.tokens.refreshing {
+		c.tokens.Unlock()
+		return
+	}
+	c.tokens.refreshing = true
+	c.tokens.Unlock()
+
+	defer func() {
+		c.tokens.Lock()
+		c.tokens.refreshing = false
+		c.tokens.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, maintenanceTimeout)
+	defer cancel()
+
+	start := time.Now()
+
+	contracts, err := c.backend.TransferContracts(ctx)
+	if err != nil {
+		log.Errorf("Error getting token contracts: %v", err)
+		return
+	}
+
+	updated := 0
+	for _, v := range contracts {
+		if ctx.Err() != nil {
+			log.Errorf("Token refresh stopped: %v", ctx.Err())
+			return
+		}
+
+		token, err := c.rpc.GetToken(v.Contract)
+		if err != nil {
+			log.Debugf("Could not read token metadata of %v: %v", v.Contract, err)
+
+			// Keep the metadata read before, only make sure the token is listed
+			v := v
+			v.UpdatedAt = time.Now().Unix()
+			if err := c.backend.AddToken(ctx, &v); err != nil {
+				log.Errorf("Error adding token %v: %v", v.Contract, err)
+			}
+			continue
+		}
+		token.FirstBlock = v.FirstBlock
+		token.FirstIndex = v.FirstIndex
+		token.UpdatedAt = time.Now().Unix()
+
+		if err := c.backend.UpdateToken(ctx, token); err != nil {
+			log.Errorf("Error updating token %v: %v", v.Contract, err)
+			continue
+		}
+		updated++
+
+		c.tokens.Lock()
+		c.tokens.known[v.Contract] = true
+		c.tokens.Unlock()
+	}
+
+	log.Printf("Refreshed %v of %v tokens, took %v", updated, len(contracts), time.Since(start))
+}
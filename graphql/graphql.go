@@ -0,0 +1,630 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+/*
+	Minimal GraphQL executor. The schema is a tree of Objects built in Go, fields resolve
+	with a function or, without one, from the struct field of the parent value with the same
+	json name. Queries are checked against the schema before anything runs, including their
+	depth and complexity: every field costs 1, the fields below a list cost once per item it
+	can hold. Fragments are checked once per type they're spread on.
+*/
+
+// Type is a Scalar, an *Object or a List.
+type Type interface{}
+
+type Scalar string
+
+const (
+	String  Scalar = "String"
+	Int     Scalar = "Int"
+	Float   Scalar = "Float"
+	Boolean Scalar = "Boolean"
+)
+
+type List struct {
+	Of Type
+}
+
+type Object struct {
+	Name   string
+	Fields map[string]*FieldDef
+}
+
+type FieldDef struct {
+	Type Type
+	// Names of the arguments the field takes
+	Args []string
+	// Resolves the field from the parent value, nil reads the struct field
+	Resolve func(p Params) (interface{}, error)
+	// Number of items a list field can return for its arguments, 1 when nil
+	Size func(args Args) int
+}
+
+type Params struct {
+	Context context.Context
+	Source  interface{}
+	Args    Args
+}
+
+type Schema struct {
+	Query         *Object
+	MaxDepth      int
+	MaxComplexity int
+}
+
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Execute runs a query, errors in the request itself leave the data out.
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+
+	vars := make(map[string]interface{})
+	for _, v := range op.Variables {
+		if val, ok := req.Variables[v.Name]; ok {
+			vars[v.Name] = val
+		} else if v.Default != nil {
+			vars[v.Name] = v.Default
+		}
+	}
+
+	e := &executor{ctx: ctx, doc: doc, vars: vars, fragments: make(map[fragmentKey]fragmentCost)}
+
+	if _, err := e.check(s.Query, op.Selections, 1, nil, s.limits()); err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+
+	data := e.object(s.Query, nil, op.Selections, nil)
+	return &Response{Data: data, Errors: e.errors}
+}
+
+func (d *Document) operation(name string) (*Operation, error) {
+	if name == "" {
+		if len(d.Operations) > 1 {
+			return nil, fmt.Errorf("operationName is required for documents with more than one operation")
+		}
+		return d.Operations[0], nil
+	}
+
+	for _, op := range d.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %v", name)
+}
+
+type executor struct {
+	ctx    context.Context
+	doc    *Document
+	vars   map[string]interface{}
+	depth  int
+	errors []*Error
+	// Checked fragments, a fragment spread many times is only walked once per type
+	fragments map[fragmentKey]fragmentCost
+}
+
+type fragmentKey struct {
+	name, on string
+}
+
+type fragmentCost struct {
+	cost int
+	// Levels the fragment reaches below the selection it's spread in
+	depth int
+}
+
+// Validation
+
+type limits struct {
+	depth, complexity int
+}
+
+func (s *Schema) limits() limits {
+	return limits{s.MaxDepth, s.MaxComplexity}
+}
+
+// check validates selections on obj and returns their complexity. It fails as soon as a limit
+// is passed, expanding fragments before checking them could take forever.
+func (e *executor) check(obj *Object, sels []Selection, depth int, fragments []string, l limits) (int, error) {
+	if depth > e.depth {
+		e.depth = depth
+	}
+	if l.depth > 0 && depth > l.depth {
+		return 0, fmt.Errorf("query depth %d exceeds the limit of %d", depth, l.depth)
+	}
+
+	cost := 0
+
+	add := func(c int) error {
+		cost = addCost(cost, c)
+		if l.complexity > 0 && cost > l.complexity {
+			return fmt.Errorf("query complexity exceeds the limit of %d", l.complexity)
+		}
+		return nil
+	}
+
+	for _, sel := range sels {
+		switch s := sel.(type) {
+		case *Field:
+			if s.Name == "__typename" {
+				if err := add(1); err != nil {
+					return 0, err
+				}
+				continue
+			}
+
+			def, ok := obj.Fields[s.Name]
+			if !ok {
+				return 0, fmt.Errorf("cannot query field %v on type %v", s.Name, obj.Name)
+			}
+
+			for name := range s.Arguments {
+				if !contains(def.Args, name) {
+					return 0, fmt.Errorf("unknown argument %v on field %v.%v", name, obj.Name, s.Name)
+				}
+			}
+
+			args, err := e.args(s.Arguments)
+			if err != nil {
+				return 0, err
+			}
+
+			child, size := unwrap(def.Type)
+			if def.Size != nil {
+				size = def.Size(args)
+			}
+
+			switch t := child.(type) {
+			case Scalar:
+				if len(s.Selections) > 0 {
+					return 0, fmt.Errorf("field %v of type %v must not have a selection", s.Name, t)
+				}
+				if err := add(1); err != nil {
+					return 0, err
+				}
+			case *Object:
+				if len(s.Selections) == 0 {
+					return 0, fmt.Errorf("field %v of type %v must have a selection", s.Name, t.Name)
+				}
+				c, err := e.check(t, s.Selections, depth+1, fragments, l)
+				if err != nil {
+					return 0, err
+				}
+				if err := add(addCost(1, mulCost(size, c))); err != nil {
+					return 0, err
+				}
+			}
+
+		case *FragmentSpread:
+			f, ok := e.doc.Fragments[s.Name]
+			if !ok {
+				return 0, fmt.Errorf("unknown fragment %v", s.Name)
+			}
+			if contains(fragments, s.Name) {
+				return 0, fmt.Errorf("fragment %v spreads itself", s.Name)
+			}
+			if f.On != obj.Name {
+				return 0, fmt.Errorf("fragment %v on %v can't be spread on %v", f.Name, f.On, obj.Name)
+			}
+			c, err := e.checkFragment(obj, f, depth, fragments, l)
+			if err != nil {
+				return 0, err
+			}
+			if err := add(c); err != nil {
+				return 0, err
+			}
+
+		case *InlineFragment:
+			if s.On != "" && s.On != obj.Name {
+				return 0, fmt.Errorf("fragment on %v can't be spread on %v", s.On, obj.Name)
+			}
+			c, err := e.check(obj, s.Selections, depth, fragments, l)
+			if err != nil {
+				return 0, err
+			}
+			if err := add(c); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return cost, nil
+}
+
+// checkFragment checks a fragment spread on obj at depth, or reuses the result of an earlier
+// spread. A fragment that checked fine doesn't spread any fragment it is spread from.
+func (e *executor) checkFragment(obj *Object, f *Fragment, depth int, fragments []string, l limits) (int, error) {
+	key := fragmentKey{f.Name, obj.Name}
+
+	if fc, ok := e.fragments[key]; ok {
+		if d := depth + fc.depth; d > e.depth {
+			e.depth = d
+		}
+		if l.depth > 0 && depth+fc.depth > l.depth {
+			return 0, fmt.Errorf("query depth %d exceeds the limit of %d", depth+fc.depth, l.depth)
+		}
+		return fc.cost, nil
+	}
+
+	// The depth reached below this spread, apart from the rest of the query
+	outer := e.depth
+	e.depth = depth
+
+	c, err := e.check(obj, f.Selections, depth, append(fragments, f.Name), l)
+
+	reached := e.depth
+	if outer > e.depth {
+		e.depth = outer
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	e.fragments[key] = fragmentCost{c, reached - depth}
+	return c, nil
+}
+
+// unwrap returns the named type of t and how many items it holds, lists of unknown size
+// count as 1.
+func unwrap(t Type) (Type, int) {
+	for {
+		l, ok := t.(List)
+		if !ok {
+			return t, 1
+		}
+		t = l.Of
+	}
+}
+
+func addCost(a, b int) int {
+	if a > math.MaxInt32-b {
+		return math.MaxInt32
+	}
+	return a + b
+}
+
+func mulCost(a, b int) int {
+	if a > 0 && b > math.MaxInt32/a {
+		return math.MaxInt32
+	}
+	return a * b
+}
+
+// Execution
+
+type field struct {
+	key    string
+	fields []*Field
+}
+
+// collect flattens fragments and merges fields with the same response key. A fragment spread
+// again in the same selection adds nothing, so it's only collected once.
+func (e *executor) collect(obj *Object, sels []Selection, result []*field, visited map[string]bool) []*field {
+	for _, sel := range sels {
+		switch s := sel.(type) {
+		case *Field:
+			if !e.include(s.Directives) {
+				continue
+			}
+
+			key := s.Name
+			if s.Alias != "" {
+				key = s.Alias
+			}
+
+			merged := false
+			for _, f := range result {
+				if f.key == key {
+					f.fields = append(f.fields, s)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				result = append(result, &field{key, []*Field{s}})
+			}
+
+		case *FragmentSpread:
+			if !visited[s.Name] && e.include(s.Directives) {
+				visited[s.Name] = true
+				result = e.collect(obj, e.doc.Fragments[s.Name].Selections, result, visited)
+			}
+
+		case *InlineFragment:
+			if e.include(s.Directives) {
+				result = e.collect(obj, s.Selections, result, visited)
+			}
+		}
+	}
+	return result
+}
+
+func (e *executor) include(dirs []*Directive) bool {
+	for _, d := range dirs {
+		args, err := e.args(d.Arguments)
+		if err != nil {
+			continue
+		}
+		switch d.Name {
+		case "skip":
+			if args.Bool("if") {
+				return false
+			}
+		case "include":
+			if !args.Bool("if") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (e *executor) object(obj *Object, source interface{}, sels []Selection, path []interface{}) *orderedMap {
+	fields := e.collect(obj, sels, nil, make(map[string]bool))
+
+	result := &orderedMap{}
+
+	for _, f := range fields {
+		first := f.fields[0]
+		fpath := append(append([]interface{}{}, path...), f.key)
+
+		if first.Name == "__typename" {
+			result.set(f.key, obj.Name)
+			continue
+		}
+
+		def := obj.Fields[first.Name]
+
+		args, err := e.args(first.Arguments)
+		if err != nil {
+			e.fail(err, fpath)
+			result.set(f.key, nil)
+			continue
+		}
+
+		var value interface{}
+		if def.Resolve != nil {
+			value, err = def.Resolve(Params{e.ctx, source, args})
+		} else {
+			value, err = structField(source, first.Name)
+		}
+		if err != nil {
+			e.fail(err, fpath)
+			result.set(f.key, nil)
+			continue
+		}
+
+		var sub []Selection
+		for _, v := range f.fields {
+			sub = append(sub, v.Selections...)
+		}
+
+		result.set(f.key, e.complete(def.Type, value, sub, fpath))
+	}
+	return result
+}
+
+func (e *executor) complete(t Type, value interface{}, sels []Selection, path []interface{}) interface{} {
+	if isNil(value) {
+		return nil
+	}
+
+	switch t := t.(type) {
+	case Scalar:
+		return value
+	case *Object:
+		return e.object(t, value, sels, path)
+	case List:
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			e.fail(fmt.Errorf("expected a list, got %T", value), path)
+			return nil
+		}
+
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = e.complete(t.Of, v.Index(i).Interface(), sels, append(append([]interface{}{}, path...), i))
+		}
+		return items
+	}
+	return nil
+}
+
+func (e *executor) fail(err error, path []interface{}) {
+	e.errors = append(e.errors, &Error{Message: err.Error(), Path: path})
+}
+
+// args resolves the variables of field or directive arguments.
+func (e *executor) args(raw map[string]Value) (Args, error) {
+	args := make(Args, len(raw))
+
+	for k, v := range raw {
+		val, err := e.value(v)
+		if err != nil {
+			return nil, err
+		}
+		args[k] = val
+	}
+	return args, nil
+}
+
+func (e *executor) value(v Value) (interface{}, error) {
+	switch v := v.(type) {
+	case Variable:
+		val, ok := e.vars[string(v)]
+		if !ok {
+			return nil, fmt.Errorf("variable $%v is not defined", v)
+		}
+		return val, nil
+	case Enum:
+		return string(v), nil
+	case []Value:
+		list := make([]interface{}, len(v))
+		for i := range v {
+			val, err := e.value(v[i])
+			if err != nil {
+				return nil, err
+			}
+			list[i] = val
+		}
+		return list, nil
+	case map[string]Value:
+		obj := make(map[string]interface{}, len(v))
+		for k := range v {
+			val, err := e.value(v[k])
+			if err != nil {
+				return nil, err
+			}
+			obj[k] = val
+		}
+		return obj, nil
+	}
+	return v, nil
+}
+
+// structField reads the field of a struct, or map, by its json name.
+func structField(source interface{}, name string) (interface{}, error) {
+	v := reflect.Indirect(reflect.ValueOf(source))
+
+	switch v.Kind() {
+	case reflect.Map:
+		val := v.MapIndex(reflect.ValueOf(name))
+		if !val.IsValid() {
+			return nil, nil
+		}
+		return val.Interface(), nil
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if tag == name || tag == "" && strings.EqualFold(t.Field(i).Name, name) {
+				return v.Field(i).Interface(), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no value for field %v", name)
+}
+
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	switch r := reflect.ValueOf(v); r.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return r.IsNil()
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Args are the arguments of a field with their variables resolved.
+type Args map[string]interface{}
+
+func (a Args) Has(name string) bool {
+	v, ok := a[name]
+	return ok && v != nil
+}
+
+func (a Args) String(name string) string {
+	s, _ := a[name].(string)
+	return s
+}
+
+func (a Args) Bool(name string) bool {
+	b, _ := a[name].(bool)
+	return b
+}
+
+// Int returns an integer argument, def when it's missing. Variables decoded from JSON are
+// floats.
+func (a Args) Int(name string, def int) (int, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return def, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("argument %v must be an integer", name)
+		}
+		return int(v), nil
+	}
+	return 0, fmt.Errorf("argument %v must be an integer", name)
+}
+
+// orderedMap keeps the fields of a result in the order of the query.
+type orderedMap struct {
+	keys   []string
+	values []interface{}
+}
+
+func (m *orderedMap) set(key string, value interface{}) {
+	m.keys = append(m.keys, key)
+	m.values = append(m.values, value)
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+	for i, k := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(k)
+		buf.Write(key)
+		buf.WriteByte(':')
+
+		val, err := json.Marshal(m.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,157 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testBlock struct {
+	Number int64  `json:"number"`
+	Hash   string `json:"hash"`
+}
+
+func testSchema() *Schema {
+	block := &Object{Name: "Block", Fields: map[string]*FieldDef{
+		"number": {Type: Int},
+		"hash":   {Type: String},
+	}}
+	block.Fields["parent"] = &FieldDef{
+		Type: block,
+		Resolve: func(p Params) (interface{}, error) {
+			b := p.Source.(testBlock)
+			return testBlock{b.Number - 1, fmt.Sprintf("0x%d", b.Number-1)}, nil
+		},
+	}
+
+	query := &Object{Name: "Query", Fields: map[string]*FieldDef{
+		"blocks": {
+			Type: List{block},
+			Args: []string{"limit"},
+			Resolve: func(p Params) (interface{}, error) {
+				return []testBlock{{2, "0x2"}, {1, "0x1"}}, nil
+			},
+			Size: func(args Args) int {
+				n, _ := args.Int("limit", 10)
+				return n
+			},
+		},
+	}}
+
+	return &Schema{Query: query, MaxDepth: 4, MaxComplexity: 100}
+}
+
+func execute(t *testing.T, query string, vars map[string]interface{}) (string, []*Error) {
+	res := testSchema().Execute(context.Background(), Request{Query: query, Variables: vars})
+	if res.Data == nil {
+		return "", res.Errors
+	}
+	data, err := json.Marshal(res.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), res.Errors
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		query string
+		vars  map[string]interface{}
+		data  string
+	}{
+		{
+			"{ blocks(limit: 2) { number h: hash } }",
+			nil,
+			`{"blocks":[{"number":2,"h":"0x2"},{"number":1,"h":"0x1"}]}`,
+		},
+		{
+			"{ blocks(limit: 1) { ...b ...b } } fragment b on Block { number parent { hash } }",
+			nil,
+			`{"blocks":[{"number":2,"parent":{"hash":"0x1"}},{"number":1,"parent":{"hash":"0x0"}}]}`,
+		},
+		{
+			"query($s: Boolean!) { blocks(limit: 1) { number @skip(if: $s) hash @include(if: $s) } }",
+			map[string]interface{}{"s": true},
+			`{"blocks":[{"hash":"0x2"},{"hash":"0x1"}]}`,
+		},
+		{
+			"query($s: Boolean!) { blocks(limit: 1) { number @skip(if: $s) ... @include(if: $s) { hash } } }",
+			map[string]interface{}{"s": false},
+			`{"blocks":[{"number":2},{"number":1}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		data, errs := execute(t, tt.query, tt.vars)
+		if len(errs) > 0 {
+			t.Errorf("%v: errors %v", tt.query, errs[0])
+			continue
+		}
+		if data != tt.data {
+			t.Errorf("%v: data = %v, want %v", tt.query, data, tt.data)
+		}
+	}
+}
+
+func TestExecuteRejects(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"{ blocks { ...a } } fragment a on Block { ...b } fragment b on Block { ...a }", "fragment a spreads itself"},
+		{"{ blocks(limit: 1) { parent { parent { parent { number } } } } }", "query depth 5 exceeds the limit of 4"},
+		{"{ blocks(limit: 1) { ...p } } fragment p on Block { parent { parent { parent { number } } } }", "query depth 5 exceeds the limit of 4"},
+		{"{ blocks(limit: 1) { ...p ...p } } fragment p on Block { number parent { ...q } } fragment q on Block { parent { parent { number } } }", "query depth 5 exceeds the limit of 4"},
+		{"{ blocks(limit: 50) { number hash } }", "query complexity exceeds the limit of 100"},
+		{"{ blocks { nonce } }", "nonce"},
+		{"{ blocks }", "must have a selection"},
+	}
+
+	for _, tt := range tests {
+		_, errs := execute(t, tt.query, nil)
+		if len(errs) != 1 || !strings.Contains(errs[0].Message, tt.err) {
+			t.Errorf("%v: errors = %v, want %q", tt.query, errs, tt.err)
+		}
+	}
+}
+
+// fragmentChain spreads every fragment twice in the one before it, expanded it's 2^n fields.
+func fragmentChain(n int) string {
+	var b strings.Builder
+	b.WriteString("{ blocks(limit: 1) { ...f0 } }\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "fragment f%d on Block { ...f%d ...f%d }\n", i, i+1, i+1)
+	}
+	fmt.Fprintf(&b, "fragment f%d on Block { number }\n", n)
+	return b.String()
+}
+
+func TestFragmentBlowUp(t *testing.T) {
+	start := time.Now()
+	_, errs := execute(t, fragmentChain(40), nil)
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Message, "complexity") {
+		t.Errorf("errors = %v, want the complexity limit", errs)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("checking took %v", d)
+	}
+}
+
+func TestFragmentsWithoutLimit(t *testing.T) {
+	// Without a complexity limit repeated spreads are still only collected once
+	s := testSchema()
+	s.MaxComplexity = 0
+
+	res := s.Execute(context.Background(), Request{Query: fragmentChain(40)})
+	if len(res.Errors) > 0 {
+		t.Fatal(res.Errors[0])
+	}
+	data, _ := json.Marshal(res.Data)
+	if want := `{"blocks":[{"number":2},{"number":1}]}`; string(data) != want {
+		t.Errorf("data = %s, want %v", data, want)
+	}
+}
@@ -0,0 +1,515 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+	Parser for the executable part of GraphQL: operations, fields with aliases and arguments,
+	variables, fragments and the @skip/@include directives. Type system definitions aren't
+	supported, the schema is built in Go.
+*/
+
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+type Operation struct {
+	Type       string
+	Name       string
+	Variables  []*VariableDef
+	Selections []Selection
+}
+
+type VariableDef struct {
+	Name    string
+	Default Value
+}
+
+type Fragment struct {
+	Name       string
+	On         string
+	Selections []Selection
+}
+
+type Selection interface{}
+
+type Field struct {
+	Alias      string
+	Name       string
+	Arguments  map[string]Value
+	Directives []*Directive
+	Selections []Selection
+}
+
+type FragmentSpread struct {
+	Name       string
+	Directives []*Directive
+}
+
+type InlineFragment struct {
+	On         string
+	Directives []*Directive
+	Selections []Selection
+}
+
+type Directive struct {
+	Name      string
+	Arguments map[string]Value
+}
+
+// Value is a literal (nil, bool, int64, float64, string, Enum, []Value, map[string]Value)
+// or a Variable.
+type Value interface{}
+
+type Variable string
+
+type Enum string
+
+type token struct {
+	kind  byte // 'n'ame, 'i'nt, 'f'loat, 's'tring, punctuator or 0 at the end
+	value string
+	pos   int
+}
+
+type parser struct {
+	src string
+	pos int
+	tok token
+}
+
+// Parse parses a query document.
+func Parse(src string) (doc *Document, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(syntaxError); ok {
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	p := &parser{src: src}
+	p.next()
+
+	doc = &Document{Fragments: make(map[string]*Fragment)}
+
+	for p.tok.kind != 0 {
+		switch {
+		case p.tok.kind == '{':
+			doc.Operations = append(doc.Operations, &Operation{Type: "query", Selections: p.selections()})
+		case p.tok.kind == 'n' && p.tok.value == "fragment":
+			f := p.fragment()
+			if _, ok := doc.Fragments[f.Name]; ok {
+				p.fail("fragment %v is defined more than once", f.Name)
+			}
+			doc.Fragments[f.Name] = f
+		case p.tok.kind == 'n':
+			doc.Operations = append(doc.Operations, p.operation())
+		default:
+			p.fail("unexpected %v", p.describe())
+		}
+	}
+
+	if len(doc.Operations) == 0 {
+		return nil, syntaxError("document has no operation")
+	}
+	return doc, nil
+}
+
+type syntaxError string
+
+func (e syntaxError) Error() string { return string(e) }
+
+func (p *parser) fail(format string, args ...interface{}) {
+	line := strings.Count(p.src[:p.tok.pos], "\n") + 1
+	panic(syntaxError(fmt.Sprintf("syntax error at line %d: %s", line, fmt.Sprintf(format, args...))))
+}
+
+func (p *parser) describe() string {
+	if p.tok.kind == 0 {
+		return "end of document"
+	}
+	return strconv.Quote(p.tok.value)
+}
+
+func (p *parser) expect(kind byte) string {
+	if p.tok.kind != kind {
+		if kind == 'n' {
+			p.fail("expected a name, found %v", p.describe())
+		}
+		p.fail("expected %q, found %v", kind, p.describe())
+	}
+	v := p.tok.value
+	p.next()
+	return v
+}
+
+func (p *parser) skip(kind byte) bool {
+	if p.tok.kind == kind {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) operation() *Operation {
+	op := &Operation{Type: p.expect('n')}
+	if op.Type != "query" {
+		p.fail("unsupported operation %v", op.Type)
+	}
+
+	if p.tok.kind == 'n' {
+		op.Name = p.expect('n')
+	}
+
+	if p.skip('(') {
+		for !p.skip(')') {
+			p.expect('$')
+			v := &VariableDef{Name: p.expect('n')}
+			p.expect(':')
+			p.typeRef()
+			if p.skip('=') {
+				v.Default = p.value(true)
+			}
+			op.Variables = append(op.Variables, v)
+		}
+	}
+
+	if p.tok.kind == '@' {
+		p.directives()
+	}
+
+	op.Selections = p.selections()
+	return op
+}
+
+// typeRef skips a variable type, values are checked by the resolvers.
+func (p *parser) typeRef() {
+	if p.skip('[') {
+		p.typeRef()
+		p.expect(']')
+	} else {
+		p.expect('n')
+	}
+	p.skip('!')
+}
+
+func (p *parser) fragment() *Fragment {
+	p.expect('n')
+	f := &Fragment{Name: p.expect('n')}
+	if f.Name == "on" {
+		p.fail("fragment can't be named on")
+	}
+	if p.expect('n') != "on" {
+		p.fail("expected on")
+	}
+	f.On = p.expect('n')
+	f.Selections = p.selections()
+	return f
+}
+
+func (p *parser) selections() []Selection {
+	var sels []Selection
+
+	p.expect('{')
+	for !p.skip('}') {
+		if p.skip('.') {
+			sels = append(sels, p.spread())
+			continue
+		}
+		sels = append(sels, p.field())
+	}
+
+	if len(sels) == 0 {
+		p.fail("empty selection set")
+	}
+	return sels
+}
+
+func (p *parser) spread() Selection {
+	if p.tok.kind == 'n' && p.tok.value != "on" {
+		s := &FragmentSpread{Name: p.expect('n')}
+		s.Directives = p.directives()
+		return s
+	}
+
+	f := &InlineFragment{}
+	if p.tok.kind == 'n' {
+		p.next()
+		f.On = p.expect('n')
+	}
+	f.Directives = p.directives()
+	f.Selections = p.selections()
+	return f
+}
+
+func (p *parser) field() *Field {
+	f := &Field{Name: p.expect('n')}
+
+	if p.skip(':') {
+		f.Alias = f.Name
+		f.Name = p.expect('n')
+	}
+
+	f.Arguments = p.arguments()
+	f.Directives = p.directives()
+
+	if p.tok.kind == '{' {
+		f.Selections = p.selections()
+	}
+	return f
+}
+
+func (p *parser) arguments() map[string]Value {
+	if !p.skip('(') {
+		return nil
+	}
+
+	args := make(map[string]Value)
+	for !p.skip(')') {
+		name := p.expect('n')
+		p.expect(':')
+		if _, ok := args[name]; ok {
+			p.fail("argument %v is given more than once", name)
+		}
+		args[name] = p.value(false)
+	}
+	return args
+}
+
+func (p *parser) directives() []*Directive {
+	var dirs []*Directive
+	for p.skip('@') {
+		dirs = append(dirs, &Directive{Name: p.expect('n'), Arguments: p.arguments()})
+	}
+	return dirs
+}
+
+func (p *parser) value(constant bool) Value {
+	tok := p.tok
+
+	switch tok.kind {
+	case '$':
+		if constant {
+			p.fail("unexpected variable")
+		}
+		p.next()
+		return Variable(p.expect('n'))
+	case 'i':
+		p.next()
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			p.fail("invalid int %v", tok.value)
+		}
+		return n
+	case 'f':
+		p.next()
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			p.fail("invalid float %v", tok.value)
+		}
+		return f
+	case 's':
+		p.next()
+		return tok.value
+	case 'n':
+		p.next()
+		switch tok.value {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return Enum(tok.value)
+	case '[':
+		p.next()
+		list := []Value{}
+		for !p.skip(']') {
+			list = append(list, p.value(constant))
+		}
+		return list
+	case '{':
+		p.next()
+		obj := map[string]Value{}
+		for !p.skip('}') {
+			name := p.expect('n')
+			p.expect(':')
+			obj[name] = p.value(constant)
+		}
+		return obj
+	}
+
+	p.fail("unexpected %v", p.describe())
+	return nil
+}
+
+// Lexer
+
+func (p *parser) next() {
+	p.skipIgnored()
+
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{pos: start}
+		return
+	}
+
+	c := p.src[p.pos]
+
+	switch {
+	case c == '.':
+		if !strings.HasPrefix(p.src[p.pos:], "...") {
+			p.tok = token{pos: start}
+			p.fail("unexpected .")
+		}
+		p.pos += 3
+		p.tok = token{'.', "...", start}
+	case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+		p.pos++
+		p.tok = token{c, string(c), start}
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{'n', p.src[start:p.pos], start}
+	case c == '-' || isDigit(c):
+		p.number()
+	case c == '"':
+		p.string()
+	default:
+		p.tok = token{pos: start}
+		p.fail("unexpected character %q", c)
+	}
+}
+
+func (p *parser) skipIgnored() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case strings.HasPrefix(p.src[p.pos:], "\ufeff"):
+			p.pos += 3
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) number() {
+	start := p.pos
+	kind := byte('i')
+
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	p.digits()
+
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		kind = 'f'
+		p.pos++
+		p.digits()
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		kind = 'f'
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		p.digits()
+	}
+
+	p.tok = token{kind, p.src[start:p.pos], start}
+}
+
+func (p *parser) digits() {
+	start := p.pos
+	for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		p.tok = token{pos: start}
+		p.fail("invalid number")
+	}
+}
+
+func (p *parser) string() {
+	start := p.pos
+	p.pos++
+
+	var b strings.Builder
+
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			p.tok = token{pos: start}
+			p.fail("unterminated string")
+		}
+
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			p.tok = token{'s', b.String(), start}
+			return
+		case '\\':
+			p.pos++
+			if p.pos >= len(p.src) {
+				continue
+			}
+			esc := p.src[p.pos]
+			p.pos++
+			switch esc {
+			case '"', '\\', '/':
+				b.WriteByte(esc)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if p.pos+4 > len(p.src) {
+					p.tok = token{pos: start}
+					p.fail("invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					p.tok = token{pos: start}
+					p.fail("invalid unicode escape")
+				}
+				b.WriteRune(rune(r))
+				p.pos += 4
+			default:
+				p.tok = token{pos: start}
+				p.fail("invalid escape \\%c", esc)
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			b.WriteRune(r)
+			p.pos += size
+		}
+	}
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,64 @@
+package graphql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+		query Blocks($limit: Int = 5) {
+			latest: blocks(limit: $limit, order: DESC) { number ...hashes }
+		}
+		fragment hashes on Block { hash parentHash }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doc.Operations) != 1 {
+		t.Fatalf("%v operations, want 1", len(doc.Operations))
+	}
+	op := doc.Operations[0]
+	if op.Name != "Blocks" || len(op.Variables) != 1 || op.Variables[0].Name != "limit" || op.Variables[0].Default != int64(5) {
+		t.Errorf("operation = %+v, want Blocks($limit = 5)", op)
+	}
+
+	f := op.Selections[0].(*Field)
+	if f.Alias != "latest" || f.Name != "blocks" {
+		t.Errorf("field = %v: %v, want latest: blocks", f.Alias, f.Name)
+	}
+	args := map[string]Value{"limit": Variable("limit"), "order": Enum("DESC")}
+	if !reflect.DeepEqual(f.Arguments, args) {
+		t.Errorf("arguments = %v, want %v", f.Arguments, args)
+	}
+	if s, ok := f.Selections[1].(*FragmentSpread); !ok || s.Name != "hashes" {
+		t.Errorf("selection = %#v, want ...hashes", f.Selections[1])
+	}
+
+	frag := doc.Fragments["hashes"]
+	if frag == nil || frag.On != "Block" || len(frag.Selections) != 2 {
+		t.Errorf("fragment = %+v, want hashes on Block with 2 fields", frag)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"{ blocks(limit: ) { number } }", "syntax error at line 1"},
+		{"{ blocks {\n number", "syntax error at line 2"},
+		{"{ blocks { } }", "syntax error"},
+		{"fragment f on Block { number } fragment f on Block { hash }", "f"},
+		{"fragment f on Block { number }", "no operation"},
+		{"mutation { blocks { number } }", "mutation"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.query)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Parse(%q) error = %v, want %q", tt.query, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package health answers liveness and readiness probes for both the api and the crawler.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/ubiq/spectrum-backend/params"
+	"github.com/ubiq/spectrum-backend/rpc"
+	"github.com/ubiq/spectrum-backend/storage"
+)
+
+// Probes must answer even when mongo or the node hang
+const checkTimeout = 5 * time.Second
+
+var (
+	errLagging = errors.New("indexed head is too far behind the node")
+	errStale   = errors.New("latest indexed block is too old")
+)
+
+type Config struct {
+	// Blocks the indexed head may be behind the node head, 0 disables the check
+	MaxLag uint64 `json:"maxlag"`
+	// Age the latest indexed block may have, e.g. "10m", empty disables the check
+	MaxAge string `json:"maxage"`
+}
+
+type Check struct {
+	Ok      bool        `json:"ok"`
+	Error   string      `json:"error,omitempty"`
+	Took    string      `json:"took"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+type Status struct {
+	Status  string            `json:"status"`
+	Version string            `json:"version"`
+	Checks  map[string]*Check `json:"checks,omitempty"`
+}
+
+type Checker struct {
+	backend *storage.MongoDB
+	rpc     *rpc.RPCClient
+	maxLag  uint64
+	maxAge  time.Duration
+}
+
+type lagDetails struct {
+	IndexedHead uint64 `json:"indexedHead"`
+	NodeHead    uint64 `json:"nodeHead"`
+	Lag         uint64 `json:"lag"`
+	MaxLag      uint64 `json:"maxLag"`
+}
+
+type ageDetails struct {
+	IndexedHead uint64 `json:"indexedHead"`
+	Timestamp   uint64 `json:"timestamp"`
+	Age         string `json:"age"`
+	MaxAge      string `json:"maxAge"`
+}
+
+func New(backend *storage.MongoDB, rpc *rpc.RPCClient, cfg *Config) *Checker {
+	c := &Checker{backend: backend, rpc: rpc, maxLag: cfg.MaxLag}
+
+	if cfg.MaxAge != "" {
+		maxAge, err := time.ParseDuration(cfg.MaxAge)
+		if err != nil {
+			log.Fatalf("Health: can't parse max age: %v", err)
+		}
+		c.maxAge = maxAge
+	}
+
+	return c
+}
+
+// Healthz only tells the process is up.
+func (c *Checker) Healthz(w http.ResponseWriter, r *http.Request) {
+	send(w, http.StatusOK, &Status{Status: "ok", Version: params.VersionWithMeta})
+}
+
+// Readyz runs every check, it fails with 503 when any of them does.
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	checks := map[string]func(context.Context) (interface{}, error){
+		"mongo": func(ctx context.Context) (interface{}, error) {
+			return nil, c.backend.Ping(ctx)
+		},
+		"rpc": func(context.Context) (interface{}, error) {
+			return nil, c.rpc.Ping()
+		},
+	}
+	if c.maxLag > 0 {
+		checks["lag"] = c.checkLag
+	}
+	if c.maxAge > 0 {
+		checks["age"] = c.checkAge
+	}
+
+	status := &Status{Status: "ok", Version: params.VersionWithMeta, Checks: c.run(ctx, checks)}
+
+	code := http.StatusOK
+	for _, check := range status.Checks {
+		if !check.Ok {
+			status.Status = "fail"
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	send(w, code, status)
+}
+
+// run runs the checks concurrently, the ones still running at the deadline fail.
+func (c *Checker) run(ctx context.Context, checks map[string]func(context.Context) (interface{}, error)) map[string]*Check {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	results := make(map[string]*Check, len(checks))
+	for name := range checks {
+		results[name] = &Check{Error: "timed out", Took: checkTimeout.String()}
+	}
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) (interface{}, error)) {
+			defer wg.Done()
+
+			start := time.Now()
+			details, err := check(ctx)
+
+			result := &Check{Ok: err == nil, Took: time.Since(start).String(), Details: details}
+			if err != nil {
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			if ctx.Err() == nil {
+				results[name] = result
+			}
+			mu.Unlock()
+		}(name, check)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	out := make(map[string]*Check, len(results))
+	for k, v := range results {
+		out[k] = v
+	}
+	return out
+}
+
+func (c *Checker) checkLag(ctx context.Context) (interface{}, error) {
+	block, err := c.backend.LatestBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := c.rpc.LatestBlockNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	details := &lagDetails{IndexedHead: block.Number, NodeHead: head, MaxLag: c.maxLag}
+	if head > block.Number {
+		details.Lag = head - block.Number
+	}
+
+	if details.Lag > c.maxLag {
+		return details, errLagging
+	}
+	return details, nil
+}
+
+func (c *Checker) checkAge(ctx context.Context) (interface{}, error) {
+	block, err := c.backend.LatestBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	age := time.Since(time.Unix(int64(block.Timestamp), 0)).Truncate(time.Second)
+
+	details := &ageDetails{IndexedHead: block.Number, Timestamp: block.Timestamp, Age: age.String(), MaxAge: c.maxAge.String()}
+
+	if age > c.maxAge {
+		return details, errStale
+	}
+	return details, nil
+}
+
+func send(w http.ResponseWriter, code int, status *Status) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
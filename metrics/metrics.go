@@ -0,0 +1,286 @@
+// Package metrics keeps counters, gauges and histograms in memory and exposes them in the
+// Prometheus text format. Metrics are registered once, usually as package variables, and
+// labelled with the values passed to every update in the order the labels were declared.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// DefaultBuckets fit request latencies in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+var registry = struct {
+	sync.Mutex
+	names   map[string]bool
+	metrics []metric
+}{names: make(map[string]bool)}
+
+func register(name string, m metric) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.names[name] {
+		panic("metrics: " + name + " registered twice")
+	}
+	registry.names[name] = true
+	registry.metrics = append(registry.metrics, m)
+}
+
+// Handler serves every registered metric.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		registry.Lock()
+		metrics := registry.metrics
+		registry.Unlock()
+
+		for _, m := range metrics {
+			m.write(w)
+		}
+	})
+}
+
+// desc holds what every metric has in common and the series by label values.
+type desc struct {
+	sync.Mutex
+	name, help, kind string
+	labels           []string
+	series           map[string]interface{}
+}
+
+func newDesc(name, help, kind string, labels []string) desc {
+	return desc{name: name, help: help, kind: kind, labels: labels, series: make(map[string]interface{})}
+}
+
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %v takes %v label values, got %v", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelSet formats the labels of a series, extra is appended as is.
+func (d *desc) labelSet(key string, extra string) string {
+	pairs := make([]string, 0, len(d.labels)+1)
+	if len(d.labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+`="`+labelEscaper.Replace(v)+`"`)
+		}
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// sortedKeys returns the series keys in a stable order, the caller holds the lock.
+func (d *desc) sortedKeys() []string {
+	keys := make([]string, 0, len(d.series))
+	for k := range d.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (d *desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", d.name, d.help, d.name, d.kind)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// value is a counter or gauge series.
+type value struct {
+	v float64
+}
+
+type valueMetric struct {
+	desc
+}
+
+func (m *valueMetric) get(values []string) *value {
+	k := m.key(values)
+	s, ok := m.series[k]
+	if !ok {
+		s = &value{}
+		m.series[k] = s
+	}
+	return s.(*value)
+}
+
+// Value returns the current value of a series, 0 when it has never been updated.
+func (m *valueMetric) Value(values ...string) float64 {
+	m.Lock()
+	defer m.Unlock()
+	return m.get(values).v
+}
+
+func (m *valueMetric) write(w io.Writer) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.header(w)
+	for _, k := range m.sortedKeys() {
+		fmt.Fprintf(w, "%v%v %v\n", m.name, m.labelSet(k, ""), formatFloat(m.series[k].(*value).v))
+	}
+}
+
+// Counter only goes up.
+type Counter struct {
+	valueMetric
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{valueMetric{newDesc(name, help, "counter", labels)}}
+	register(name, c)
+	return c
+}
+
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("metrics: counter " + c.name + " can't decrease")
+	}
+	c.Lock()
+	c.get(values).v += v
+	c.Unlock()
+}
+
+// Gauge can go up and down.
+type Gauge struct {
+	valueMetric
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{valueMetric{newDesc(name, help, "gauge", labels)}}
+	register(name, g)
+	return g
+}
+
+func (g *Gauge) Set(v float64, values ...string) {
+	g.Lock()
+	g.get(values).v = v
+	g.Unlock()
+}
+
+// SetMax sets the gauge to v unless it's already higher, for values updated concurrently
+// out of order.
+func (g *Gauge) SetMax(v float64, values ...string) {
+	g.Lock()
+	if s := g.get(values); v > s.v {
+		s.v = v
+	}
+	g.Unlock()
+}
+
+// funcMetric reads its only value when scraped.
+type funcMetric struct {
+	desc
+	f func() float64
+}
+
+func (m *funcMetric) write(w io.Writer) {
+	m.header(w)
+	fmt.Fprintf(w, "%v %v\n", m.name, formatFloat(m.f()))
+}
+
+// NewGaugeFunc registers a gauge whose value is computed by f on every scrape.
+func NewGaugeFunc(name, help string, f func() float64) {
+	register(name, &funcMetric{newDesc(name, help, "gauge", nil), f})
+}
+
+// NewCounterFunc registers a counter kept elsewhere, f must never decrease.
+func NewCounterFunc(name, help string, f func() float64) {
+	register(name, &funcMetric{newDesc(name, help, "counter", nil), f})
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	desc
+	buckets []float64
+}
+
+type histogramSeries struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{newDesc(name, help, "histogram", labels), buckets}
+	register(name, h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.Lock()
+	defer h.Unlock()
+
+	k := h.key(values)
+	s, ok := h.series[k]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[k] = s
+	}
+
+	series := s.(*histogramSeries)
+	for i, b := range h.buckets {
+		if v <= b {
+			series.counts[i]++
+		}
+	}
+	series.sum += v
+	series.count++
+}
+
+// Since observes the seconds elapsed since start.
+func (h *Histogram) Since(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.header(w)
+	for _, k := range h.sortedKeys() {
+		s := h.series[k].(*histogramSeries)
+
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%v_bucket%v %v\n", h.name, h.labelSet(k, `le="`+formatFloat(b)+`"`), s.counts[i])
+		}
+		fmt.Fprintf(w, "%v_bucket%v %v\n", h.name, h.labelSet(k, `le="+Inf"`), s.count)
+		fmt.Fprintf(w, "%v_sum%v %v\n", h.name, h.labelSet(k, ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%v_count%v %v\n", h.name, h.labelSet(k, ""), s.count)
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+const (
+	ROLE_FROM = "from"
+	ROLE_TO   = "to"
+	ROLE_SELF = "self"
+
+	KIND_TX       = "tx"
+	KIND_TRANSFER = "transfer"
+)
+
+// AddressActivity is one row of the address activity index. Every transaction and token
+// transfer produces a row for its sender and one for its recipient, or a single "self" row
+// when both are the same address, so account history is a range scan over one index.
+type AddressActivity struct {
+	Address     string `bson:"address" json:"address"`
+	BlockNumber uint64 `bson:"blockNumber" json:"blockNumber"`
+	TxIndex     uint64 `bson:"txIndex" json:"txIndex"`
+	Role        string `bson:"role" json:"role"`
+	Kind        string `bson:"kind" json:"kind"`
+	Hash        string `bson:"hash" json:"hash"`
+	Contract    string `bson:"contract,omitempty" json:"contract,omitempty"`
+}
+
+func newActivity(from, to string, row AddressActivity) []*AddressActivity {
+	if from == to {
+		self := row
+		self.Address, self.Role = from, ROLE_SELF
+		return []*AddressActivity{&self}
+	}
+
+	result := make([]*AddressActivity, 0, 2)
+
+	if from != "" {
+		sender := row
+		sender.Address, sender.Role = from, ROLE_FROM
+		result = append(result, &sender)
+	}
+
+	// Contract creations have no recipient
+	if to != "" {
+		recipient := row
+		recipient.Address, recipient.Role = to, ROLE_TO
+		result = append(result, &recipient)
+	}
+
+	return result
+}
+
+func (tx *Transaction) Activity() []*AddressActivity {
+	return newActivity(tx.From, tx.To, AddressActivity{
+		BlockNumber: tx.BlockNumber,
+		TxIndex:     tx.TransactionIndex,
+		Kind:        KIND_TX,
+		Hash:        tx.Hash,
+	})
+}
+
+func (tt *TokenTransfer) Activity() []*AddressActivity {
+	return newActivity(tt.From, tt.To, AddressActivity{
+		BlockNumber: tt.BlockNumber,
+		TxIndex:     tt.TransactionIndex,
+		Kind:        KIND_TRANSFER,
+		Hash:        tt.Hash,
+		Contract:    tt.Contract,
+	})
+}
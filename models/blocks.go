@@ -29,6 +29,12 @@ type RawBlock struct {
 	Nonce           string           `bson:"nonce" json:"nonce"`
 	Uncles          []string         `bson:"uncles" json:"uncles"`
 	//
+	StateRoot        string `bson:"stateRoot" json:"stateRoot"`
+	TransactionsRoot string `bson:"transactionsRoot" json:"transactionsRoot"`
+	ReceiptsRoot     string `bson:"receiptsRoot" json:"receiptsRoot"`
+	LogsBloom        string `bson:"logsBloom" json:"logsBloom"`
+	MixHash          string `bson:"mixHash" json:"mixHash"`
+	//
 	BlockReward  string `bson:"blockReward" json:"blockReward"`
 	UnclesReward string `bson:"unclesReward" json:"unclesReward"`
 	AvgGasPrice  string `bson:"avgGasPrice" json:"avgGasPrice"`
@@ -55,6 +61,12 @@ func (b *RawBlock) Convert() *Block {
 		Nonce:           b.Nonce,
 		Uncles:          b.Uncles,
 		UncleNo:         len(b.Uncles),
+		//
+		StateRoot:        b.StateRoot,
+		TransactionsRoot: b.TransactionsRoot,
+		ReceiptsRoot:     b.ReceiptsRoot,
+		LogsBloom:        b.LogsBloom,
+		MixHash:          b.MixHash,
 		// Empty
 		BlockReward:  "0",
 		UnclesReward: "0",
@@ -88,6 +100,13 @@ type Block struct {
 	// Same as Txs
 	Uncles  []string `bson:"-" json:"-"`
 	UncleNo int      `bson:"uncles" json:"uncles"`
+	// Header fields only served by the JSON-RPC endpoint, empty on blocks indexed before
+	// they were stored
+	StateRoot        string `bson:"stateRoot,omitempty" json:"-"`
+	TransactionsRoot string `bson:"transactionsRoot,omitempty" json:"-"`
+	ReceiptsRoot     string `bson:"receiptsRoot,omitempty" json:"-"`
+	LogsBloom        string `bson:"logsBloom,omitempty" json:"-"`
+	MixHash          string `bson:"mixHash,omitempty" json:"-"`
 	// TODO: These should be strings
 	BlockReward  string `bson:"blockReward" json:"blockReward"`
 	UnclesReward string `bson:"unclesReward" json:"unclesReward"`
@@ -95,4 +114,7 @@ type Block struct {
 	TxFees       string `bson:"txFees" json:"txFees"`
 	//
 	ExtraData string `bson:"extraData" json:"extraData"`
+	// Pruned is set once transactions, transfers and uncles of the block were dropped
+	// by the retention rules, only the header is kept
+	Pruned bool `bson:"pruned,omitempty" json:"pruned,omitempty"`
 }
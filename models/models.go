@@ -1,15 +1,34 @@
 package models
 
 const (
-	BLOCKS    = "blocks"
-	TXNS      = "transactions"
-	UNCLES    = "uncles"
-	TRANSFERS = "tokentransfers"
-	REORGS    = "forkedblocks"
-	CHARTS    = "charts"
-	STORE     = "sysstores"
+	BLOCKS     = "blocks"
+	TXNS       = "transactions"
+	UNCLES     = "uncles"
+	TRANSFERS  = "tokentransfers"
+	REORGS     = "forkedblocks"
+	CHARTS     = "charts"
+	STORE      = "sysstores"
+	ACTIVITY   = "addressactivity"
+	COUNTERS   = "counters"
+	PARTITIONS = "partitions"
+	APIKEYS    = "apikeys"
+	TOKENS     = "tokens"
+	BALANCES   = "tokenbalances"
 )
 
+// ApiKey identifies an api client, the tier selects its rate limit.
+type ApiKey struct {
+	Key      string `bson:"key" json:"key"`
+	Name     string `bson:"name" json:"name"`
+	Tier     string `bson:"tier" json:"tier"`
+	Disabled bool   `bson:"disabled" json:"disabled"`
+}
+
+type Counter struct {
+	Name  string `bson:"_id" json:"name"`
+	Count int64  `bson:"count" json:"count"`
+}
+
 type Store struct {
 	Timestamp   int64     `bson:"timestamp" json:"timestamp"`
 	Symbol      string    `bson:"symbol" json:"symbol"`
@@ -0,0 +1,33 @@
+package models
+
+// Token holds the ERC20 metadata of a contract seen in token transfers. Contracts that don't
+// implement a method keep its field empty. Tokens are paged by their first transfer.
+type Token struct {
+	Contract    string `bson:"contract" json:"contract"`
+	Name        string `bson:"name" json:"name"`
+	Symbol      string `bson:"symbol" json:"symbol"`
+	Decimals    uint64 `bson:"decimals" json:"decimals"`
+	TotalSupply string `bson:"totalSupply" json:"totalSupply"`
+	FirstBlock  uint64 `bson:"firstBlock" json:"firstBlock"`
+	FirstIndex  uint64 `bson:"firstIndex" json:"firstIndex"`
+	// Unix time of the last metadata refresh
+	UpdatedAt int64 `bson:"updatedAt" json:"updatedAt"`
+	// Filled from the holder counter when served, never stored
+	Holders int `bson:"-" json:"holders"`
+}
+
+// TokenBalance is the balance of a holder of a token, kept from the indexed transfers and
+// checked against balanceOf. Balance is an exact integer, it can be negative until checked
+// when transfers were missed.
+type TokenBalance struct {
+	Contract string `bson:"contract" json:"contract"`
+	Holder   string `bson:"holder" json:"holder"`
+	Balance  string `bson:"balance" json:"balance"`
+	// Positive balances zero padded to sort as numbers, empty for the others
+	Rank string `bson:"rank" json:"-"`
+	// Unix time and block of the last balanceOf check, 0 when never checked
+	CheckedAt    int64  `bson:"checkedAt" json:"checkedAt"`
+	CheckedBlock uint64 `bson:"checkedBlock" json:"checkedBlock"`
+	// Filled from the token registry when served, never stored
+	FormattedBalance string `bson:"-" json:"formattedBalance,omitempty"`
+}
@@ -38,6 +38,9 @@ func (rt *RawTransaction) Convert() *Transaction {
 		TransactionIndex: util.DecodeHex(rt.TransactionIndex),
 		From:             rt.From,
 		To:               rt.To,
+		V:                rt.V,
+		R:                rt.R,
+		S:                rt.S,
 		//
 		// GasUsed         :
 		// ContractAddress :
@@ -59,11 +62,23 @@ type Transaction struct {
 	TransactionIndex uint64 `bson:"transactionIndex" json:"transactionIndex"`
 	From             string `bson:"from" json:"from"`
 	To               string `bson:"to" json:"to"`
+	// Signature, only served by the JSON-RPC endpoint
+	V string `bson:"v,omitempty" json:"-"`
+	R string `bson:"r,omitempty" json:"-"`
+	S string `bson:"s,omitempty" json:"-"`
 	//
 	GasUsed         uint64  `bson:"gasUsed" json:"gasUsed"`
 	ContractAddress string  `bson:"contractAddress" json:"contractAddress"`
 	Logs            []TxLog `bson:"logs" json:"logs"`
+	// Receipt fields only served by the JSON-RPC endpoint, empty on transactions indexed
+	// before they were stored
+	CumulativeGasUsed uint64 `bson:"cumulativeGasUsed,omitempty" json:"-"`
+	Status            string `bson:"status,omitempty" json:"-"`
+	LogsBloom         string `bson:"logsBloom,omitempty" json:"-"`
 	//
+	// Pruned is set once input and logs were dropped by the retention rules, and on the
+	// stub answered for a transaction dropped with its block body
+	Pruned bool `bson:"pruned,omitempty" json:"pruned,omitempty"`
 }
 
 func (tx *Transaction) IsTokenTransfer() bool {
@@ -150,14 +165,20 @@ func (tx *Transaction) GetTokenTransfer() *TokenTransfer {
 }
 
 type TokenTransfer struct {
-	BlockNumber uint64 `bson:"blockNumber" json:"blockNumber"`
-	Hash        string `bson:"hash" json:"hash"`
-	Timestamp   uint64 `bson:"timestamp" json:"timestamp"`
-	From        string `bson:"from" json:"from"`
-	To          string `bson:"to" json:"to"`
-	Value       string `bson:"value" json:"value"`
-	Contract    string `bson:"contract" json:"contract"`
-	Method      string `bson:"method" json:"method"`
+	BlockNumber      uint64 `bson:"blockNumber" json:"blockNumber"`
+	TransactionIndex uint64 `bson:"transactionIndex" json:"transactionIndex"`
+	Hash             string `bson:"hash" json:"hash"`
+	Timestamp        uint64 `bson:"timestamp" json:"timestamp"`
+	From             string `bson:"from" json:"from"`
+	To               string `bson:"to" json:"to"`
+	Value            string `bson:"value" json:"value"`
+	Contract         string `bson:"contract" json:"contract"`
+	Method           string `bson:"method" json:"method"`
+	// Filled from the token registry when served, never stored
+	Symbol         string `bson:"-" json:"symbol,omitempty"`
+	FormattedValue string `bson:"-" json:"formattedValue,omitempty"`
+	// Pruned is set on the stub answered for a transfer dropped with its block body
+	Pruned bool `bson:"pruned,omitempty" json:"pruned,omitempty"`
 }
 
 type RawTxReceipt struct {
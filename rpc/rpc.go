@@ -9,12 +9,41 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/ubiq/spectrum-backend/metrics"
 	"github.com/ubiq/spectrum-backend/models"
 	"github.com/ubiq/spectrum-backend/util"
 )
 
+var (
+	rpcDuration = metrics.NewHistogram("spectrum_rpc_request_duration_seconds", "Duration of node RPC calls by method.", metrics.DefaultBuckets, "method")
+	rpcErrors   = metrics.NewCounter("spectrum_rpc_errors_total", "Node RPC calls that failed by method.", "method")
+
+	// Methods forwarded for clients are not known in advance, past maxMethodLabels they
+	// are counted as "other"
+	methodLabels = struct {
+		sync.Mutex
+		seen map[string]bool
+	}{seen: make(map[string]bool)}
+)
+
+const maxMethodLabels = 100
+
+func methodLabel(method string) string {
+	methodLabels.Lock()
+	defer methodLabels.Unlock()
+
+	if !methodLabels.seen[method] {
+		if len(methodLabels.seen) >= maxMethodLabels {
+			return "other"
+		}
+		methodLabels.seen[method] = true
+	}
+	return method
+}
+
 type Config struct {
 	Url     string
 	Timeout string
@@ -46,6 +75,19 @@ func NewRPCClient(cfg *Config) *RPCClient {
 }
 
 func (r *RPCClient) doPost(method string, params interface{}) (*JSONRpcResp, error) {
+	start := time.Now()
+
+	resp, err := r.post(method, params)
+
+	label := methodLabel(method)
+	rpcDuration.Since(start, label)
+	if err != nil {
+		rpcErrors.Inc(label)
+	}
+	return resp, err
+}
+
+func (r *RPCClient) post(method string, params interface{}) (*JSONRpcResp, error) {
 	jq := map[string]interface{}{
 		"jsonrpc": "2.0",
 		"method":  method,
@@ -178,3 +220,32 @@ func (r *RPCClient) Ping() error {
 	}
 	return nil
 }
+
+// Call runs any JSON-RPC method on the node and returns its raw result.
+func (r *RPCClient) Call(method string, params interface{}) (json.RawMessage, error) {
+	rpcResp, err := r.doPost(method, params)
+	if err != nil {
+		return nil, err
+	}
+	if rpcResp.Result != nil {
+		return *rpcResp.Result, nil
+	}
+	return json.RawMessage("null"), nil
+}
+
+// GetBalance returns the balance of address in wei at the block tag, e.g. "latest".
+func (r *RPCClient) GetBalance(address, tag string) (string, error) {
+	rpcResp, err := r.doPost("eth_getBalance", []string{address, tag})
+	if err != nil {
+		return "", err
+	}
+	if rpcResp.Result != nil {
+		var reply string
+		err = json.Unmarshal(*rpcResp.Result, &reply)
+		if err != nil {
+			return "", err
+		}
+		return util.DecodeValueHex(reply), nil
+	}
+	return "0", nil
+}
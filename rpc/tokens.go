@@ -0,0 +1,132 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ubiq/spectrum-backend/models"
+	"github.com/ubiq/spectrum-backend/util"
+)
+
+// ERC20 method selectors
+const (
+	selectorName        = "0x06fdde03"
+	selectorSymbol      = "0x95d89b41"
+	selectorDecimals    = "0x313ce567"
+	selectorTotalSupply = "0x18160ddd"
+	selectorBalanceOf   = "0x70a08231"
+)
+
+// Decimals past this can't be a real token, uint256 can't hold more digits
+const maxDecimals = 77
+
+var (
+	errNoTokenData = errors.New("contract answered none of the ERC20 methods")
+	errNoBalance   = errors.New("contract doesn't answer balanceOf")
+)
+
+// EthCall runs a read only call of contract at the block tag and returns the hex result, "0x"
+// when the contract has no code for it.
+func (r *RPCClient) EthCall(contract, data, tag string) (string, error) {
+	rpcResp, err := r.doPost("eth_call", []interface{}{map[string]string{"to": contract, "data": data}, tag})
+	if err != nil {
+		return "", err
+	}
+	if rpcResp.Result == nil {
+		return "0x", nil
+	}
+
+	var reply string
+	err = json.Unmarshal(*rpcResp.Result, &reply)
+	return reply, err
+}
+
+// GetToken reads the ERC20 metadata of contract. Methods the contract doesn't implement leave
+// their field empty, it fails only when none of them answered.
+func (r *RPCClient) GetToken(contract string) (*models.Token, error) {
+	token := &models.Token{Contract: contract}
+
+	var answered int
+	var lastErr error
+
+	call := func(selector string) []byte {
+		reply, err := r.EthCall(contract, selector, "latest")
+		if err != nil {
+			lastErr = err
+			return nil
+		}
+		b, err := util.Decode(reply)
+		if err != nil || len(b) == 0 {
+			return nil
+		}
+		answered++
+		return b
+	}
+
+	if b := call(selectorName); b != nil {
+		token.Name = decodeString(b)
+	}
+	if b := call(selectorSymbol); b != nil {
+		token.Symbol = decodeString(b)
+	}
+	if b := call(selectorDecimals); len(b) >= 32 {
+		if d := new(big.Int).SetBytes(b[:32]); d.IsUint64() && d.Uint64() <= maxDecimals {
+			token.Decimals = d.Uint64()
+		}
+	}
+	if b := call(selectorTotalSupply); len(b) >= 32 {
+		token.TotalSupply = new(big.Int).SetBytes(b[:32]).String()
+	}
+
+	if answered == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, errNoTokenData
+	}
+	return token, nil
+}
+
+// TokenBalance returns the balance of holder in contract at block.
+func (r *RPCClient) TokenBalance(contract, holder string, block uint64) (*big.Int, error) {
+	data := selectorBalanceOf + strings.Repeat("0", 24) + strings.TrimPrefix(holder, "0x")
+
+	reply, err := r.EthCall(contract, data, util.EncodeUint64(block))
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := util.Decode(reply)
+	if err != nil || len(b) < 32 {
+		return nil, errNoBalance
+	}
+	return new(big.Int).SetBytes(b[:32]), nil
+}
+
+// decodeString reads an ABI encoded string, older tokens return a bytes32 instead.
+func decodeString(b []byte) string {
+	var s []byte
+
+	if len(b) >= 64 {
+		offset := new(big.Int).SetBytes(b[:32])
+		if offset.IsUint64() && offset.Uint64()+32 <= uint64(len(b)) {
+			start := offset.Uint64()
+			length := new(big.Int).SetBytes(b[start : start+32])
+			if length.IsUint64() && start+32+length.Uint64() <= uint64(len(b)) {
+				s = b[start+32 : start+32+length.Uint64()]
+			}
+		}
+	}
+	if s == nil && len(b) >= 32 {
+		s = b[:32]
+	}
+
+	str := strings.TrimRight(string(s), "\x00")
+	if !utf8.ValidString(str) {
+		return ""
+	}
+	return strings.TrimSpace(str)
+}
@@ -0,0 +1,367 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubiq/spectrum-backend/models"
+)
+
+/*
+	Token balances are kept per (contract, holder): every transfer written moves its value
+	from the sender to the recipient and a purge moves it back. Transfers of failed
+	transactions move nothing, mints come from the zero address which has no balance.
+	Balances drift when transfers are missed, the crawler checks them against balanceOf at a
+	block and adds the transfers indexed above it.
+*/
+
+// Digits of the largest uint256, the width of a rank
+const rankWidth = 78
+
+const zeroAddress = "0x0000000000000000000000000000000000000000"
+
+// balanceLock serializes writing or removing transfers with the balance updates they make,
+// a check must find every transfer above its block either applied or not written yet.
+var balanceLock sync.Mutex
+
+type balanceKey struct {
+	contract, holder string
+}
+
+type balanceDeltas map[balanceKey]*big.Int
+
+func (d balanceDeltas) move(contract, holder string, v *big.Int, sign int) {
+	if holder == zeroAddress || holder == "" {
+		return
+	}
+
+	k := balanceKey{contract, holder}
+	if d[k] == nil {
+		d[k] = new(big.Int)
+	}
+	if sign < 0 {
+		d[k].Sub(d[k], v)
+	} else {
+		d[k].Add(d[k], v)
+	}
+}
+
+// add moves the value of t, sign is -1 to reverse it.
+func (d balanceDeltas) add(t *models.TokenTransfer, sign int) {
+	v, ok := new(big.Int).SetString(t.Value, 10)
+	if !ok || t.From == t.To {
+		return
+	}
+
+	d.move(t.Contract, t.From, v, -sign)
+	d.move(t.Contract, t.To, v, sign)
+}
+
+func transferBalances(transfers []models.TokenTransfer, failed map[string]bool, sign int) balanceDeltas {
+	d := make(balanceDeltas)
+	for i := range transfers {
+		if !failed[transfers[i].Hash] {
+			d.add(&transfers[i], sign)
+		}
+	}
+	return d
+}
+
+func holderCounter(contract string) string {
+	return "holders:" + contract
+}
+
+func rank(balance *big.Int) string {
+	if balance.Sign() <= 0 {
+		return ""
+	}
+	s := balance.String()
+	if len(s) >= rankWidth {
+		return s
+	}
+	return strings.Repeat("0", rankWidth-len(s)) + s
+}
+
+// failedTxs returns the hashes of the failed transactions in the blocks [from, to].
+func (m *MongoDB) failedTxs(from, to uint64) (map[string]bool, error) {
+	var txns []models.Transaction
+
+	selector := bson.M{"blockNumber": bson.M{"$gte": from, "$lte": to}, "status": "0x0"}
+	if err := m.findAll(models.TXNS, from, to, selector, &txns); err != nil {
+		return nil, err
+	}
+
+	failed := make(map[string]bool, len(txns))
+	for _, v := range txns {
+		failed[v.Hash] = true
+	}
+	return failed, nil
+}
+
+func (m *MongoDB) balance(k balanceKey) (*big.Int, error) {
+	var b models.TokenBalance
+
+	err := m.c(models.BALANCES).Find(bson.M{"contract": k.contract, "holder": k.holder}).One(&b)
+	if err == mgo.ErrNotFound {
+		return new(big.Int), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := new(big.Int).SetString(b.Balance, 10)
+	if !ok {
+		return new(big.Int), nil
+	}
+	return v, nil
+}
+
+// setBalance writes the balance of a holder and counts it in or out of the holders of the
+// token. set holds more fields to write.
+func (m *MongoDB) setBalance(k balanceKey, old, balance *big.Int, set bson.M, counters counterDeltas) error {
+	set["balance"] = balance.String()
+	set["rank"] = rank(balance)
+
+	_, err := m.c(models.BALANCES).Upsert(bson.M{"contract": k.contract, "holder": k.holder}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case old.Sign() <= 0 && balance.Sign() > 0:
+		counters.add(holderCounter(k.contract), 1)
+	case old.Sign() > 0 && balance.Sign() <= 0:
+		counters.add(holderCounter(k.contract), -1)
+	}
+	return nil
+}
+
+// applyBalances adds deltas to the balances, the caller holds balanceLock.
+func (m *MongoDB) applyBalances(deltas balanceDeltas, counters counterDeltas) error {
+	for k, d := range deltas {
+		if d.Sign() == 0 {
+			continue
+		}
+
+		old, err := m.balance(k)
+		if err != nil {
+			return err
+		}
+		if err := m.setBalance(k, old, new(big.Int).Add(old, d), bson.M{}, counters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BalancesToCheck returns the balances checked the longest time ago, never checked first.
+func (m *MongoDB) BalancesToCheck(ctx context.Context, limit int) ([]models.TokenBalance, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var balances []models.TokenBalance
+
+	err := m.c(models.BALANCES).Find(bson.M{}).Sort("checkedAt").Limit(limit).All(&balances)
+	return balances, err
+}
+
+// CheckBalance sets the balance of holder to balance, its balance at block on chain, plus
+// the transfers indexed above block. A nil balance only marks it as checked, for contracts
+// that don't answer balanceOf.
+func (m *MongoDB) CheckBalance(ctx context.Context, contract, holder string, balance *big.Int, block uint64) error {
+	m, done := m.scope(ctx)
+	defer done()
+
+	k := balanceKey{contract, holder}
+	set := bson.M{"checkedAt": time.Now().Unix(), "checkedBlock": block}
+
+	if balance == nil {
+		return m.c(models.BALANCES).Update(bson.M{"contract": contract, "holder": holder}, bson.M{"$set": set})
+	}
+
+	balanceLock.Lock()
+	defer balanceLock.Unlock()
+
+	var transfers []models.TokenTransfer
+
+	selector := bson.M{
+		"contract":    contract,
+		"blockNumber": bson.M{"$gt": block},
+		"$or":         []bson.M{{"from": holder}, {"to": holder}},
+	}
+	if err := m.findAll(models.TRANSFERS, block+1, math.MaxUint64, selector, &transfers); err != nil {
+		return err
+	}
+
+	failed, err := m.failedTxs(block+1, math.MaxUint64)
+	if err != nil {
+		return err
+	}
+
+	if d := transferBalances(transfers, failed, 1)[k]; d != nil {
+		balance = new(big.Int).Add(balance, d)
+	}
+
+	old, err := m.balance(k)
+	if err != nil {
+		return err
+	}
+
+	counters := make(counterDeltas)
+	if err := m.setBalance(k, old, balance, set, counters); err != nil {
+		return err
+	}
+	if old.Cmp(balance) != 0 {
+		log.Debugf("Corrected balance of %v in %v from %v to %v", holder, contract, old, balance)
+	}
+	return m.applyCounters(counters)
+}
+
+// BackfillBalances lists the holders of databases created before balances were kept, from
+// the address activity index. They start at zero until checked, BalancesToCheck returns them
+// first.
+func (m *MongoDB) BackfillBalances(ctx context.Context) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	ss := m.c(models.STORE)
+
+	n, err := ss.Find(bson.M{"symbol": "balances"}).Count()
+	if err != nil {
+		log.Errorf("Error getting balances backfill state: %v", err)
+		return
+	}
+	if n > 0 {
+		return
+	}
+
+	log.Warnf("Backfilling token holders")
+
+	start := time.Now()
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"kind": models.KIND_TRANSFER, "address": bson.M{"$ne": zeroAddress}}},
+		{"$group": bson.M{"_id": bson.M{"contract": "$contract", "address": "$address"}}},
+	}
+
+	var row struct {
+		ID bson.M `bson:"_id"`
+	}
+
+	iter := m.c(models.ACTIVITY).Pipe(pipeline).AllowDiskUse().Iter()
+
+	balances := m.c(models.BALANCES)
+	bulk := balances.Bulk()
+	bulk.Unordered()
+	queued, total := 0, 0
+
+	for iter.Next(&row) {
+		bulk.Upsert(bson.M{"contract": idString(row.ID, "contract"), "holder": idString(row.ID, "address")},
+			bson.M{"$setOnInsert": bson.M{"balance": "0", "rank": "", "checkedAt": 0, "checkedBlock": 0}})
+		queued++
+		total++
+
+		if queued == 1000 {
+			if _, err := bulk.Run(); err != nil {
+				log.Errorf("Error backfilling token holders: %v", err)
+				return
+			}
+			bulk = balances.Bulk()
+			bulk.Unordered()
+			queued = 0
+		}
+	}
+
+	if queued > 0 {
+		if _, err := bulk.Run(); err != nil {
+			log.Errorf("Error backfilling token holders: %v", err)
+			return
+		}
+	}
+
+	if err := iter.Close(); err != nil {
+		log.Errorf("Error backfilling token holders: %v", err)
+		return
+	}
+
+	if err := ss.Insert(&models.Store{Symbol: "balances"}); err != nil {
+		log.Errorf("Could not init sysStore(balances): %v", err)
+		return
+	}
+
+	log.Warnf("Backfilled %v token holders, took %v", total, time.Since(start))
+}
+
+// TokenHolders pages the holders of a token by balance, the cursor key is the rank followed
+// by the holder.
+func (m *MongoDB) TokenHolders(ctx context.Context, contract string, p Page) ([]models.TokenBalance, bool, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	query := bson.M{"contract": contract, "rank": bson.M{"$gt": ""}}
+
+	if p.After != nil {
+		if len(p.After.Key) <= rankWidth {
+			return nil, false, Invalid("invalid cursor")
+		}
+		r, holder := p.After.Key[:rankWidth], p.After.Key[rankWidth:]
+
+		op := "$gt"
+		if p.Desc {
+			op = "$lt"
+		}
+		query["$or"] = []bson.M{
+			{"rank": bson.M{op: r}},
+			{"rank": r, "holder": bson.M{op: holder}},
+		}
+	}
+
+	sort := []string{"rank", "holder"}
+	if p.Desc {
+		sort = []string{"-rank", "-holder"}
+	}
+
+	var holders []models.TokenBalance
+
+	err := m.c(models.BALANCES).Find(query).Sort(sort...).Limit(p.fetch()).All(&holders)
+	return holders, p.trim(&holders), err
+}
+
+func (m *MongoDB) TokenHolderCount(ctx context.Context, contract string) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	return m.counter(holderCounter(contract), models.BALANCES, bson.M{"contract": contract, "rank": bson.M{"$gt": ""}})
+}
+
+// HolderCounts returns the holder counters of contracts, tokens without one have no holders
+// yet or haven't been reconciled.
+func (m *MongoDB) HolderCounts(ctx context.Context, contracts []string) (map[string]int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	names := make([]string, len(contracts))
+	for i, v := range contracts {
+		names[i] = holderCounter(v)
+	}
+
+	var counters []models.Counter
+
+	err := m.c(models.COUNTERS).Find(bson.M{"_id": bson.M{"$in": names}}).All(&counters)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]int, len(counters))
+	for _, v := range counters {
+		result[strings.TrimPrefix(v.Name, "holders:")] = int(v.Count)
+	}
+	return result, nil
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ubiq/spectrum-backend/models"
+)
+
+func bigInt(t *testing.T, s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		t.Fatalf("invalid number %v", s)
+	}
+	return v
+}
+
+func TestRank(t *testing.T) {
+	tests := []struct {
+		balance string
+		rank    string
+	}{
+		{"0", ""},
+		{"-5", ""},
+		{"1", strings.Repeat("0", rankWidth-1) + "1"},
+		{"1000", strings.Repeat("0", rankWidth-4) + "1000"},
+		// The largest uint256 fills the width
+		{"115792089237316195423570985008687907853269984665640564039457584007913129639935", "115792089237316195423570985008687907853269984665640564039457584007913129639935"},
+	}
+
+	for _, tt := range tests {
+		if got := rank(bigInt(t, tt.balance)); got != tt.rank {
+			t.Errorf("rank(%v) = %q, want %q", tt.balance, got, tt.rank)
+		}
+	}
+}
+
+func TestRankOrder(t *testing.T) {
+	balances := []string{"9", "10", "1", "100000000000000000000", "99999999999999999999", "2"}
+
+	ranks := make([]string, len(balances))
+	for i, v := range balances {
+		ranks[i] = rank(bigInt(t, v))
+		if len(ranks[i]) != rankWidth {
+			t.Errorf("rank(%v) has width %v, want %v", v, len(ranks[i]), rankWidth)
+		}
+	}
+	sort.Strings(ranks)
+
+	want := []string{"1", "2", "9", "10", "99999999999999999999", "100000000000000000000"}
+	for i, v := range ranks {
+		if got := strings.TrimLeft(v, "0"); got != want[i] {
+			t.Errorf("rank %v sorts %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestTransferBalances(t *testing.T) {
+	const (
+		token = "0xc000000000000000000000000000000000000000"
+		alice = "0xa000000000000000000000000000000000000000"
+		bob   = "0xb000000000000000000000000000000000000000"
+	)
+
+	transfer := func(hash, from, to, value string) models.TokenTransfer {
+		return models.TokenTransfer{Hash: hash, Contract: token, From: from, To: to, Value: value}
+	}
+
+	tests := []struct {
+		name      string
+		transfers []models.TokenTransfer
+		failed    map[string]bool
+		sign      int
+		want      map[string]string
+	}{
+		{
+			name:      "transfer",
+			transfers: []models.TokenTransfer{transfer("0x1", alice, bob, "10")},
+			sign:      1,
+			want:      map[string]string{alice: "-10", bob: "10"},
+		},
+		{
+			name:      "reversed",
+			transfers: []models.TokenTransfer{transfer("0x1", alice, bob, "10")},
+			sign:      -1,
+			want:      map[string]string{alice: "10", bob: "-10"},
+		},
+		{
+			name:      "self transfer",
+			transfers: []models.TokenTransfer{transfer("0x1", alice, alice, "10")},
+			sign:      1,
+			want:      map[string]string{},
+		},
+		{
+			name:      "mint",
+			transfers: []models.TokenTransfer{transfer("0x1", zeroAddress, alice, "5")},
+			sign:      1,
+			want:      map[string]string{alice: "5"},
+		},
+		{
+			name:      "burn",
+			transfers: []models.TokenTransfer{transfer("0x1", alice, zeroAddress, "5")},
+			sign:      1,
+			want:      map[string]string{alice: "-5"},
+		},
+		{
+			name:      "failed transaction",
+			transfers: []models.TokenTransfer{transfer("0x1", alice, bob, "10"), transfer("0x2", bob, alice, "3")},
+			failed:    map[string]bool{"0x1": true},
+			sign:      1,
+			want:      map[string]string{alice: "3", bob: "-3"},
+		},
+		{
+			name:      "summed",
+			transfers: []models.TokenTransfer{transfer("0x1", alice, bob, "10"), transfer("0x2", bob, alice, "10")},
+			sign:      1,
+			want:      map[string]string{alice: "0", bob: "0"},
+		},
+		{
+			name:      "invalid value",
+			transfers: []models.TokenTransfer{transfer("0x1", alice, bob, "0x10")},
+			sign:      1,
+			want:      map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		d := transferBalances(tt.transfers, tt.failed, tt.sign)
+
+		if len(d) != len(tt.want) {
+			t.Errorf("%v: %v balances moved, want %v", tt.name, len(d), len(tt.want))
+		}
+		for holder, want := range tt.want {
+			got, ok := d[balanceKey{token, holder}]
+			if !ok {
+				t.Errorf("%v: no delta for %v", tt.name, holder)
+				continue
+			}
+			if got.String() != want {
+				t.Errorf("%v: delta of %v = %v, want %v", tt.name, holder, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo"
+)
+
+// Roles a connection is opened for, each role has its own read preference and write concern.
+const (
+	RoleCrawler = "crawler"
+	RoleApi     = "api"
+)
+
+type RoleConfig struct {
+	// primary, primaryPreferred, secondary, secondaryPreferred or nearest
+	ReadPreference string `json:"readpreference"`
+	WriteConcern   struct {
+		// Number of members or "majority"
+		W        string `json:"w"`
+		Journal  bool   `json:"j"`
+		WTimeout string `json:"wtimeout"`
+	} `json:"writeconcern"`
+}
+
+var readPreferences = map[string]mgo.Mode{
+	"primary":            mgo.Primary,
+	"primarypreferred":   mgo.PrimaryPreferred,
+	"secondary":          mgo.Secondary,
+	"secondarypreferred": mgo.SecondaryPreferred,
+	"nearest":            mgo.Nearest,
+}
+
+// dialInfo builds the dial settings from the URI, or from the individual fields without one.
+func dialInfo(cfg *Config, timeout time.Duration) (*mgo.DialInfo, error) {
+	var info *mgo.DialInfo
+
+	if cfg.URI != "" {
+		var err error
+
+		info, err = mgo.ParseURL(cfg.URI)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		addrs := strings.Split(cfg.Address, ",")
+		for i := range addrs {
+			addrs[i] = strings.TrimSpace(addrs[i])
+		}
+
+		info = &mgo.DialInfo{
+			Addrs:          addrs,
+			Database:       cfg.Database,
+			Username:       cfg.User,
+			Password:       cfg.Password,
+			Source:         cfg.AuthDB,
+			ReplicaSetName: cfg.ReplicaSet,
+		}
+	}
+
+	info.Timeout = timeout
+	if cfg.PoolLimit > 0 {
+		info.PoolLimit = cfg.PoolLimit
+	}
+
+	if cfg.TLS.Enabled {
+		tlsConfig, err := cfg.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		info.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+			return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr.String(), tlsConfig)
+		}
+	}
+
+	return info, nil
+}
+
+func (cfg *Config) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.TLS.Insecure}
+
+	if cfg.TLS.CAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.TLS.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %v", cfg.TLS.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLS.CertFile != "" || cfg.TLS.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// role returns the settings of a role, unknown roles are rejected.
+func (cfg *Config) role(role string) (*RoleConfig, error) {
+	switch role {
+	case RoleCrawler:
+		return &cfg.Crawler, nil
+	case RoleApi:
+		return &cfg.Api, nil
+	}
+	return nil, fmt.Errorf("unknown connection role %q", role)
+}
+
+// apply sets the read preference and write concern of the role on session, settings that
+// are left empty keep what the URI or the driver defaults set.
+func (r *RoleConfig) apply(session *mgo.Session) error {
+	if r.ReadPreference != "" {
+		mode, ok := readPreferences[strings.ToLower(r.ReadPreference)]
+		if !ok {
+			return fmt.Errorf("unknown read preference %q", r.ReadPreference)
+		}
+		session.SetMode(mode, true)
+	}
+
+	wc := r.WriteConcern
+
+	if wc.W == "" && !wc.Journal && wc.WTimeout == "" {
+		return nil
+	}
+
+	safe := session.Safe()
+	if safe == nil {
+		return errors.New("write concern can't be set on unacknowledged writes")
+	}
+
+	if wc.W != "" {
+		if n, err := strconv.Atoi(wc.W); err == nil {
+			safe.W, safe.WMode = n, ""
+		} else {
+			safe.W, safe.WMode = 0, wc.W
+		}
+	}
+
+	safe.J = wc.Journal
+
+	if wc.WTimeout != "" {
+		d, err := time.ParseDuration(wc.WTimeout)
+		if err != nil {
+			return err
+		}
+		safe.WTimeout = int(d / time.Millisecond)
+	}
+
+	session.SetSafe(safe)
+	return nil
+}
@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubiq/spectrum-backend/models"
+)
+
+/*
+	Counters replace collection wide Count() calls. Totals are keyed by collection name,
+	per address counters by "<kind>:<address>", per token by "contract:<contract>", per
+	token and account by "transfer:<contract>:<address>" and the holders of a token by
+	"holders:<contract>".
+
+	Counters are only trusted once the "counters" sysStore exists: new databases set it on
+	init, existing ones on their first complete reconciliation. Until then the first blocks
+	written would create counters from zero, totals are counted instead.
+*/
+
+const countersMarker = "counters"
+
+type counterState struct {
+	sync.Mutex
+	reconciled bool
+}
+
+func addressCounter(kind, address string) string {
+	return kind + ":" + address
+}
+
+func contractCounter(contract string) string {
+	return "contract:" + contract
+}
+
+func accountTokenCounter(contract, address string) string {
+	return models.KIND_TRANSFER + ":" + contract + ":" + address
+}
+
+type counterDeltas map[string]int
+
+func idString(id bson.M, key string) string {
+	s, _ := id[key].(string)
+	return s
+}
+
+func (c counterDeltas) add(name string, n int) {
+	if n != 0 {
+		c[name] += n
+	}
+}
+
+func (c counterDeltas) addActivity(a *models.AddressActivity, n int) {
+	c.add(addressCounter(a.Kind, a.Address), n)
+
+	if a.Kind == models.KIND_TRANSFER {
+		c.add(accountTokenCounter(a.Contract, a.Address), n)
+	}
+}
+
+func (m *MongoDB) applyCounters(deltas counterDeltas) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	bulk := m.c(models.COUNTERS).Bulk()
+	bulk.Unordered()
+
+	for k, v := range deltas {
+		bulk.Upsert(bson.M{"_id": k}, bson.M{"$inc": bson.M{"count": v}})
+	}
+
+	_, err := bulk.Run()
+	return err
+}
+
+// counter returns the value of a maintained counter, the matches of query in collection are
+// counted while the counter doesn't exist yet or before the first reconciliation of an
+// existing database.
+func (m *MongoDB) counter(name string, collection string, query bson.M) (int, error) {
+	reconciled, err := m.countersReconciled()
+	if err != nil {
+		return 0, err
+	}
+	if !reconciled {
+		return m.count(collection, 0, math.MaxUint64, query)
+	}
+
+	var counter models.Counter
+
+	err = m.c(models.COUNTERS).FindId(name).One(&counter)
+
+	if err == mgo.ErrNotFound {
+		return m.count(collection, 0, math.MaxUint64, query)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return int(counter.Count), nil
+}
+
+// countersReconciled reports whether the counters hold the totals of the whole index. The
+// marker is looked up until it's found, it's never removed.
+func (m *MongoDB) countersReconciled() (bool, error) {
+	m.counters.Lock()
+	reconciled := m.counters.reconciled
+	m.counters.Unlock()
+
+	if reconciled {
+		return true, nil
+	}
+
+	n, err := m.c(models.STORE).Find(bson.M{"symbol": countersMarker}).Count()
+	if err != nil || n == 0 {
+		return false, err
+	}
+
+	m.counters.Lock()
+	m.counters.reconciled = true
+	m.counters.Unlock()
+	return true, nil
+}
+
+// removalCounters collects the counter decrements for the transactions, uncles, token transfers
+// and, with activity, the activity rows in the blocks [from, to].
+func (m *MongoDB) removalCounters(from, to uint64, activity bool) (counterDeltas, error) {
+	var rows []models.AddressActivity
+	var transfers []models.TokenTransfer
+
+	selector := bson.M{"blockNumber": bson.M{"$gte": from, "$lte": to}}
+	counters := make(counterDeltas)
+
+	for _, c := range []string{models.TXNS, models.UNCLES} {
+		n, err := m.count(c, from, to, selector)
+		if err != nil {
+			return nil, err
+		}
+		counters.add(c, -n)
+	}
+
+	err := m.findAll(models.TRANSFERS, from, to, selector, &transfers)
+	if err != nil {
+		return nil, err
+	}
+	counters.add(models.TRANSFERS, -len(transfers))
+	for _, v := range transfers {
+		counters.add(contractCounter(v.Contract), -1)
+	}
+
+	if !activity {
+		return counters, nil
+	}
+
+	err = m.c(models.ACTIVITY).Find(selector).Select(bson.M{"address": 1, "kind": 1, "contract": 1}).All(&rows)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		counters.addActivity(&rows[i], -1)
+	}
+
+	return counters, nil
+}
+
+// purgeCounters collects the counter decrements for everything stored at height.
+func (m *MongoDB) purgeCounters(height uint64) (counterDeltas, error) {
+	counters, err := m.removalCounters(height, height, true)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := m.c(models.BLOCKS).Find(bson.M{"number": height}).Count()
+	if err != nil {
+		return nil, err
+	}
+	counters.add(models.BLOCKS, -n)
+
+	return counters, nil
+}
+
+// ReconcileCounters recomputes every counter from the indexed data, correcting any drift
+// left by interrupted writes. Blocks indexed while it runs may be off until the next run.
+func (m *MongoDB) ReconcileCounters(ctx context.Context) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	start := time.Now()
+	complete := true
+
+	counters := m.c(models.COUNTERS)
+
+	for _, c := range []string{models.BLOCKS, models.TXNS, models.UNCLES, models.TRANSFERS} {
+		n, err := m.count(c, 0, math.MaxUint64, bson.M{})
+		if err != nil {
+			log.Errorf("Error reconciling %v counter: %v", c, err)
+			return
+		}
+		if _, err := counters.UpsertId(c, bson.M{"$set": bson.M{"count": n}}); err != nil {
+			log.Errorf("Error reconciling %v counter: %v", c, err)
+			return
+		}
+	}
+
+	// Filters run on every partition, the grouping once on their combined rows
+	pipelines := []struct {
+		collection string
+		match      []bson.M
+		group      bson.M
+		name       func(id bson.M) string
+	}{
+		{
+			models.ACTIVITY,
+			[]bson.M{},
+			bson.M{"_id": bson.M{"kind": "$kind", "address": "$address"}, "count": bson.M{"$sum": 1}},
+			func(id bson.M) string { return addressCounter(idString(id, "kind"), idString(id, "address")) },
+		},
+		{
+			models.ACTIVITY,
+			[]bson.M{{"$match": bson.M{"kind": models.KIND_TRANSFER}}},
+			bson.M{"_id": bson.M{"contract": "$contract", "address": "$address"}, "count": bson.M{"$sum": 1}},
+			func(id bson.M) string { return accountTokenCounter(idString(id, "contract"), idString(id, "address")) },
+		},
+		{
+			models.TRANSFERS,
+			[]bson.M{{"$project": bson.M{"contract": 1}}},
+			bson.M{"_id": bson.M{"contract": "$contract"}, "count": bson.M{"$sum": 1}},
+			func(id bson.M) string { return contractCounter(idString(id, "contract")) },
+		},
+		{
+			models.BALANCES,
+			[]bson.M{{"$match": bson.M{"rank": bson.M{"$gt": ""}}}},
+			bson.M{"_id": bson.M{"contract": "$contract"}, "count": bson.M{"$sum": 1}},
+			func(id bson.M) string { return holderCounter(idString(id, "contract")) },
+		},
+	}
+
+	for _, p := range pipelines {
+		var row struct {
+			ID    bson.M `bson:"_id"`
+			Count int64  `bson:"count"`
+		}
+
+		iter := m.pipe(p.collection, p.match, []bson.M{{"$group": p.group}}).AllowDiskUse().Iter()
+
+		bulk := counters.Bulk()
+		bulk.Unordered()
+		queued := 0
+
+		for iter.Next(&row) {
+			bulk.Upsert(bson.M{"_id": p.name(row.ID)}, bson.M{"$set": bson.M{"count": row.Count}})
+			queued++
+
+			if queued == 1000 {
+				if _, err := bulk.Run(); err != nil {
+					log.Errorf("Error reconciling counters: %v", err)
+					complete = false
+				}
+				bulk = counters.Bulk()
+				bulk.Unordered()
+				queued = 0
+			}
+		}
+
+		if queued > 0 {
+			if _, err := bulk.Run(); err != nil {
+				log.Errorf("Error reconciling counters: %v", err)
+				complete = false
+			}
+		}
+
+		if err := iter.Close(); err != nil {
+			log.Errorf("Error reconciling counters: %v", err)
+			return
+		}
+	}
+
+	// Counters for addresses that no longer have any activity
+	if _, err := counters.RemoveAll(bson.M{"count": bson.M{"$lte": 0}}); err != nil {
+		log.Errorf("Error reconciling counters: %v", err)
+	}
+
+	// Address counters are only whole once the activity index is
+	var activity models.Store
+	if err := m.c(models.STORE).Find(bson.M{"symbol": "activity"}).One(&activity); err != nil {
+		log.Errorf("Error getting activity backfill state: %v", err)
+		complete = false
+	}
+
+	if complete && activity.Sync[0] == 0 {
+		_, err := m.c(models.STORE).Upsert(bson.M{"symbol": countersMarker}, bson.M{"$set": bson.M{"symbol": countersMarker}})
+		if err != nil {
+			log.Errorf("Could not set sysStore(%v): %v", countersMarker, err)
+		}
+	}
+
+	log.Debugf("Reconciled counters, took %v", time.Since(start))
+}
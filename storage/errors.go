@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/globalsign/mgo"
+)
+
+/*
+	Errors of the storage layer fall in a few kinds callers can act on: nothing matched, the
+	data was dropped by the retention rules, the input can't be answered, or the database
+	could not be reached. Lookups keep returning ErrNotFound so comparisons with it still
+	hold, KindOf classifies every error.
+*/
+
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindNotFound
+	KindInvalid
+	KindUnavailable
+	KindPruned
+)
+
+// Error is an error of a known kind.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func NotFound(msg string) error {
+	return &Error{KindNotFound, errors.New(msg)}
+}
+
+func Invalid(msg string) error {
+	return &Error{KindInvalid, errors.New(msg)}
+}
+
+func Pruned(msg string) error {
+	return &Error{KindPruned, errors.New(msg)}
+}
+
+// KindOf returns the kind of err, errors of the driver are classified by their cause.
+func KindOf(err error) ErrorKind {
+	if err == nil {
+		return KindInternal
+	}
+	if e, ok := err.(*Error); ok {
+		return e.Kind
+	}
+	if err == mgo.ErrNotFound {
+		return KindNotFound
+	}
+	if err == context.DeadlineExceeded || err == context.Canceled || err == io.EOF {
+		return KindUnavailable
+	}
+	if _, ok := err.(net.Error); ok {
+		return KindUnavailable
+	}
+	if qerr, ok := err.(*mgo.QueryError); ok && qerr.Code == 2 {
+		// BadValue, e.g. a malformed regex or operator argument
+		return KindInvalid
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.HasPrefix(msg, "no reachable servers"),
+		strings.Contains(msg, "Closed explicitly"),
+		strings.Contains(msg, "i/o timeout"),
+		strings.Contains(msg, "connection refused"),
+		strings.Contains(msg, "connection reset"):
+		return KindUnavailable
+	}
+	return KindInternal
+}
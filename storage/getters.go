@@ -1,7 +1,9 @@
 package storage
 
 import (
-	"errors"
+	"context"
+	"math"
+	"reflect"
 
 	"github.com/globalsign/mgo/bson"
 	"github.com/ubiq/spectrum-backend/models"
@@ -9,184 +11,562 @@ import (
 
 // Store
 
-func (m *MongoDB) Store() (models.Store, error) {
+func (m *MongoDB) Store(ctx context.Context) (models.Store, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var store models.Store
 
-	err := m.db.C(models.STORE).Find(bson.M{}).Limit(1).One(&store)
+	err := m.c(models.STORE).Find(bson.M{}).Limit(1).One(&store)
 	return store, err
 }
 
+// ApiKey looks up an api client by its key.
+func (m *MongoDB) ApiKey(ctx context.Context, key string) (models.ApiKey, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var apiKey models.ApiKey
+
+	err := m.c(models.APIKEYS).Find(bson.M{"key": key}).One(&apiKey)
+	return apiKey, err
+}
+
 // Blocks
 
-func (m *MongoDB) BlockByNumber(number uint64) (models.Block, error) {
+func (m *MongoDB) BlockByNumber(ctx context.Context, number uint64) (models.Block, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var block models.Block
 
-	err := m.db.C(models.BLOCKS).Find(bson.M{"number": number}).One(&block)
+	err := m.c(models.BLOCKS).Find(bson.M{"number": number}).One(&block)
 	return block, err
 }
 
-func (m *MongoDB) BlockByHash(hash string) (models.Block, error) {
+func (m *MongoDB) BlockByHash(ctx context.Context, hash string) (models.Block, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var block models.Block
 
-	err := m.db.C(models.BLOCKS).Find(bson.M{"hash": hash}).One(&block)
+	err := m.c(models.BLOCKS).Find(bson.M{"hash": hash}).One(&block)
 	return block, err
 }
 
-func (m *MongoDB) LatestBlock() (models.Block, error) {
+func (m *MongoDB) LatestBlock(ctx context.Context) (models.Block, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var block models.Block
 
-	err := m.db.C(models.BLOCKS).Find(bson.M{}).Sort("-number").Limit(1).One(&block)
+	err := m.c(models.BLOCKS).Find(bson.M{}).Sort("-number").Limit(1).One(&block)
 	return block, err
 }
 
-func (m *MongoDB) LatestBlocks(limit int) ([]models.Block, error) {
+func (m *MongoDB) LatestBlocks(ctx context.Context, p Page) ([]models.Block, bool, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var blocks []models.Block
 
-	err := m.db.C(models.BLOCKS).Find(bson.M{}).Sort("-number").Limit(limit).All(&blocks)
-	return blocks, err
+	err := m.c(models.BLOCKS).Find(p.query(bson.M{}, "number", "")).Sort(p.sort("number", "")...).Limit(p.fetch()).All(&blocks)
+	return blocks, p.trim(&blocks), err
+}
+
+// BlockByTimestamp returns the last block mined at or before timestamp, or the first one
+// mined at or after it.
+func (m *MongoDB) BlockByTimestamp(ctx context.Context, timestamp uint64, before bool) (models.Block, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var block models.Block
+
+	query, order := bson.M{"timestamp": bson.M{"$lte": timestamp}}, "-timestamp"
+	if !before {
+		query, order = bson.M{"timestamp": bson.M{"$gte": timestamp}}, "timestamp"
+	}
+
+	err := m.c(models.BLOCKS).Find(query).Sort(order).One(&block)
+	return block, err
 }
 
-func (m *MongoDB) TotalBlockCount() (int, error) {
-	count, err := m.db.C(models.BLOCKS).Find(bson.M{}).Count()
+func (m *MongoDB) TotalBlockCount(ctx context.Context) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
 
-	return count, err
+	return m.counter(models.BLOCKS, models.BLOCKS, bson.M{})
 }
 
 // Uncles
 
-func (m *MongoDB) UncleByHash(hash string) (models.Uncle, error) {
+func (m *MongoDB) UncleByHash(ctx context.Context, hash string) (models.Uncle, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var uncle models.Uncle
 
-	err := m.db.C(models.UNCLES).Find(bson.M{"hash": hash}).One(&uncle)
+	err := m.c(models.UNCLES).Find(bson.M{"hash": hash}).One(&uncle)
 	return uncle, err
 }
 
-func (m *MongoDB) LatestUncles(limit int) ([]models.Uncle, error) {
+func (m *MongoDB) BlockUncles(ctx context.Context, number uint64) ([]models.Uncle, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var uncles []models.Uncle
 
-	err := m.db.C(models.UNCLES).Find(bson.M{}).Sort("-blockNumber").Limit(limit).All(&uncles)
+	err := m.c(models.UNCLES).Find(bson.M{"blockNumber": number}).Sort("position").All(&uncles)
 	return uncles, err
 }
 
-func (m *MongoDB) TotalUncleCount() (int, error) {
-	count, err := m.db.C(models.UNCLES).Find(bson.M{}).Count()
-	return count, err
+func (m *MongoDB) LatestUncles(ctx context.Context, p Page) ([]models.Uncle, bool, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var uncles []models.Uncle
+
+	err := m.c(models.UNCLES).Find(p.query(bson.M{}, "blockNumber", "position")).Sort(p.sort("blockNumber", "position")...).Limit(p.fetch()).All(&uncles)
+	return uncles, p.trim(&uncles), err
+}
+
+func (m *MongoDB) TotalUncleCount(ctx context.Context) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	return m.counter(models.UNCLES, models.UNCLES, bson.M{})
 }
 
 // Forked blocks
 
-func (m *MongoDB) ForkedBlockByNumber(number uint64) (models.Block, error) {
+func (m *MongoDB) ForkedBlockByNumber(ctx context.Context, number uint64) (models.Block, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var block models.Block
 
-	err := m.db.C(models.REORGS).Find(bson.M{"number": number}).One(&block)
+	err := m.c(models.REORGS).Find(bson.M{"number": number}).One(&block)
 	return block, err
 }
 
-func (m *MongoDB) LatestForkedBlocks(limit int) ([]models.Block, error) {
+func (m *MongoDB) LatestForkedBlocks(ctx context.Context, p Page) ([]models.Block, bool, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var blocks []models.Block
 
-	err := m.db.C(models.REORGS).Find(bson.M{}).Sort("-number").Limit(limit).All(&blocks)
-	return blocks, err
+	err := m.c(models.REORGS).Find(p.query(bson.M{}, "number", "timestamp")).Sort(p.sort("number", "timestamp")...).Limit(p.fetch()).All(&blocks)
+	return blocks, p.trim(&blocks), err
 }
 
 // Transactions
 
-func (m *MongoDB) TransactionByHash(hash string) (models.Transaction, error) {
+func (m *MongoDB) TransactionByHash(ctx context.Context, hash string) (models.Transaction, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var txn models.Transaction
 
-	err := m.db.C(models.TXNS).Find(bson.M{"hash": hash}).One(&txn)
+	err := m.findOne(models.TXNS, bson.M{"hash": hash}, &txn)
 	return txn, err
 }
 
-func (m *MongoDB) TransactionByContractAddress(hash string) (models.Transaction, error) {
+func (m *MongoDB) TransactionByContractAddress(ctx context.Context, hash string) (models.Transaction, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var txn models.Transaction
 
-	err := m.db.C(models.TXNS).Find(bson.M{"contractAddress": hash}).One(&txn)
+	err := m.findOne(models.TXNS, bson.M{"contractAddress": hash}, &txn)
 	return txn, err
 }
 
-func (m *MongoDB) LatestTransactions(limit int) ([]models.Transaction, error) {
+func (m *MongoDB) LatestTransactions(ctx context.Context, p Page) ([]models.Transaction, bool, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var txns []models.Transaction
 
-	err := m.db.C(models.TXNS).Find(bson.M{}).Sort("-blockNumber").Limit(limit).All(&txns)
-	return txns, err
+	from, to := p.bounds()
+
+	err := m.findSorted(models.TXNS, from, to, p.query(bson.M{}, "blockNumber", "transactionIndex"), p.Desc, p.fetch(), &txns)
+	return txns, p.trim(&txns), err
 }
 
-func (m *MongoDB) LatestTransactionsByAccount(hash string) ([]models.Transaction, error) {
+func (m *MongoDB) LatestTransactionsByAccount(ctx context.Context, hash string, p Page) ([]models.Transaction, bool, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var txns []models.Transaction
 
-	err := m.db.C(models.TXNS).Find(bson.M{"$or": []bson.M{bson.M{"from": hash}, bson.M{"to": hash}}}).Sort("-blockNumber").Limit(25).All(&txns)
-	return txns, err
+	rows, more, err := m.accountActivity(bson.M{"address": hash, "kind": models.KIND_TX}, p)
+	if err != nil || len(rows) == 0 {
+		return []models.Transaction{}, false, err
+	}
+
+	err = m.joinActivity(models.TXNS, rows, &txns)
+	return txns, more, err
+}
+
+func (m *MongoDB) TxnCount(ctx context.Context, hash string) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	return m.counter(addressCounter(models.KIND_TX, hash), models.ACTIVITY, bson.M{"address": hash, "kind": models.KIND_TX})
 }
 
-func (m *MongoDB) TxnCount(hash string) (int, error) {
-	count, err := m.db.C(models.TXNS).Find(bson.M{"$or": []bson.M{bson.M{"from": hash}, bson.M{"to": hash}}}).Count()
-	return count, err
+func (m *MongoDB) TotalTxnCount(ctx context.Context) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	return m.counter(models.TXNS, models.TXNS, bson.M{})
 }
 
-func (m *MongoDB) TotalTxnCount() (int, error) {
-	count, err := m.db.C(models.TXNS).Find(bson.M{}).Count()
-	return count, err
+func (m *MongoDB) BlockTransactions(ctx context.Context, number uint64, p Page) ([]models.Transaction, bool, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var txns []models.Transaction
+
+	err := m.findSorted(models.TXNS, number, number, p.query(bson.M{"blockNumber": number}, "blockNumber", "transactionIndex"), p.Desc, p.fetch(), &txns)
+	if err != nil || len(txns) > 0 {
+		return txns, p.trim(&txns), err
+	}
+
+	// Blocks pruned to headers answer with the marker instead of an empty list
+	n, err := m.c(models.BLOCKS).Find(bson.M{"number": number, "pruned": true}).Count()
+	if err == nil && n > 0 {
+		err = Pruned("block transactions have been pruned")
+	}
+	return txns, false, err
 }
 
-func (m *MongoDB) BlockTransactions(number uint64) ([]models.Transaction, error) {
+// LogTransactions returns the transactions between from and to that have logs, of one of
+// addresses when given, oldest first. Pruned transactions are included, their logs are gone.
+func (m *MongoDB) LogTransactions(ctx context.Context, from, to uint64, addresses []string, limit int) ([]models.Transaction, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var txns []models.Transaction
 
-	err := m.db.C(models.TXNS).Find(bson.M{"blockNumber": number}).All(&txns)
+	logs := bson.M{"logs.0": bson.M{"$exists": true}}
+	if len(addresses) > 0 {
+		logs = bson.M{"logs.address": bson.M{"$in": addresses}}
+	}
+
+	query := bson.M{
+		"blockNumber": bson.M{"$gte": from, "$lte": to},
+		"$or":         []bson.M{logs, {"pruned": true}},
+	}
+
+	err := m.findSorted(models.TXNS, from, to, query, false, limit, &txns)
 	return txns, err
 }
 
 // Token transfers
 
-func (m *MongoDB) TokenTransfersByAccount(token string, account string) ([]models.TokenTransfer, error) {
+func (m *MongoDB) TokenTransfersByAccount(ctx context.Context, token string, account string, p Page) ([]models.TokenTransfer, bool, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var transfers []models.TokenTransfer
+
+	rows, more, err := m.accountActivity(bson.M{"address": account, "kind": models.KIND_TRANSFER, "contract": token}, p)
+	if err != nil || len(rows) == 0 {
+		return []models.TokenTransfer{}, false, err
+	}
+
+	err = m.joinActivity(models.TRANSFERS, rows, &transfers)
+	return transfers, more, err
+}
+
+// TransactionTokenTransfers returns the token transfers of the transaction hash mined in
+// block number.
+func (m *MongoDB) TransactionTokenTransfers(ctx context.Context, hash string, number uint64) ([]models.TokenTransfer, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var transfers []models.TokenTransfer
 
-	err := m.db.C(models.TRANSFERS).Find(bson.M{"$or": []bson.M{bson.M{"$and": []bson.M{bson.M{"from": account}, bson.M{"contract": token}}}, bson.M{"$and": []bson.M{bson.M{"to": account}, bson.M{"contract": token}}}}}).Sort("-blockNumber").All(&transfers)
+	err := m.findAll(models.TRANSFERS, number, number, bson.M{"hash": hash}, &transfers)
 	return transfers, err
 }
 
-func (m *MongoDB) TokenTransferByAccountCount(token string, account string) (int, error) {
-	count, err := m.db.C(models.TRANSFERS).Find(bson.M{"$or": []bson.M{bson.M{"$and": []bson.M{bson.M{"from": account}, bson.M{"contract": token}}}, bson.M{"$and": []bson.M{bson.M{"to": account}, bson.M{"contract": token}}}}}).Count()
-	return count, err
+// TransferTransactions returns the transactions of transfers by hash, without their logs.
+// Transactions pruned with their block body are missing.
+func (m *MongoDB) TransferTransactions(ctx context.Context, transfers []models.TokenTransfer) (map[string]models.Transaction, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	result := make(map[string]models.Transaction, len(transfers))
+	if len(transfers) == 0 {
+		return result, nil
+	}
+
+	hashes := make([]string, len(transfers))
+	from, to := uint64(math.MaxUint64), uint64(0)
+
+	for i, v := range transfers {
+		hashes[i] = v.Hash
+		if v.BlockNumber < from {
+			from = v.BlockNumber
+		}
+		if v.BlockNumber > to {
+			to = v.BlockNumber
+		}
+	}
+
+	var txns []models.Transaction
+
+	for _, p := range m.partitions(models.TXNS, from, to) {
+		var part []models.Transaction
+
+		if err := m.c(p.Name).Find(bson.M{"hash": bson.M{"$in": hashes}}).Select(bson.M{"logs": 0}).All(&part); err != nil {
+			return nil, err
+		}
+		txns = append(txns, part...)
+	}
+
+	for _, v := range txns {
+		result[v.Hash] = v
+	}
+	return result, nil
+}
+
+func (m *MongoDB) TokenTransferByAccountCount(ctx context.Context, token string, account string) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	return m.counter(accountTokenCounter(token, account), models.ACTIVITY, bson.M{"address": account, "kind": models.KIND_TRANSFER, "contract": token})
 }
 
-func (m *MongoDB) LatestTokenTransfersByAccount(hash string) ([]models.TokenTransfer, error) {
+func (m *MongoDB) LatestTokenTransfersByAccount(ctx context.Context, hash string, p Page) ([]models.TokenTransfer, bool, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var transfers []models.TokenTransfer
 
-	err := m.db.C(models.TRANSFERS).Find(bson.M{"$or": []bson.M{bson.M{"from": hash}, bson.M{"to": hash}}}).Sort("-blockNumber").Limit(25).All(&transfers)
-	return transfers, err
+	rows, more, err := m.accountActivity(bson.M{"address": hash, "kind": models.KIND_TRANSFER}, p)
+	if err != nil || len(rows) == 0 {
+		return []models.TokenTransfer{}, false, err
+	}
+
+	err = m.joinActivity(models.TRANSFERS, rows, &transfers)
+	return transfers, more, err
 }
 
-func (m *MongoDB) LatestTransfersByToken(hash string) ([]models.TokenTransfer, error) {
+func (m *MongoDB) LatestTransfersByToken(ctx context.Context, hash string, p Page) ([]models.TokenTransfer, bool, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var transfers []models.TokenTransfer
 
-	err := m.db.C(models.TRANSFERS).Find(bson.M{"contract": hash}).Sort("-blockNumber").Limit(1000).All(&transfers)
-	return transfers, err
+	from, to := p.bounds()
+
+	err := m.findSorted(models.TRANSFERS, from, to, p.query(bson.M{"contract": hash}, "blockNumber", "transactionIndex"), p.Desc, p.fetch(), &transfers)
+	return transfers, p.trim(&transfers), err
 }
 
-func (m *MongoDB) TokenTransferCount(hash string) (int, error) {
-	count, err := m.db.C(models.TRANSFERS).Find(bson.M{"$or": []bson.M{bson.M{"from": hash}, bson.M{"to": hash}}}).Count()
-	return count, err
+func (m *MongoDB) TokenTransferCount(ctx context.Context, hash string) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	return m.counter(addressCounter(models.KIND_TRANSFER, hash), models.ACTIVITY, bson.M{"address": hash, "kind": models.KIND_TRANSFER})
 }
 
-func (m *MongoDB) TokenTransferCountByContract(hash string) (int, error) {
-	count, err := m.db.C(models.TRANSFERS).Find(bson.M{"contract": hash}).Count()
-	return count, err
+func (m *MongoDB) TokenTransferCountByContract(ctx context.Context, hash string) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	return m.counter(contractCounter(hash), models.TRANSFERS, bson.M{"contract": hash})
 }
 
-func (m *MongoDB) LatestTokenTransfers(limit int) ([]models.TokenTransfer, error) {
+func (m *MongoDB) TotalTokenTransferCount(ctx context.Context) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	return m.counter(models.TRANSFERS, models.TRANSFERS, bson.M{})
+}
+
+func (m *MongoDB) LatestTokenTransfers(ctx context.Context, p Page) ([]models.TokenTransfer, bool, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	var transfers []models.TokenTransfer
 
-	err := m.db.C(models.TRANSFERS).Find(bson.M{}).Sort("-blockNumber").Limit(limit).All(&transfers)
-	return transfers, err
+	from, to := p.bounds()
+
+	err := m.findSorted(models.TRANSFERS, from, to, p.query(bson.M{}, "blockNumber", "transactionIndex"), p.Desc, p.fetch(), &transfers)
+	return transfers, p.trim(&transfers), err
+}
+
+// Accounts
+
+// AddressSeen returns the first and last block with a transaction or token transfer of
+// address, ok is false when it has none.
+func (m *MongoDB) AddressSeen(ctx context.Context, address string) (first, last uint64, ok bool, err error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	for _, kind := range []string{models.KIND_TX, models.KIND_TRANSFER} {
+		for _, order := range []string{"blockNumber", "-blockNumber"} {
+			var row models.AddressActivity
+
+			err = m.c(models.ACTIVITY).Find(bson.M{"address": address, "kind": kind}).Sort(order).Select(bson.M{"blockNumber": 1}).One(&row)
+			if err == ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return 0, 0, false, err
+			}
+
+			if !ok || row.BlockNumber < first {
+				first = row.BlockNumber
+			}
+			if !ok || row.BlockNumber > last {
+				last = row.BlockNumber
+			}
+			ok = true
+		}
+	}
+	return first, last, ok, nil
+}
+
+// AddressTokens returns the contracts of the tokens address sent or received.
+func (m *MongoDB) AddressTokens(ctx context.Context, address string) ([]string, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	tokens := []string{}
+
+	err := m.c(models.ACTIVITY).Find(bson.M{"address": address, "kind": models.KIND_TRANSFER}).Distinct("contract", &tokens)
+	return tokens, err
+}
+
+func (m *MongoDB) MinedBlockCount(ctx context.Context, miner string) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	return m.c(models.BLOCKS).Find(bson.M{"miner": miner}).Count()
+}
+
+func (m *MongoDB) MinedUncleCount(ctx context.Context, miner string) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	return m.c(models.UNCLES).Find(bson.M{"miner": miner}).Count()
+}
+
+// Address activity
+
+// accountActivity returns a page of activity rows matching query and whether more rows
+// follow.
+func (m *MongoDB) accountActivity(query bson.M, p Page) ([]models.AddressActivity, bool, error) {
+	var rows []models.AddressActivity
+
+	err := m.c(models.ACTIVITY).Find(p.query(query, "blockNumber", "txIndex")).Sort(p.sort("blockNumber", "txIndex")...).Limit(p.fetch()).Select(activityFields).All(&rows)
+	if err != nil {
+		return nil, false, err
+	}
+
+	more := p.trim(&rows)
+	return rows, more, nil
+}
+
+var activityFields = bson.M{"hash": 1, "blockNumber": 1, "txIndex": 1, "contract": 1}
+
+// joinActivity stores the documents of base behind rows into result, a pointer to a slice,
+// in the order of rows. Documents of blocks pruned to headers are gone but their rows are
+// kept, they're answered with a stub flagged pruned instead of being skipped.
+func (m *MongoDB) joinActivity(base string, rows []models.AddressActivity, result interface{}) error {
+	hashes := make([]string, len(rows))
+	from, to := uint64(math.MaxUint64), uint64(0)
+
+	for i, v := range rows {
+		hashes[i] = v.Hash
+		if v.BlockNumber < from {
+			from = v.BlockNumber
+		}
+		if v.BlockNumber > to {
+			to = v.BlockNumber
+		}
+	}
+
+	var raws []bson.Raw
+
+	if err := m.findAll(base, from, to, bson.M{"hash": bson.M{"$in": hashes}}, &raws); err != nil {
+		return err
+	}
+
+	docs := make(map[string]bson.Raw, len(raws))
+	for _, raw := range raws {
+		var key struct {
+			Hash string `bson:"hash"`
+		}
+		if err := raw.Unmarshal(&key); err != nil {
+			return err
+		}
+		docs[key.Hash] = raw
+	}
+
+	var pruned uint64
+	if len(docs) < len(rows) {
+		var err error
+		if pruned, err = m.retentionProgress(retentionBodies); err != nil {
+			return err
+		}
+	}
+
+	slice := reflect.ValueOf(result).Elem()
+	values := reflect.MakeSlice(slice.Type(), 0, len(rows))
+
+	for _, v := range rows {
+		raw, ok := docs[v.Hash]
+		if !ok {
+			// Removed by a reorg since the rows were read
+			if v.BlockNumber >= pruned {
+				continue
+			}
+			b, err := bson.Marshal(prunedStub(v))
+			if err != nil {
+				return err
+			}
+			raw = bson.Raw{Kind: 0x03, Data: b}
+		}
+
+		doc := reflect.New(slice.Type().Elem())
+		if err := raw.Unmarshal(doc.Interface()); err != nil {
+			return err
+		}
+		values = reflect.Append(values, doc.Elem())
+	}
+
+	slice.Set(values)
+	return nil
+}
+
+// prunedStub holds what the activity row still knows of a pruned document.
+func prunedStub(row models.AddressActivity) bson.M {
+	stub := bson.M{"hash": row.Hash, "blockNumber": row.BlockNumber, "transactionIndex": row.TxIndex, "pruned": true}
+	if row.Contract != "" {
+		stub["contract"] = row.Contract
+	}
+	return stub
 }
 
 // Charts
 
-func (m *MongoDB) ChartData(chart string, limit int64) (models.LineChart, error) {
+func (m *MongoDB) ChartData(ctx context.Context, chart string, limit int64) (models.LineChart, error) {
+	if limit < 0 {
+		return models.LineChart{}, Invalid("limit must not be negative")
+	}
+
+	m, done := m.scope(ctx)
+	defer done()
+
 	var chartData models.LineChart
 
-	err := m.db.C(models.CHARTS).Find(bson.M{"chart": chart}).One(&chartData)
+	err := m.c(models.CHARTS).Find(bson.M{"chart": chart}).One(&chartData)
 
 	if err != nil {
 		return models.LineChart{}, err
@@ -205,11 +585,18 @@ func (m *MongoDB) ChartData(chart string, limit int64) (models.LineChart, error)
 	return chartData, err
 }
 
-func (m *MongoDB) ChartDataML(chart string, limit int64, miner string) (models.LineChart, error) {
+func (m *MongoDB) ChartDataML(ctx context.Context, chart string, limit int64, miner string) (models.LineChart, error) {
+	if limit < 0 {
+		return models.LineChart{}, Invalid("limit must not be negative")
+	}
+
+	m, done := m.scope(ctx)
+	defer done()
+
 	var chartData models.MLineChart
 	var result models.LineChart
 
-	err := m.db.C(models.CHARTS).Find(bson.M{"chart": chart}).One(&chartData)
+	err := m.c(models.CHARTS).Find(bson.M{"chart": chart}).One(&chartData)
 
 	if err != nil {
 		return models.LineChart{}, err
@@ -226,7 +613,7 @@ func (m *MongoDB) ChartDataML(chart string, limit int64, miner string) (models.L
 	result.Labels = chartData.Labels[int64(len(chartData.Labels)-1)-limit : len(chartData.Labels)-1]
 
 	if _, ok := chartData.Values[miner]; !ok {
-		return models.LineChart{}, errors.New("Miner not found")
+		return models.LineChart{}, NotFound("miner not found")
 	}
 
 	result.Values = chartData.Values[miner][int64(len(chartData.Values[miner])-1)-limit : len(chartData.Values[miner])-1]
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/ubiq/spectrum-backend/models"
+)
+
+/*
+	History iterators stream transactions or token transfers in block order without holding
+	the result in memory. An address history follows a cursor on the activity index and
+	fetches the documents a batch of rows at a time, a token history reads the partitions
+	one after the other, oldest first.
+*/
+
+const historyBatch = 500
+
+type HistoryIter struct {
+	m    *MongoDB
+	done func()
+	base string
+	// Activity rows, nil when the documents are read directly
+	rows *mgo.Iter
+	// Queries of the partitions still to read, and the cursor of the current one
+	queries []*mgo.Query
+	cur     *mgo.Iter
+	buf     []bson.Raw
+	err     error
+}
+
+// AccountHistory iterates the transactions, or the token transfers with kind
+// models.KIND_TRANSFER, of address in the blocks [from, to].
+func (m *MongoDB) AccountHistory(ctx context.Context, address, kind string, from, to uint64) *HistoryIter {
+	m, done := m.scope(ctx)
+
+	base := models.TXNS
+	if kind == models.KIND_TRANSFER {
+		base = models.TRANSFERS
+	}
+
+	query := bson.M{"address": address, "kind": kind, "blockNumber": bson.M{"$gte": from, "$lte": to}}
+	rows := m.c(models.ACTIVITY).Find(query).Sort("blockNumber", "txIndex").Select(activityFields).Iter()
+
+	return &HistoryIter{m: m, done: done, base: base, rows: rows}
+}
+
+// TokenHistory iterates the transfers of a token in the blocks [from, to].
+func (m *MongoDB) TokenHistory(ctx context.Context, contract string, from, to uint64) *HistoryIter {
+	m, done := m.scope(ctx)
+
+	parts := m.partitions(models.TRANSFERS, from, to)
+	sort.Slice(parts, func(i, j int) bool { return parts[i].From < parts[j].From })
+
+	query := bson.M{"contract": contract, "blockNumber": bson.M{"$gte": from, "$lte": to}}
+
+	queries := make([]*mgo.Query, len(parts))
+	for i, p := range parts {
+		queries[i] = m.c(p.Name).Find(query).Sort("blockNumber", "transactionIndex")
+	}
+
+	return &HistoryIter{m: m, done: done, base: models.TRANSFERS, queries: queries}
+}
+
+// Next decodes the next document into result, it returns false at the end or on error.
+func (h *HistoryIter) Next(result interface{}) bool {
+	if h.err != nil {
+		return false
+	}
+
+	if h.rows != nil {
+		for len(h.buf) == 0 {
+			if !h.fill() {
+				return false
+			}
+		}
+
+		raw := h.buf[0]
+		h.buf = h.buf[1:]
+
+		if h.err = raw.Unmarshal(result); h.err != nil {
+			return false
+		}
+		return true
+	}
+
+	for {
+		if h.cur == nil {
+			if len(h.queries) == 0 {
+				return false
+			}
+			h.cur = h.queries[0].Iter()
+			h.queries = h.queries[1:]
+		}
+
+		if h.cur.Next(result) {
+			return true
+		}
+
+		if h.err = h.cur.Close(); h.err != nil {
+			return false
+		}
+		h.cur = nil
+	}
+}
+
+// fill joins the next batch of activity rows with their documents, it returns false when
+// the rows are exhausted.
+func (h *HistoryIter) fill() bool {
+	rows := make([]models.AddressActivity, 0, historyBatch)
+
+	for len(rows) < historyBatch {
+		var row models.AddressActivity
+		if !h.rows.Next(&row) {
+			break
+		}
+		rows = append(rows, row)
+	}
+
+	if err := h.rows.Err(); err != nil {
+		h.err = err
+		return false
+	}
+	if len(rows) == 0 {
+		return false
+	}
+
+	h.err = h.m.joinActivity(h.base, rows, &h.buf)
+	return h.err == nil
+}
+
+func (h *HistoryIter) Err() error {
+	return h.err
+}
+
+// Close ends the iteration and releases the session.
+func (h *HistoryIter) Close() error {
+	if h.rows != nil {
+		if err := h.rows.Close(); err != nil && h.err == nil {
+			h.err = err
+		}
+	}
+	if h.cur != nil {
+		if err := h.cur.Close(); err != nil && h.err == nil {
+			h.err = err
+		}
+	}
+	h.done()
+	return h.err
+}
@@ -1,15 +1,21 @@
 package storage
 
 import (
+	"context"
+	"math"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
 	"github.com/ubiq/spectrum-backend/models"
 )
 
-func (m *MongoDB) Init() {
+func (m *MongoDB) Init(ctx context.Context) {
+	m, done := m.scope(ctx)
+	defer done()
+
 	store := &models.Store{
 		Symbol: "sync",
 		Sync:   [1]uint64{1 << 62},
@@ -44,13 +50,29 @@ func (m *MongoDB) Init() {
 		},
 	}
 
+	// Activity index is maintained from the first block on, no backfill needed
+	activity := &models.Store{
+		Symbol: "activity",
+		Sync:   [1]uint64{0},
+	}
+
+	// Balances are kept from the first block on too
+	balances := &models.Store{
+		Symbol: "balances",
+	}
+
+	// Counters start at zero along with the index
+	counters := &models.Store{
+		Symbol: countersMarker,
+	}
+
 	qwark := &models.Store{
 		Timestamp: time.Now().Unix(),
 		Symbol:    "qwark",
 		Supply:    "964266346618165",
 	}
 
-	ss := m.db.C(models.STORE)
+	ss := m.c(models.STORE)
 
 	if err := ss.Insert(store); err != nil {
 		log.Fatalf("Could not init sysStore(sync): %v", err)
@@ -64,6 +86,18 @@ func (m *MongoDB) Init() {
 		log.Fatalf("Could not init sysStore(ubq): %v", err)
 	}
 
+	if err := ss.Insert(activity); err != nil {
+		log.Fatalf("Could not init sysStore(activity): %v", err)
+	}
+
+	if err := ss.Insert(balances); err != nil {
+		log.Fatalf("Could not init sysStore(balances): %v", err)
+	}
+
+	if err := ss.Insert(counters); err != nil {
+		log.Fatalf("Could not init sysStore(counters): %v", err)
+	}
+
 	genesis := &models.Block{
 		Number:          0,
 		Timestamp:       1485633600,
@@ -88,7 +122,7 @@ func (m *MongoDB) Init() {
 		ExtraData: "0x4a756d6275636b734545",
 	}
 
-	gb := m.db.C(models.BLOCKS)
+	gb := m.c(models.BLOCKS)
 
 	if err := gb.Insert(genesis); err != nil {
 		log.Fatalf("Could not init genesis block: %v", err)
@@ -96,13 +130,17 @@ func (m *MongoDB) Init() {
 
 	log.Warnf("Initialized sysStore, genesis")
 
-	m.InitIndex()
+	m.InitIndex(ctx)
 
 }
 
-func (m *MongoDB) InitIndex() {
+// InitIndex ensures every index exists. It also runs on every crawler start, so indexes added
+// later are built on existing databases.
+func (m *MongoDB) InitIndex(ctx context.Context) {
+	m, done := m.scope(ctx)
+	defer done()
 
-	ss := m.db.C(models.BLOCKS)
+	ss := m.c(models.BLOCKS)
 
 	blockno := mgo.Index{
 		Key:        []string{"number"},
@@ -125,7 +163,17 @@ func (m *MongoDB) InitIndex() {
 		log.Errorf("Could not init index for blocks: %v", err)
 	}
 
-	ss = m.db.C(models.REORGS)
+	err = ss.EnsureIndex(mgo.Index{Key: []string{"timestamp"}, Background: true})
+	if err != nil {
+		log.Errorf("Could not init index for blocks: %v", err)
+	}
+
+	err = ss.EnsureIndex(mgo.Index{Key: []string{"miner"}, Background: true})
+	if err != nil {
+		log.Errorf("Could not init index for blocks: %v", err)
+	}
+
+	ss = m.c(models.REORGS)
 
 	reorg := mgo.Index{
 		Key:        []string{"hash"},
@@ -138,7 +186,12 @@ func (m *MongoDB) InitIndex() {
 		log.Errorf("Could not init index for reorgs: %v", err)
 	}
 
-	ss = m.db.C(models.UNCLES)
+	err = ss.EnsureIndex(mgo.Index{Key: []string{"number", "timestamp"}, Background: true})
+	if err != nil {
+		log.Errorf("Could not init index for reorgs: %v", err)
+	}
+
+	ss = m.c(models.UNCLES)
 
 	uncle := mgo.Index{
 		Key:        []string{"hash"},
@@ -151,79 +204,218 @@ func (m *MongoDB) InitIndex() {
 		log.Errorf("Could not init index for uncles: %v", err)
 	}
 
-	ss = m.db.C(models.TXNS)
-
-	block := mgo.Index{
-		Key:        []string{"blockNumber"},
-		Background: true,
+	err = ss.EnsureIndex(mgo.Index{Key: []string{"blockNumber", "position"}, Background: true})
+	if err != nil {
+		log.Errorf("Could not init index for uncles: %v", err)
 	}
 
-	/* Index already defined for blocks */
-
-	from := mgo.Index{
-		Key:        []string{"from"},
-		Background: true,
-	}
-	to := mgo.Index{
-		Key:        []string{"to"},
-		Background: true,
+	err = ss.EnsureIndex(mgo.Index{Key: []string{"miner"}, Background: true})
+	if err != nil {
+		log.Errorf("Could not init index for uncles: %v", err)
 	}
-	contractAddress := mgo.Index{
-		Key:        []string{"contractAddress"},
-		Background: true,
+
+	err = m.c(models.APIKEYS).EnsureIndex(mgo.Index{Key: []string{"key"}, Unique: true, Background: true})
+	if err != nil {
+		log.Errorf("Could not init index for api keys: %v", err)
 	}
 
-	err = ss.EnsureIndex(block)
+	ss = m.c(models.TOKENS)
+
+	err = ss.EnsureIndex(mgo.Index{Key: []string{"contract"}, Unique: true, Background: true})
 	if err != nil {
-		log.Errorf("Could not init index for transactions: %v", err)
+		log.Errorf("Could not init index for tokens: %v", err)
 	}
-	err = ss.EnsureIndex(index)
+
+	err = ss.EnsureIndex(mgo.Index{Key: []string{"firstBlock", "firstIndex"}, Background: true})
 	if err != nil {
-		log.Errorf("Could not init index for transactions: %v", err)
+		log.Errorf("Could not init index for tokens: %v", err)
 	}
-	err = ss.EnsureIndex(from)
+
+	ss = m.c(models.BALANCES)
+
+	err = ss.EnsureIndex(mgo.Index{Key: []string{"contract", "holder"}, Unique: true, Background: true})
 	if err != nil {
-		log.Errorf("Could not init index for transactions: %v", err)
+		log.Errorf("Could not init index for token balances: %v", err)
 	}
-	err = ss.EnsureIndex(to)
+
+	err = ss.EnsureIndex(mgo.Index{Key: []string{"contract", "rank", "holder"}, Background: true})
 	if err != nil {
-		log.Errorf("Could not init index for transactions: %v", err)
+		log.Errorf("Could not init index for token balances: %v", err)
 	}
-	err = ss.EnsureIndex(contractAddress)
+
+	err = ss.EnsureIndex(mgo.Index{Key: []string{"checkedAt"}, Background: true})
 	if err != nil {
-		log.Errorf("Could not init index for transactions: %v", err)
+		log.Errorf("Could not init index for token balances: %v", err)
 	}
 
-	ss = m.db.C(models.TRANSFERS)
+	// Partitions get the same indexes as their base collection
 
-	contract := mgo.Index{
-		Key:        []string{"contract"},
-		Background: true,
+	for _, p := range m.partitions(models.TXNS, 0, math.MaxUint64) {
+		for _, v := range txnIndexes {
+			err = m.c(p.Name).EnsureIndex(v)
+			if err != nil {
+				log.Errorf("Could not init index for %v: %v", p.Name, err)
+			}
+		}
 	}
 
-	/* Using the ones defined for regular transactions */
+	for _, p := range m.partitions(models.TRANSFERS, 0, math.MaxUint64) {
+		for _, v := range transferIndexes {
+			err = m.c(p.Name).EnsureIndex(v)
+			if err != nil {
+				log.Errorf("Could not init index for %v: %v", p.Name, err)
+			}
+		}
+	}
 
-	err = ss.EnsureIndex(block)
-	if err != nil {
-		log.Errorf("Could not init index for tokentransfers: %v", err)
+	m.initActivityIndex()
+
+	log.Warnf("Intialized database indexes")
+
+}
+
+// Indexes of transactions and token transfers, also used for every new partition
+
+var txnIndexes = []mgo.Index{
+	{Key: []string{"blockNumber"}, Background: true},
+	{Key: []string{"hash"}, Unique: true, Background: true},
+	{Key: []string{"from"}, Background: true},
+	{Key: []string{"to"}, Background: true},
+	{Key: []string{"contractAddress"}, Background: true},
+	{Key: []string{"blockNumber", "transactionIndex"}, Background: true},
+}
+
+var transferIndexes = []mgo.Index{
+	{Key: []string{"blockNumber"}, Background: true},
+	{Key: []string{"hash"}, Unique: true, Background: true},
+	{Key: []string{"from"}, Background: true},
+	{Key: []string{"to"}, Background: true},
+	{Key: []string{"contract"}, Background: true},
+	{Key: []string{"blockNumber", "transactionIndex"}, Background: true},
+	{Key: []string{"contract", "blockNumber", "transactionIndex"}, Background: true},
+}
+
+func (m *MongoDB) initActivityIndex() {
+
+	ss := m.c(models.ACTIVITY)
+
+	activity := mgo.Index{
+		Key:        []string{"address", "kind", "blockNumber", "txIndex", "role"},
+		Unique:     true,
+		Background: true,
 	}
-	err = ss.EnsureIndex(index)
-	if err != nil {
-		log.Errorf("Could not init index for tokentransfers: %v", err)
+	contract := mgo.Index{
+		Key:        []string{"address", "kind", "contract", "blockNumber", "txIndex"},
+		Background: true,
 	}
-	err = ss.EnsureIndex(from)
-	if err != nil {
-		log.Errorf("Could not init index for tokentransfers: %v", err)
+	block := mgo.Index{
+		Key:        []string{"blockNumber"},
+		Background: true,
 	}
-	err = ss.EnsureIndex(to)
+
+	err := ss.EnsureIndex(activity)
 	if err != nil {
-		log.Errorf("Could not init index for tokentransfers: %v", err)
+		log.Errorf("Could not init index for address activity: %v", err)
 	}
 	err = ss.EnsureIndex(contract)
 	if err != nil {
-		log.Errorf("Could not init index for tokentransfers: %v", err)
+		log.Errorf("Could not init index for address activity: %v", err)
+	}
+	err = ss.EnsureIndex(block)
+	if err != nil {
+		log.Errorf("Could not init index for address activity: %v", err)
+	}
+}
+
+// BackfillActivity builds the address activity index for databases that were created before it
+// existed. Blocks are walked from the top down in batches and progress is kept in the "activity"
+// sysStore, so an interrupted backfill resumes where it stopped.
+func (m *MongoDB) BackfillActivity(ctx context.Context) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var store models.Store
+
+	ss := m.c(models.STORE)
+
+	err := ss.Find(bson.M{"symbol": "activity"}).One(&store)
+
+	switch {
+	case err == mgo.ErrNotFound:
+		store = models.Store{
+			Symbol: "activity",
+			Sync:   [1]uint64{m.latestStoredBlock() + 1},
+		}
+		if err := ss.Insert(&store); err != nil {
+			log.Errorf("Could not init sysStore(activity): %v", err)
+			return
+		}
+	case err != nil:
+		log.Errorf("Error getting activity backfill state: %v", err)
+		return
+	case store.Sync[0] == 0:
+		return
 	}
 
-	log.Warnf("Intialized database indexes")
+	m.initActivityIndex()
+
+	log.Warnf("Backfilling address activity index from block %v", store.Sync[0])
+
+	start := time.Now()
+
+	for head := store.Sync[0]; head > 0; {
+		var txns []models.Transaction
+		var transfers []models.TokenTransfer
+
+		var low uint64
+		if head > activityBackfillBatch {
+			low = head - activityBackfillBatch
+		}
+
+		selector := bson.M{"blockNumber": bson.M{"$gte": low, "$lt": head}}
+
+		if err := m.findAll(models.TXNS, low, head-1, selector, &txns); err != nil {
+			log.Errorf("Error backfilling address activity: %v", err)
+			return
+		}
+		if err := m.findAll(models.TRANSFERS, low, head-1, selector, &transfers); err != nil {
+			log.Errorf("Error backfilling address activity: %v", err)
+			return
+		}
+
+		docs := make([]interface{}, 0, len(txns)*2+len(transfers)*2)
+		txIndex := make(map[string]uint64, len(txns))
+		for _, v := range txns {
+			txIndex[v.Hash] = v.TransactionIndex
+			for _, a := range v.Activity() {
+				docs = append(docs, a)
+			}
+		}
+		for _, v := range transfers {
+			// Transfers indexed before the activity index have no transaction index, two of
+			// them in a block would collide on the unique key
+			if i, ok := txIndex[v.Hash]; ok {
+				v.TransactionIndex = i
+			}
+			for _, a := range v.Activity() {
+				docs = append(docs, a)
+			}
+		}
+
+		if _, err := bulkInsert(m.c(models.ACTIVITY), docs); err != nil {
+			log.Errorf("Error backfilling address activity: %v", err)
+			return
+		}
+
+		head = low
+
+		if err := ss.Update(bson.M{"symbol": "activity"}, bson.M{"$set": bson.M{"sync": [1]uint64{head}}}); err != nil {
+			log.Errorf("Error updating activity backfill state: %v", err)
+			return
+		}
+	}
 
+	log.Warnf("Backfilled address activity index, took %v", time.Since(start))
 }
+
+const activityBackfillBatch = 1000
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/globalsign/mgo"
@@ -10,9 +12,37 @@ import (
 
 /* Chart iterators */
 
+// Iter holds on to the session of the operation that created it, the session is released
+// when the iteration ends or the iterator is closed.
+type Iter struct {
+	*mgo.Iter
+	once sync.Once
+	done func()
+}
+
+func (i *Iter) Next(result interface{}) bool {
+	if i.Iter.Next(result) {
+		return true
+	}
+	i.release()
+	return false
+}
+
+func (i *Iter) Close() error {
+	err := i.Iter.Close()
+	i.release()
+	return err
+}
+
+func (i *Iter) release() {
+	i.once.Do(i.done)
+}
+
 var EOD = time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 23, 59, 59, 0, time.UTC)
 
-func (m *MongoDB) GetTxnCounts(days int) *mgo.Iter {
+func (m *MongoDB) GetTxnCounts(ctx context.Context, days int) *Iter {
+	m, done := m.scope(ctx)
+
 	var from int64
 
 	hours, _ := time.ParseDuration("-23h59m59s")
@@ -25,13 +55,15 @@ func (m *MongoDB) GetTxnCounts(days int) *mgo.Iter {
 
 	pipeline := []bson.M{{"$match": bson.M{"timestamp": bson.M{"$gte": from}}}}
 
-	pipe := m.db.C(models.TXNS).Pipe(pipeline)
+	pipe := m.pipe(models.TXNS, pipeline, nil)
 
-	return pipe.Iter()
+	return &Iter{Iter: pipe.Iter(), done: done}
 
 }
 
-func (m *MongoDB) GetBlocks(days int) *mgo.Iter {
+func (m *MongoDB) GetBlocks(ctx context.Context, days int) *Iter {
+	m, done := m.scope(ctx)
+
 	// genesis block: 1485633600
 	var from int64
 
@@ -45,34 +77,35 @@ func (m *MongoDB) GetBlocks(days int) *mgo.Iter {
 
 	pipeline := []bson.M{{"$match": bson.M{"timestamp": bson.M{"$gte": from}}}, {"$sort": bson.M{"number": -1}}}
 
-	pipe := m.db.C(models.BLOCKS).Pipe(pipeline)
+	pipe := m.c(models.BLOCKS).Pipe(pipeline)
 
-	return pipe.Iter()
+	return &Iter{Iter: pipe.Iter(), done: done}
 
 }
 
-func (m *MongoDB) GetTokenTransfers(contractAddress, address string, after int64) *mgo.Iter {
+func (m *MongoDB) GetTokenTransfers(ctx context.Context, contractAddress, address string, after int64) *Iter {
+	m, done := m.scope(ctx)
 
-	pipeline := []bson.M{}
+	var pipe *mgo.Pipe
 
 	if contractAddress != "" && address != "" {
-		pipeline = []bson.M{{"$match": bson.M{"contract": contractAddress}}, {"$match": bson.M{"timestamp": bson.M{"$gte": after}}}, {"$match": bson.M{"from": address}}}
+		pipeline := []bson.M{{"$match": bson.M{"contract": contractAddress}}, {"$match": bson.M{"timestamp": bson.M{"$gte": after}}}, {"$match": bson.M{"from": address}}}
+		pipe = m.pipe(models.TRANSFERS, pipeline, nil)
 	} else {
-		pipeline = []bson.M{{"$sort": bson.M{"timestamp": 1}}}
+		pipe = m.pipe(models.TRANSFERS, []bson.M{}, []bson.M{{"$sort": bson.M{"timestamp": 1}}})
 	}
 
-	pipe := m.db.C(models.TRANSFERS).Pipe(pipeline)
-
-	return pipe.Iter()
+	return &Iter{Iter: pipe.Iter(), done: done}
 
 }
 
-func (m *MongoDB) BlocksIter(blockno uint64) *mgo.Iter {
+func (m *MongoDB) BlocksIter(ctx context.Context, blockno uint64) *Iter {
+	m, done := m.scope(ctx)
 
 	pipeline := []bson.M{{"$match": bson.M{"number": bson.M{"$gte": blockno}}}, {"$sort": bson.M{"number": 1}}}
 
-	pipe := m.db.C(models.BLOCKS).Pipe(pipeline)
+	pipe := m.c(models.BLOCKS).Pipe(pipeline)
 
-	return pipe.Iter()
+	return &Iter{Iter: pipe.Iter(), done: done}
 
 }
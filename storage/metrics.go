@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/ubiq/spectrum-backend/metrics"
+)
+
+var mongoDuration = metrics.NewHistogram("spectrum_mongo_operation_duration_seconds",
+	"Duration of MongoDB operations by the collection they touch first.", metrics.DefaultBuckets, "collection")
+
+// operation times a scoped call, it's attributed to the first collection it uses.
+type operation struct {
+	start      time.Time
+	collection string
+}
+
+func (op *operation) observe() {
+	if op.collection != "" {
+		mongoDuration.Since(op.start, op.collection)
+	}
+}
+
+// c returns a collection of the database, partitions are recorded as their base collection.
+func (m *MongoDB) c(name string) *mgo.Collection {
+	if m.op != nil && m.op.collection == "" {
+		m.op.collection = name
+		for _, base := range partitioned {
+			if strings.HasPrefix(name, base+"_") {
+				m.op.collection = base
+			}
+		}
+	}
+	return m.db.C(name)
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+/*
+	Lists are paged by position: every item has a (block, index) key, the index is the
+	transaction index for transactions and token transfers, the position for uncles and the
+	timestamp for forked blocks. A page starts right after the cursor in the order of the page,
+	so pages stay stable while new blocks are indexed.
+*/
+
+type Cursor struct {
+	Block uint64
+	Index uint64
+	// Position in lists that are not ordered by block, empty for the others
+	Key string
+}
+
+type Page struct {
+	Limit int
+	Desc  bool
+	// Only items after this position in the order of the page, nil starts at the beginning
+	After *Cursor
+}
+
+// query adds the cursor condition on the block and index fields to query, lists that are
+// unique by block have no index field.
+func (p Page) query(query bson.M, block, index string) bson.M {
+	if p.After == nil {
+		return query
+	}
+
+	op := "$gt"
+	if p.Desc {
+		op = "$lt"
+	}
+
+	q := bson.M{block: bson.M{op: p.After.Block}}
+
+	if index != "" {
+		q = bson.M{"$or": []bson.M{
+			{block: bson.M{op: p.After.Block}},
+			{block: p.After.Block, index: bson.M{op: p.After.Index}},
+		}}
+	}
+
+	for k, v := range query {
+		q[k] = v
+	}
+	return q
+}
+
+func (p Page) sort(block, index string) []string {
+	fields := []string{block}
+	if index != "" {
+		fields = append(fields, index)
+	}
+
+	if p.Desc {
+		for i := range fields {
+			fields[i] = "-" + fields[i]
+		}
+	}
+	return fields
+}
+
+// bounds returns the range of blocks the page can hold, used to skip partitions.
+func (p Page) bounds() (uint64, uint64) {
+	if p.After == nil {
+		return 0, math.MaxUint64
+	}
+	if p.Desc {
+		return 0, p.After.Block
+	}
+	return p.After.Block, math.MaxUint64
+}
+
+// fetch is the number of items to query, one more than the limit tells if there is a next page.
+func (p Page) fetch() int {
+	return p.Limit + 1
+}
+
+// trim cuts result, a pointer to a slice fetched with p.fetch(), down to the page and
+// returns whether more items follow.
+func (p Page) trim(result interface{}) bool {
+	slice := reflect.ValueOf(result).Elem()
+
+	if slice.Len() <= p.Limit {
+		return false
+	}
+
+	slice.Set(slice.Slice(0, p.Limit))
+	return true
+}
@@ -0,0 +1,439 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubiq/spectrum-backend/models"
+)
+
+/*
+	Transactions and token transfers can be split into block range partitions, e.g. with a
+	partition size of 100000 block 1234567 lands in "transactions_1200000". The partitions
+	collection is the routing table, every partition has a row with the block range it covers.
+
+	The base collection keeps the data written before partitioning was enabled. While
+	partitioning is enabled nothing new is written to it, so its range is registered in the
+	routing table at startup; otherwise it's unregistered and always part of a fan out.
+
+	Everything in the storage package goes through the helpers below for these collections,
+	they route writes to the right partition and fan reads out to the partitions whose range
+	can match.
+*/
+
+const routingRefresh = 10 * time.Second
+
+var partitioned = []string{models.TXNS, models.TRANSFERS}
+
+type partition struct {
+	Collection string `bson:"collection"`
+	Name       string `bson:"name"`
+	From       uint64 `bson:"from"`
+	// To is exclusive
+	To uint64 `bson:"to"`
+}
+
+func (p partition) overlaps(from, to uint64) bool {
+	return p.From <= to && p.To > from
+}
+
+type routingTable struct {
+	sync.RWMutex
+	partitions map[string][]partition
+	loaded     time.Time
+}
+
+func isPartitioned(base string) bool {
+	for _, v := range partitioned {
+		if v == base {
+			return true
+		}
+	}
+	return false
+}
+
+// initPartitions registers or unregisters the base collections depending on the config.
+func (m *MongoDB) initPartitions(ctx context.Context) error {
+	m, done := m.scope(ctx)
+	defer done()
+
+	rt := m.c(models.PARTITIONS)
+
+	if err := rt.EnsureIndex(mgo.Index{Key: []string{"name"}, Unique: true}); err != nil {
+		return err
+	}
+
+	for _, base := range partitioned {
+		if m.partitionSize == 0 {
+			if _, err := rt.RemoveAll(bson.M{"name": base}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var first, last struct {
+			BlockNumber uint64 `bson:"blockNumber"`
+		}
+
+		err := m.c(base).Find(bson.M{}).Sort("blockNumber").Select(bson.M{"blockNumber": 1}).One(&first)
+		if err == mgo.ErrNotFound {
+			// Nothing to route to, keep it unregistered
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := m.c(base).Find(bson.M{}).Sort("-blockNumber").Select(bson.M{"blockNumber": 1}).One(&last); err != nil {
+			return err
+		}
+
+		p := partition{Collection: base, Name: base, From: first.BlockNumber, To: last.BlockNumber + 1}
+
+		if _, err := rt.Upsert(bson.M{"name": base}, p); err != nil {
+			return err
+		}
+	}
+
+	if err := m.loadRouting(); err != nil {
+		return err
+	}
+
+	// pipe fans aggregations out to the partitions with $unionWith
+	m.routing.RLock()
+	fanout := len(m.routing.partitions) > 0
+	m.routing.RUnlock()
+
+	if m.partitionSize > 0 || fanout {
+		info, err := m.session.BuildInfo()
+		if err != nil {
+			return err
+		}
+		if !info.VersionAtLeast(4, 4) {
+			return fmt.Errorf("partitioned collections need MongoDB 4.4 or later, the server runs %v", info.Version)
+		}
+	}
+
+	return nil
+}
+
+// loadRouting merges the routing table with the stored one. Partitions are never removed
+// once created, keeping the ones it doesn't know yet covers partitions created while the
+// rows were read.
+func (m *MongoDB) loadRouting() error {
+	var rows []partition
+
+	if err := m.c(models.PARTITIONS).Find(bson.M{}).All(&rows); err != nil {
+		return err
+	}
+
+	m.routing.Lock()
+	defer m.routing.Unlock()
+
+	table := make(map[string][]partition)
+	stored := make(map[string]bool, len(rows))
+
+	for _, v := range rows {
+		table[v.Collection] = append(table[v.Collection], v)
+		stored[v.Name] = true
+	}
+	for base, parts := range m.routing.partitions {
+		for _, v := range parts {
+			if !stored[v.Name] {
+				table[base] = append(table[base], v)
+			}
+		}
+	}
+
+	m.routing.partitions = table
+	m.routing.loaded = time.Now()
+
+	return nil
+}
+
+// partitions returns the collections of base that can hold blocks in [from, to], the newest
+// range first.
+func (m *MongoDB) partitions(base string, from, to uint64) []partition {
+	m.routing.RLock()
+	stale := time.Since(m.routing.loaded) > routingRefresh
+	m.routing.RUnlock()
+
+	if stale {
+		if err := m.loadRouting(); err != nil {
+			log.Errorf("Error loading partition routing table: %v", err)
+		}
+	}
+
+	m.routing.RLock()
+	defer m.routing.RUnlock()
+
+	result := make([]partition, 0)
+	registered := false
+
+	for _, v := range m.routing.partitions[base] {
+		if v.Name == base {
+			registered = true
+		}
+		if v.overlaps(from, to) {
+			result = append(result, v)
+		}
+	}
+
+	if !registered {
+		result = append(result, partition{Collection: base, Name: base, From: 0, To: math.MaxUint64})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].To > result[j].To
+	})
+
+	return result
+}
+
+// partitionFor returns the collection a document of base at height is written to, creating
+// the partition when it doesn't exist yet.
+func (m *MongoDB) partitionFor(base string, height uint64) (*mgo.Collection, error) {
+	if m.partitionSize == 0 {
+		return m.c(base), nil
+	}
+
+	from := height - height%m.partitionSize
+	name := fmt.Sprintf("%s_%d", base, from)
+
+	m.routing.RLock()
+	for _, v := range m.routing.partitions[base] {
+		if v.Name == name {
+			m.routing.RUnlock()
+			return m.c(name), nil
+		}
+	}
+	m.routing.RUnlock()
+
+	m.routing.Lock()
+	defer m.routing.Unlock()
+
+	// Another routine may have created it while waiting for the lock
+	for _, v := range m.routing.partitions[base] {
+		if v.Name == name {
+			return m.c(name), nil
+		}
+	}
+
+	p := partition{Collection: base, Name: name, From: from, To: from + m.partitionSize}
+
+	c := m.c(name)
+
+	indexes := txnIndexes
+	if base == models.TRANSFERS {
+		indexes = transferIndexes
+	}
+
+	for _, v := range indexes {
+		if err := c.EnsureIndex(v); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := m.c(models.PARTITIONS).Upsert(bson.M{"name": name}, p); err != nil {
+		return nil, err
+	}
+
+	if m.routing.partitions == nil {
+		m.routing.partitions = make(map[string][]partition)
+	}
+	m.routing.partitions[base] = append(m.routing.partitions[base], p)
+
+	log.Warnf("Created partition %v for blocks %v to %v", name, p.From, p.To-1)
+
+	return c, nil
+}
+
+// findOne looks for a single document, newest partitions first.
+func (m *MongoDB) findOne(base string, query bson.M, result interface{}) error {
+	for _, p := range m.partitions(base, 0, math.MaxUint64) {
+		err := m.c(p.Name).Find(query).One(result)
+
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		return err
+	}
+	return mgo.ErrNotFound
+}
+
+// findAll appends every document matching query in the blocks [from, to] to result, a
+// pointer to a slice, in no particular order.
+func (m *MongoDB) findAll(base string, from, to uint64, query bson.M, result interface{}) error {
+	slice := reflect.ValueOf(result).Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, 0))
+
+	for _, p := range m.partitions(base, from, to) {
+		part := reflect.New(slice.Type())
+
+		if err := m.c(p.Name).Find(query).All(part.Interface()); err != nil {
+			return err
+		}
+
+		slice.Set(reflect.AppendSlice(slice, part.Elem()))
+	}
+	return nil
+}
+
+type sortKey struct {
+	BlockNumber      uint64 `bson:"blockNumber"`
+	TransactionIndex uint64 `bson:"transactionIndex"`
+}
+
+func (k sortKey) less(o sortKey) bool {
+	if k.BlockNumber != o.BlockNumber {
+		return k.BlockNumber < o.BlockNumber
+	}
+	return k.TransactionIndex < o.TransactionIndex
+}
+
+// findSorted stores up to limit documents matching query in the blocks [from, to] into result,
+// a pointer to a slice, ordered by (blockNumber, transactionIndex). A limit of 0 returns every
+// match. Partitions are visited newest first (oldest first when ascending) and the fan out
+// stops as soon as the remaining ones can't hold anything that sorts before what was found.
+func (m *MongoDB) findSorted(base string, from, to uint64, query bson.M, desc bool, limit int, result interface{}) error {
+	type doc struct {
+		key sortKey
+		raw bson.Raw
+	}
+
+	parts := m.partitions(base, from, to)
+	if !desc {
+		sort.Slice(parts, func(i, j int) bool { return parts[i].From < parts[j].From })
+	}
+
+	order := []string{"blockNumber", "transactionIndex"}
+	if desc {
+		order = []string{"-blockNumber", "-transactionIndex"}
+	}
+
+	docs := make([]doc, 0)
+
+	less := func(i, j int) bool {
+		if desc {
+			return docs[j].key.less(docs[i].key)
+		}
+		return docs[i].key.less(docs[j].key)
+	}
+
+	for _, p := range parts {
+		if limit > 0 && len(docs) >= limit {
+			sort.Slice(docs, less)
+			docs = docs[:limit]
+
+			last := docs[limit-1].key.BlockNumber
+
+			if desc && p.To <= last || !desc && p.From > last {
+				break
+			}
+		}
+
+		var raws []bson.Raw
+
+		if err := m.c(p.Name).Find(query).Sort(order...).Limit(limit).All(&raws); err != nil {
+			return err
+		}
+
+		for _, raw := range raws {
+			var key sortKey
+			if err := raw.Unmarshal(&key); err != nil {
+				return err
+			}
+			docs = append(docs, doc{key, raw})
+		}
+	}
+
+	sort.Slice(docs, less)
+	if limit > 0 && len(docs) > limit {
+		docs = docs[:limit]
+	}
+
+	slice := reflect.ValueOf(result).Elem()
+	values := reflect.MakeSlice(slice.Type(), len(docs), len(docs))
+
+	for i, v := range docs {
+		if err := v.raw.Unmarshal(values.Index(i).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+
+	slice.Set(values)
+	return nil
+}
+
+// count sums the matches of query in the blocks [from, to] across partitions.
+func (m *MongoDB) count(base string, from, to uint64, query bson.M) (int, error) {
+	var total int
+
+	for _, p := range m.partitions(base, from, to) {
+		n, err := m.c(p.Name).Find(query).Count()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// updateAll applies update to the matches of selector in the blocks [from, to].
+func (m *MongoDB) updateAll(base string, from, to uint64, selector, update bson.M) (int, error) {
+	var updated int
+
+	for _, p := range m.partitions(base, from, to) {
+		info, err := m.c(p.Name).UpdateAll(selector, update)
+		if err != nil {
+			return updated, err
+		}
+		updated += info.Updated
+	}
+	return updated, nil
+}
+
+// removeAll removes the matches of selector in the blocks [from, to].
+func (m *MongoDB) removeAll(base string, from, to uint64, selector bson.M) (int, error) {
+	var removed int
+
+	for _, p := range m.partitions(base, from, to) {
+		info, err := m.c(p.Name).RemoveAll(selector)
+		if err != nil {
+			return removed, err
+		}
+		removed += info.Removed
+	}
+	return removed, nil
+}
+
+// pipe runs match on every partition of base and combines their documents through
+// $unionWith, after runs once on the combined stream. Stages grouping or sorting go in after,
+// in match they would apply to every partition on its own.
+func (m *MongoDB) pipe(base string, match, after []bson.M) *mgo.Pipe {
+	parts := m.partitions(base, 0, math.MaxUint64)
+
+	return m.c(parts[0].Name).Pipe(unionPipeline(parts, match, after))
+}
+
+func unionPipeline(parts []partition, match, after []bson.M) []bson.M {
+	if match == nil {
+		match = []bson.M{}
+	}
+
+	pipeline := append([]bson.M{}, match...)
+
+	for _, p := range parts[1:] {
+		pipeline = append(pipeline, bson.M{"$unionWith": bson.M{"coll": p.Name, "pipeline": match}})
+	}
+
+	return append(pipeline, after...)
+}
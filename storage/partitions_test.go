@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/ubiq/spectrum-backend/models"
+)
+
+func TestUnionPipelineGroupsOnce(t *testing.T) {
+	parts := []partition{
+		{Collection: models.TRANSFERS, Name: "tokentransfers_100", From: 100, To: 200},
+		{Collection: models.TRANSFERS, Name: "tokentransfers_0", From: 0, To: 100},
+	}
+
+	match := []bson.M{{"$match": bson.M{"contract": "0xc"}}}
+	group := bson.M{"$group": bson.M{"_id": "$contract", "count": bson.M{"$sum": 1}}}
+
+	got := unionPipeline(parts, match, []bson.M{group})
+
+	want := []bson.M{
+		{"$match": bson.M{"contract": "0xc"}},
+		{"$unionWith": bson.M{"coll": "tokentransfers_0", "pipeline": match}},
+		group,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("pipeline = %v, want %v", got, want)
+	}
+}
+
+func TestUnionPipelineSinglePartition(t *testing.T) {
+	parts := []partition{{Collection: models.TRANSFERS, Name: models.TRANSFERS, To: 1 << 62}}
+	sort := bson.M{"$sort": bson.M{"timestamp": 1}}
+
+	got := unionPipeline(parts, nil, []bson.M{sort})
+
+	if want := []bson.M{sort}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pipeline = %v, want %v", got, want)
+	}
+}
+
+func TestUnionPipelineEmptyMatch(t *testing.T) {
+	parts := []partition{{Name: "a"}, {Name: "b"}}
+
+	got := unionPipeline(parts, nil, nil)
+
+	union, ok := got[0]["$unionWith"].(bson.M)
+	if len(got) != 1 || !ok {
+		t.Fatalf("pipeline = %v, want a single $unionWith", got)
+	}
+	// A null pipeline is rejected by the server
+	if p, ok := union["pipeline"].([]bson.M); !ok || p == nil {
+		t.Errorf("$unionWith pipeline = %#v, want an empty list", union["pipeline"])
+	}
+}
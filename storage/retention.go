@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/ubiq/spectrum-backend/models"
+)
+
+/*
+	Retention rules are applied in windows of blocks, from the lowest block up. Each rule
+	keeps its progress in a sysStore (symbol "retention:<rule>"), everything below the
+	stored height has already been pruned.
+*/
+
+const (
+	retentionTxData = "retention:txdata"
+	retentionBodies = "retention:bodies"
+)
+
+func (m *MongoDB) retentionProgress(rule string) (uint64, error) {
+	var store models.Store
+
+	err := m.c(models.STORE).Find(bson.M{"symbol": rule}).One(&store)
+
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	}
+
+	return store.Sync[0], err
+}
+
+func (m *MongoDB) setRetentionProgress(rule string, height uint64) error {
+	_, err := m.c(models.STORE).Upsert(bson.M{"symbol": rule}, bson.M{"$set": bson.M{"sync": [1]uint64{height}}})
+	return err
+}
+
+// PruneTxData drops input and logs of transactions below height, batch blocks at a time.
+// Pruned transactions are flagged so the api can tell them apart. Returns the number of
+// transactions pruned.
+func (m *MongoDB) PruneTxData(ctx context.Context, below uint64, batch uint64) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var pruned int
+
+	from, err := m.retentionProgress(retentionTxData)
+	if err != nil {
+		return 0, err
+	}
+
+	for from < below {
+		if err := ctx.Err(); err != nil {
+			return pruned, err
+		}
+
+		to := from + batch
+		if to > below {
+			to = below
+		}
+
+		updated, err := m.updateAll(models.TXNS, from, to-1,
+			bson.M{"blockNumber": bson.M{"$gte": from, "$lt": to}},
+			bson.M{"$set": bson.M{"input": "", "logs": nil, "pruned": true}},
+		)
+		if err != nil {
+			return pruned, err
+		}
+		pruned += updated
+
+		if err := m.setRetentionProgress(retentionTxData, to); err != nil {
+			return pruned, err
+		}
+
+		from = to
+	}
+
+	return pruned, nil
+}
+
+// PruneBodies keeps only the headers of blocks below height: transactions, token transfers
+// and uncles are removed batch blocks at a time and the blocks are flagged. Activity rows are
+// small and kept, address history lists pruned documents as stubs. Counters are decremented,
+// they reflect the data that is still indexed. Returns the number of blocks pruned.
+func (m *MongoDB) PruneBodies(ctx context.Context, below uint64, batch uint64) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var pruned int
+
+	from, err := m.retentionProgress(retentionBodies)
+	if err != nil {
+		return 0, err
+	}
+
+	for from < below {
+		if err := ctx.Err(); err != nil {
+			return pruned, err
+		}
+
+		to := from + batch
+		if to > below {
+			to = below
+		}
+
+		selector := bson.M{"blockNumber": bson.M{"$gte": from, "$lt": to}}
+
+		counters, err := m.removalCounters(from, to-1, false)
+		if err != nil {
+			return pruned, err
+		}
+
+		for _, c := range []string{models.TXNS, models.TRANSFERS, models.UNCLES} {
+			if _, err := m.removeAll(c, from, to-1, selector); err != nil {
+				return pruned, err
+			}
+		}
+
+		if err := m.applyCounters(counters); err != nil {
+			return pruned, err
+		}
+
+		info, err := m.c(models.BLOCKS).UpdateAll(
+			bson.M{"number": bson.M{"$gte": from, "$lt": to}},
+			bson.M{"$set": bson.M{"pruned": true}},
+		)
+		if err != nil {
+			return pruned, err
+		}
+		pruned += info.Updated
+
+		if err := m.setRetentionProgress(retentionBodies, to); err != nil {
+			return pruned, err
+		}
+
+		from = to
+	}
+
+	return pruned, nil
+}
+
+// CapForkedBlocks removes the oldest forked blocks so at most max are kept, batch at a time.
+// Returns the number of forked blocks removed.
+func (m *MongoDB) CapForkedBlocks(ctx context.Context, max int, batch int) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var removed int
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+
+		var blocks []bson.M
+
+		err := m.c(models.REORGS).Find(bson.M{}).Sort("-number").Skip(max).Limit(batch).Select(bson.M{"_id": 1}).All(&blocks)
+		if err != nil {
+			return removed, err
+		}
+
+		if len(blocks) == 0 {
+			return removed, nil
+		}
+
+		ids := make([]interface{}, len(blocks))
+		for i, v := range blocks {
+			ids[i] = v["_id"]
+		}
+
+		info, err := m.c(models.REORGS).RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return removed, err
+		}
+		removed += info.Removed
+	}
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"regexp"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/ubiq/spectrum-backend/models"
+)
+
+// prefix matches the values starting with s, anchored and case sensitive so it is answered
+// from the index.
+func prefix(s string) bson.M {
+	return bson.M{"$regex": "^" + regexp.QuoteMeta(s)}
+}
+
+func (m *MongoDB) BlocksByHashPrefix(ctx context.Context, hash string, limit int) ([]models.Block, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var blocks []models.Block
+
+	err := m.c(models.BLOCKS).Find(bson.M{"hash": prefix(hash)}).Limit(limit).All(&blocks)
+	return blocks, err
+}
+
+func (m *MongoDB) ForkedBlocksByHashPrefix(ctx context.Context, hash string, limit int) ([]models.Block, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var blocks []models.Block
+
+	err := m.c(models.REORGS).Find(bson.M{"hash": prefix(hash)}).Limit(limit).All(&blocks)
+	return blocks, err
+}
+
+func (m *MongoDB) UnclesByHashPrefix(ctx context.Context, hash string, limit int) ([]models.Uncle, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var uncles []models.Uncle
+
+	err := m.c(models.UNCLES).Find(bson.M{"hash": prefix(hash)}).Limit(limit).All(&uncles)
+	return uncles, err
+}
+
+// TransactionsByHashPrefix returns the latest transactions whose hash starts with hash.
+func (m *MongoDB) TransactionsByHashPrefix(ctx context.Context, hash string, limit int) ([]models.Transaction, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var txns []models.Transaction
+
+	err := m.findSorted(models.TXNS, 0, math.MaxUint64, bson.M{"hash": prefix(hash)}, true, limit, &txns)
+	return txns, err
+}
@@ -1,12 +1,166 @@
 package storage
 
 import (
+	"context"
+	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 	"github.com/ubiq/spectrum-backend/models"
 )
 
-func (m *MongoDB) AddTransaction(tx *models.Transaction) error {
-	ss := m.db.C(models.TXNS)
+// AddBlockData stores a block together with its transactions, token transfers, uncles and
+// the address activity rows derived from them.
+// Each collection is written with a single unordered bulk insert, documents that are already
+// present are skipped so a height can be indexed again safely. Counters are only incremented
+// for documents that were actually written. The block is written last, it marks the height as
+// complete for IsPresent.
+func (m *MongoDB) AddBlockData(ctx context.Context, b *models.Block, txs []*models.Transaction, transfers []*models.TokenTransfer, uncles []*models.Uncle) error {
+	m, done := m.scope(ctx)
+	defer done()
+
+	counters := make(counterDeltas)
+
+	docs := make([]interface{}, len(txs))
+	for i, v := range txs {
+		docs[i] = v
+	}
+	c, err := m.partitionFor(models.TXNS, b.Number)
+	if err != nil {
+		return err
+	}
+	inserted, err := bulkInsert(c, docs)
+	if err != nil {
+		return err
+	}
+	counters.add(models.TXNS, len(inserted))
+
+	docs = make([]interface{}, len(transfers))
+	for i, v := range transfers {
+		docs[i] = v
+	}
+	c, err = m.partitionFor(models.TRANSFERS, b.Number)
+	if err != nil {
+		return err
+	}
+	balanceLock.Lock()
+	inserted, err = bulkInsert(c, docs)
+	if err == nil {
+		err = m.applyBalances(insertedBalances(inserted, txs), counters)
+	}
+	balanceLock.Unlock()
+	if err != nil {
+		return err
+	}
+	counters.add(models.TRANSFERS, len(inserted))
+	for _, v := range inserted {
+		counters.add(contractCounter(v.(*models.TokenTransfer).Contract), 1)
+	}
+
+	docs = make([]interface{}, 0, len(txs)*2+len(transfers)*2)
+	for _, v := range txs {
+		for _, a := range v.Activity() {
+			docs = append(docs, a)
+		}
+	}
+	for _, v := range transfers {
+		for _, a := range v.Activity() {
+			docs = append(docs, a)
+		}
+	}
+	inserted, err = bulkInsert(m.c(models.ACTIVITY), docs)
+	if err != nil {
+		return err
+	}
+	for _, v := range inserted {
+		counters.addActivity(v.(*models.AddressActivity), 1)
+	}
+
+	docs = make([]interface{}, len(uncles))
+	for i, v := range uncles {
+		docs[i] = v
+	}
+	inserted, err = bulkInsert(m.c(models.UNCLES), docs)
+	if err != nil {
+		return err
+	}
+	counters.add(models.UNCLES, len(inserted))
+
+	inserted, err = bulkInsert(m.c(models.BLOCKS), []interface{}{b})
+	if err != nil {
+		return err
+	}
+	counters.add(models.BLOCKS, len(inserted))
+
+	return m.applyCounters(counters)
+}
+
+// insertedBalances returns the balance changes of the transfers written, txs tell the
+// failed ones.
+func insertedBalances(inserted []interface{}, txs []*models.Transaction) balanceDeltas {
+	failed := make(map[string]bool)
+	for _, v := range txs {
+		if v.Status == "0x0" {
+			failed[v.Hash] = true
+		}
+	}
+
+	transfers := make([]models.TokenTransfer, len(inserted))
+	for i, v := range inserted {
+		transfers[i] = *v.(*models.TokenTransfer)
+	}
+	return transferBalances(transfers, failed, 1)
+}
+
+// bulkInsert inserts docs with an unordered bulk write and returns the documents that were
+// written. Duplicate key errors are not reported, the duplicates are left out of the result.
+func bulkInsert(c *mgo.Collection, docs []interface{}) ([]interface{}, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	bulk := c.Bulk()
+	bulk.Unordered()
+	bulk.Insert(docs...)
+
+	_, err := bulk.Run()
+	if err == nil {
+		return docs, nil
+	}
+
+	if !mgo.IsDup(err) {
+		return nil, err
+	}
+
+	berr, ok := err.(*mgo.BulkError)
+	if !ok {
+		return nil, nil
+	}
+
+	skipped := make(map[int]bool)
+	for _, v := range berr.Cases() {
+		// Older servers don't report the position, assume nothing was written
+		if v.Index < 0 {
+			return nil, nil
+		}
+		skipped[v.Index] = true
+	}
+
+	inserted := make([]interface{}, 0, len(docs)-len(skipped))
+	for i, v := range docs {
+		if !skipped[i] {
+			inserted = append(inserted, v)
+		}
+	}
+	return inserted, nil
+}
+
+func (m *MongoDB) AddTransaction(ctx context.Context, tx *models.Transaction) error {
+	m, done := m.scope(ctx)
+	defer done()
+
+	ss, err := m.partitionFor(models.TXNS, tx.BlockNumber)
+	if err != nil {
+		return err
+	}
 
 	if err := ss.Insert(tx); err != nil {
 		return err
@@ -14,8 +168,14 @@ func (m *MongoDB) AddTransaction(tx *models.Transaction) error {
 	return nil
 }
 
-func (m *MongoDB) AddTokenTransfer(tt *models.TokenTransfer) error {
-	ss := m.db.C(models.TRANSFERS)
+func (m *MongoDB) AddTokenTransfer(ctx context.Context, tt *models.TokenTransfer) error {
+	m, done := m.scope(ctx)
+	defer done()
+
+	ss, err := m.partitionFor(models.TRANSFERS, tt.BlockNumber)
+	if err != nil {
+		return err
+	}
 
 	if err := ss.Insert(tt); err != nil {
 		return err
@@ -23,8 +183,11 @@ func (m *MongoDB) AddTokenTransfer(tt *models.TokenTransfer) error {
 	return nil
 }
 
-func (m *MongoDB) AddUncle(u *models.Uncle) error {
-	ss := m.db.C(models.UNCLES)
+func (m *MongoDB) AddUncle(ctx context.Context, u *models.Uncle) error {
+	m, done := m.scope(ctx)
+	defer done()
+
+	ss := m.c(models.UNCLES)
 
 	if err := ss.Insert(u); err != nil {
 		return err
@@ -32,8 +195,11 @@ func (m *MongoDB) AddUncle(u *models.Uncle) error {
 	return nil
 }
 
-func (m *MongoDB) AddBlock(b *models.Block) error {
-	ss := m.db.C(models.BLOCKS)
+func (m *MongoDB) AddBlock(ctx context.Context, b *models.Block) error {
+	m, done := m.scope(ctx)
+	defer done()
+
+	ss := m.c(models.BLOCKS)
 
 	if err := ss.Insert(b); err != nil {
 		return err
@@ -41,8 +207,11 @@ func (m *MongoDB) AddBlock(b *models.Block) error {
 	return nil
 }
 
-func (m *MongoDB) AddForkedBlock(b *models.Block) error {
-	ss := m.db.C(models.REORGS)
+func (m *MongoDB) AddForkedBlock(ctx context.Context, b *models.Block) error {
+	m, done := m.scope(ctx)
+	defer done()
+
+	ss := m.c(models.REORGS)
 
 	if err := ss.Insert(b); err != nil {
 		return err
@@ -50,8 +219,11 @@ func (m *MongoDB) AddForkedBlock(b *models.Block) error {
 	return nil
 }
 
-func (m *MongoDB) AddLineChart(t *models.LineChart) error {
-	ss := m.db.C(models.CHARTS)
+func (m *MongoDB) AddLineChart(ctx context.Context, t *models.LineChart) error {
+	m, done := m.scope(ctx)
+	defer done()
+
+	ss := m.c(models.CHARTS)
 
 	if _, err := ss.Upsert(bson.M{"chart": t.Chart}, t); err != nil {
 		return err
@@ -59,8 +231,11 @@ func (m *MongoDB) AddLineChart(t *models.LineChart) error {
 	return nil
 }
 
-func (m *MongoDB) AddMLChart(t *models.MLineChart) error {
-	ss := m.db.C(models.CHARTS)
+func (m *MongoDB) AddMLChart(ctx context.Context, t *models.MLineChart) error {
+	m, done := m.scope(ctx)
+	defer done()
+
+	ss := m.c(models.CHARTS)
 
 	if _, err := ss.Upsert(bson.M{"chart": t.Chart}, t); err != nil {
 		return err
@@ -0,0 +1,446 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	log "github.com/sirupsen/logrus"
+	"github.com/ubiq/spectrum-backend/models"
+)
+
+/*
+	A snapshot is a directory holding manifest.json and gzip compressed chunks of raw BSON
+	documents, one chunk file per chunkSize documents. The manifest records the head of the
+	snapshot and the sha256 of every chunk, checksums are verified before anything is
+	imported. Counters are not exported, they are rebuilt after the import.
+*/
+
+const (
+	snapshotVersion  = 1
+	snapshotManifest = "manifest.json"
+)
+
+type SnapshotChunk struct {
+	File   string `json:"file"`
+	Docs   int    `json:"docs"`
+	Sha256 string `json:"sha256"`
+}
+
+type SnapshotCollection struct {
+	Name   string          `json:"name"`
+	Docs   int             `json:"docs"`
+	Chunks []SnapshotChunk `json:"chunks"`
+}
+
+type SnapshotManifest struct {
+	Version     int                  `json:"version"`
+	Height      uint64               `json:"height"`
+	Hash        string               `json:"hash"`
+	Timestamp   int64                `json:"timestamp"`
+	Collections []SnapshotCollection `json:"collections"`
+}
+
+// snapshotCollections lists what goes into a snapshot and how to cut it at a height.
+// The sysstores go last, their presence marks an initialized database for the crawler.
+var snapshotCollections = []struct {
+	name  string
+	query func(height uint64) bson.M
+}{
+	{models.BLOCKS, func(h uint64) bson.M { return bson.M{"number": bson.M{"$lte": h}} }},
+	{models.TXNS, func(h uint64) bson.M { return bson.M{"blockNumber": bson.M{"$lte": h}} }},
+	{models.TRANSFERS, func(h uint64) bson.M { return bson.M{"blockNumber": bson.M{"$lte": h}} }},
+	{models.UNCLES, func(h uint64) bson.M { return bson.M{"blockNumber": bson.M{"$lte": h}} }},
+	{models.ACTIVITY, func(h uint64) bson.M { return bson.M{"blockNumber": bson.M{"$lte": h}} }},
+	{models.REORGS, func(h uint64) bson.M { return bson.M{"number": bson.M{"$lte": h}} }},
+	{models.TOKENS, func(h uint64) bson.M { return bson.M{"firstBlock": bson.M{"$lte": h}} }},
+	{models.CHARTS, func(h uint64) bson.M { return bson.M{} }},
+	// Balances aren't kept by height, the importing crawler backfills and checks them again.
+	// Counters aren't exported, the import reconciles them
+	{models.STORE, func(h uint64) bson.M { return bson.M{"symbol": bson.M{"$nin": []string{"balances", countersMarker}}} }},
+}
+
+// ExportSnapshot writes every indexed collection up to height into dir. A height of 0 exports
+// up to the block the ubq supply was last computed at, which keeps the supply consistent.
+func (m *MongoDB) ExportSnapshot(ctx context.Context, dir string, height uint64, chunkSize int) (*SnapshotManifest, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	if head := m.IndexHead(ctx); head[0] != 0 {
+		return nil, errors.New("index is still syncing, snapshots need a complete index")
+	}
+
+	supply, err := m.SupplyObject(ctx, "ubq")
+	if err != nil {
+		return nil, err
+	}
+
+	if height == 0 || height > supply.LatestBlock.Number {
+		height = supply.LatestBlock.Number
+	}
+	if height < supply.LatestBlock.Number {
+		log.Warnf("Snapshot height %v is below the ubq supply head %v, supply will include later blocks", height, supply.LatestBlock.Number)
+	}
+
+	head, err := m.BlockByNumber(ctx, height)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot head %v: %v", height, err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	manifest := &SnapshotManifest{
+		Version:   snapshotVersion,
+		Height:    head.Number,
+		Hash:      head.Hash,
+		Timestamp: time.Now().Unix(),
+	}
+
+	for _, c := range snapshotCollections {
+		collection := SnapshotCollection{Name: c.name}
+
+		// Partitions are exported under their base collection
+		sources := []string{c.name}
+		if isPartitioned(c.name) {
+			sources = sources[:0]
+			for _, p := range m.partitions(c.name, 0, height) {
+				sources = append(sources, p.Name)
+			}
+		}
+
+		var chunk *snapshotWriter
+
+		for _, source := range sources {
+			if err := m.exportCollection(dir, source, c.query(height), &collection, &chunk, chunkSize); err != nil {
+				return nil, err
+			}
+		}
+
+		if chunk != nil {
+			if err := collection.closeChunk(chunk); err != nil {
+				return nil, err
+			}
+		}
+
+		log.Printf("Exported %v: %v documents in %v chunk(s)", c.name, collection.Docs, len(collection.Chunks))
+
+		manifest.Collections = append(manifest.Collections, collection)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, writeFileSync(filepath.Join(dir, snapshotManifest), data)
+}
+
+// exportCollection appends the documents of source matching query to the chunks of collection,
+// chunk is the currently open chunk file and is carried over between sources.
+func (m *MongoDB) exportCollection(dir, source string, query bson.M, collection *SnapshotCollection, chunk **snapshotWriter, chunkSize int) error {
+	var raw bson.Raw
+	var err error
+
+	iter := m.c(source).Find(query).Iter()
+
+	for iter.Next(&raw) {
+		if *chunk == nil {
+			*chunk, err = newSnapshotWriter(dir, fmt.Sprintf("%s-%05d.bson.gz", collection.Name, len(collection.Chunks)))
+			if err != nil {
+				iter.Close()
+				return err
+			}
+		}
+
+		// The sync state of a snapshot is always a completed sync
+		if collection.Name == models.STORE {
+			raw, err = snapshotStore(raw)
+			if err != nil {
+				iter.Close()
+				return err
+			}
+		}
+
+		if err := (*chunk).write(raw.Data); err != nil {
+			iter.Close()
+			return err
+		}
+
+		collection.Docs++
+
+		if (*chunk).docs == chunkSize {
+			if err := collection.closeChunk(*chunk); err != nil {
+				iter.Close()
+				return err
+			}
+			*chunk = nil
+		}
+	}
+
+	return iter.Close()
+}
+
+// ImportSnapshot restores a snapshot written by ExportSnapshot into an empty database.
+// Every chunk is verified against the manifest before the first document is written.
+// Documents that already exist are skipped, so an interrupted import can be run again.
+func (m *MongoDB) ImportSnapshot(ctx context.Context, dir string) (*SnapshotManifest, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var manifest SnapshotManifest
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, snapshotManifest))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	if manifest.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %v", manifest.Version)
+	}
+
+	if !m.IsFirstRun(ctx) {
+		return nil, errors.New("database is already initialized, snapshots can only be imported into an empty database")
+	}
+
+	for _, c := range manifest.Collections {
+		for _, chunk := range c.Chunks {
+			if err := verifyChunk(dir, chunk); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	log.Printf("Verified snapshot at block %v (%v)", manifest.Height, manifest.Hash)
+
+	m.InitIndex(ctx)
+
+	for _, c := range manifest.Collections {
+		for _, chunk := range c.Chunks {
+			docs, err := readChunk(dir, chunk)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := m.importDocs(c.Name, docs); err != nil {
+				return nil, fmt.Errorf("%v: %v", chunk.File, err)
+			}
+		}
+
+		log.Printf("Imported %v: %v documents", c.Name, c.Docs)
+	}
+
+	m.ReconcileCounters(ctx)
+
+	return &manifest, nil
+}
+
+// importDocs inserts docs into collection, 1000 at a time. Documents of partitioned collections
+// are routed to the partition of their block.
+func (m *MongoDB) importDocs(collection string, docs []interface{}) error {
+	targets := map[string][]interface{}{collection: docs}
+
+	if isPartitioned(collection) && m.partitionSize > 0 {
+		targets = make(map[string][]interface{})
+
+		for _, v := range docs {
+			var key sortKey
+			if err := v.(bson.Raw).Unmarshal(&key); err != nil {
+				return err
+			}
+
+			c, err := m.partitionFor(collection, key.BlockNumber)
+			if err != nil {
+				return err
+			}
+			targets[c.Name] = append(targets[c.Name], v)
+		}
+	}
+
+	for name, docs := range targets {
+		for i := 0; i < len(docs); i += 1000 {
+			end := i + 1000
+			if end > len(docs) {
+				end = len(docs)
+			}
+			if _, err := bulkInsert(m.c(name), docs[i:end]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func snapshotStore(raw bson.Raw) (bson.Raw, error) {
+	var store bson.D
+
+	if err := raw.Unmarshal(&store); err != nil {
+		return raw, err
+	}
+
+	isSync := false
+	for _, v := range store {
+		if v.Name == "symbol" && v.Value == "sync" {
+			isSync = true
+		}
+	}
+
+	if !isSync {
+		return raw, nil
+	}
+
+	for i, v := range store {
+		if v.Name == "sync" {
+			store[i].Value = [1]uint64{0}
+		}
+	}
+
+	data, err := bson.Marshal(store)
+	return bson.Raw{Kind: 0x03, Data: data}, err
+}
+
+type snapshotWriter struct {
+	file *os.File
+	name string
+	sum  func() string
+	gz   *gzip.Writer
+	docs int
+}
+
+func newSnapshotWriter(dir, name string) (*snapshotWriter, error) {
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(f, h))
+
+	return &snapshotWriter{
+		file: f,
+		name: name,
+		gz:   gz,
+		sum:  func() string { return hex.EncodeToString(h.Sum(nil)) },
+	}, nil
+}
+
+func (s *snapshotWriter) write(doc []byte) error {
+	s.docs++
+	_, err := s.gz.Write(doc)
+	return err
+}
+
+func (c *SnapshotCollection) closeChunk(s *snapshotWriter) error {
+	if err := s.gz.Close(); err != nil {
+		s.file.Close()
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		s.file.Close()
+		return err
+	}
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+
+	c.Chunks = append(c.Chunks, SnapshotChunk{File: s.name, Docs: s.docs, Sha256: s.sum()})
+	return nil
+}
+
+func writeFileSync(name string, data []byte) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func verifyChunk(dir string, chunk SnapshotChunk) error {
+	f, err := os.Open(filepath.Join(dir, chunk.File))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != chunk.Sha256 {
+		return fmt.Errorf("checksum mismatch for %v: expected %v, got %v", chunk.File, chunk.Sha256, sum)
+	}
+	return nil
+}
+
+// readChunk decodes a chunk into raw documents, BSON documents carry their own length prefix.
+func readChunk(dir string, chunk SnapshotChunk) ([]interface{}, error) {
+	f, err := os.Open(filepath.Join(dir, chunk.File))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	docs := make([]interface{}, 0, chunk.Docs)
+
+	for {
+		var size [4]byte
+
+		if _, err := io.ReadFull(gz, size[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%v: %v", chunk.File, err)
+		}
+
+		n := binary.LittleEndian.Uint32(size[:])
+		if n < 5 {
+			return nil, fmt.Errorf("%v: invalid document length %v", chunk.File, n)
+		}
+
+		doc := make([]byte, n)
+		copy(doc, size[:])
+
+		if _, err := io.ReadFull(gz, doc[4:]); err != nil {
+			return nil, fmt.Errorf("%v: %v", chunk.File, err)
+		}
+
+		docs = append(docs, bson.Raw{Kind: 0x03, Data: doc})
+	}
+
+	if len(docs) != chunk.Docs {
+		return nil, fmt.Errorf("%v: expected %v documents, got %v", chunk.File, chunk.Docs, len(docs))
+	}
+
+	return docs, nil
+}
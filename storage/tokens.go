@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"math"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/ubiq/spectrum-backend/models"
+)
+
+func (m *MongoDB) Token(ctx context.Context, contract string) (models.Token, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var token models.Token
+
+	err := m.c(models.TOKENS).Find(bson.M{"contract": contract}).One(&token)
+	return token, err
+}
+
+// Tokens pages the registry by the first transfer of every token.
+func (m *MongoDB) Tokens(ctx context.Context, p Page) ([]models.Token, bool, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var tokens []models.Token
+
+	err := m.c(models.TOKENS).Find(p.query(bson.M{}, "firstBlock", "firstIndex")).Sort(p.sort("firstBlock", "firstIndex")...).Limit(p.fetch()).All(&tokens)
+	return tokens, p.trim(&tokens), err
+}
+
+func (m *MongoDB) TokenCount(ctx context.Context) (int, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	return m.c(models.TOKENS).Count()
+}
+
+// TokensByContract returns the known tokens among contracts.
+func (m *MongoDB) TokensByContract(ctx context.Context, contracts []string) (map[string]models.Token, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	var tokens []models.Token
+
+	err := m.c(models.TOKENS).Find(bson.M{"contract": bson.M{"$in": contracts}}).All(&tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]models.Token, len(tokens))
+	for _, v := range tokens {
+		result[v.Contract] = v
+	}
+	return result, nil
+}
+
+// AddToken registers a token unless it's already known.
+func (m *MongoDB) AddToken(ctx context.Context, t *models.Token) error {
+	m, done := m.scope(ctx)
+	defer done()
+
+	_, err := m.c(models.TOKENS).Upsert(bson.M{"contract": t.Contract}, bson.M{"$setOnInsert": t})
+	if mgo.IsDup(err) {
+		// Registered concurrently
+		return nil
+	}
+	return err
+}
+
+// UpdateToken writes the metadata of a token, registering it when it's new.
+func (m *MongoDB) UpdateToken(ctx context.Context, t *models.Token) error {
+	m, done := m.scope(ctx)
+	defer done()
+
+	_, err := m.c(models.TOKENS).Upsert(bson.M{"contract": t.Contract}, bson.M{"$set": t})
+	return err
+}
+
+// TransferContracts returns every contract with token transfers, as tokens holding only the
+// position of their first transfer. Each partition walks its {contract, blockNumber,
+// transactionIndex} index, the earliest transfer of a contract is kept across them.
+func (m *MongoDB) TransferContracts(ctx context.Context) ([]models.Token, error) {
+	m, done := m.scope(ctx)
+	defer done()
+
+	pipeline := []bson.M{
+		{"$sort": bson.M{"contract": 1, "blockNumber": 1, "transactionIndex": 1}},
+		{"$group": bson.M{"_id": "$contract", "blockNumber": bson.M{"$first": "$blockNumber"}, "transactionIndex": bson.M{"$first": "$transactionIndex"}}},
+	}
+
+	first := make(map[string]sortKey)
+
+	for _, p := range m.partitions(models.TRANSFERS, 0, math.MaxUint64) {
+		var res []struct {
+			Contract string `bson:"_id"`
+			sortKey  `bson:",inline"`
+		}
+		if err := m.c(p.Name).Pipe(pipeline).All(&res); err != nil {
+			return nil, err
+		}
+
+		for _, v := range res {
+			if k, ok := first[v.Contract]; !ok || v.sortKey.less(k) {
+				first[v.Contract] = v.sortKey
+			}
+		}
+	}
+
+	tokens := make([]models.Token, 0, len(first))
+	for contract, k := range first {
+		tokens = append(tokens, models.Token{Contract: contract, FirstBlock: k.BlockNumber, FirstIndex: k.TransactionIndex})
+	}
+	return tokens, nil
+}
@@ -140,6 +140,34 @@ func FormatQwark(str string) string {
 	return x.String()
 }
 
+// FormatUnits shifts an integer amount by decimals places, exactly and without trailing
+// zeros, e.g. 1500000 with 6 decimals is "1.5".
+func FormatUnits(str string, decimals uint64) string {
+	x, ok := new(big.Int).SetString(str, 10)
+	if !ok || decimals > 255 {
+		return str
+	}
+
+	neg := x.Sign() < 0
+	digits := new(big.Int).Abs(x).String()
+
+	if d := int(decimals); d > 0 {
+		if len(digits) <= d {
+			digits = strings.Repeat("0", d-len(digits)+1) + digits
+		}
+		whole, frac := digits[:len(digits)-d], strings.TrimRight(digits[len(digits)-d:], "0")
+		digits = whole
+		if frac != "" {
+			digits += "." + frac
+		}
+	}
+
+	if neg {
+		return "-" + digits
+	}
+	return digits
+}
+
 func baseBlockReward(height uint64) *big.Int {
 	if height > 2508545 {
 		return big.NewInt(1000000000000000000)